@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 
 	"github.com/bloom42/astroflow-go"
 	"github.com/bloom42/astroflow-go/log"
@@ -18,13 +19,22 @@ func init() {
 	InitCmd.Flags().BoolVar(&initForce, "force", false, fmt.Sprintf("Force and override an existing %s.san file", config.DefaultConfigurationFileName))
 }
 
-// InitCmd is the rocket's `init` command. It creates a configuration with default configuration
+// InitCmd is the rocket's `init` command. It creates a configuration with default configuration,
+// or with a commented section for each provider given as argument
 var InitCmd = &cobra.Command{
-	Use:   "init",
+	Use:   "init [providers...]",
 	Short: fmt.Sprintf("Init rocket by creating a %s configuration file", config.DefaultConfigurationFileName),
 	Long:  fmt.Sprintf("Init rocket by creating a %s configuration file", config.DefaultConfigurationFileName),
 	Run: func(cmd *cobra.Command, args []string) {
-		configFile := config.FindConfigFile("")
+		// only the working directory is checked: a configuration file can be created in a subdirectory
+		// of a project which has one
+		configFile := ""
+		for _, fileName := range config.ConfigurationFileNames {
+			if _, err := os.Stat(fileName); err == nil {
+				configFile = fileName
+				break
+			}
+		}
 		var err error
 
 		if debug {
@@ -35,9 +45,15 @@ var InitCmd = &cobra.Command{
 			log.Fatal(fmt.Sprintf("A configuration file already exists (%s), use --force to override", configFile))
 		}
 
-		conf := config.Default()
 		filePath := config.DefaultConfigurationFileName
-		buf, err := san.Marshal(conf)
+		var buf []byte
+		if len(args) != 0 {
+			var content string
+			content, err = config.InitConfig(args)
+			buf = []byte(content)
+		} else {
+			buf, err = san.Marshal(config.Default())
+		}
 		if err != nil {
 			log.Fatal(err.Error())
 		}
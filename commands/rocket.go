@@ -1,18 +1,12 @@
 package commands
 
 import (
-	"fmt"
+	"encoding/json"
 	"os"
 	"path/filepath"
 
 	"github.com/bloom42/rocket/config"
-	"github.com/bloom42/rocket/providers/awseb"
-	"github.com/bloom42/rocket/providers/awss3"
-	"github.com/bloom42/rocket/providers/docker"
-	"github.com/bloom42/rocket/providers/ghreleases"
-	"github.com/bloom42/rocket/providers/heroku"
-	"github.com/bloom42/rocket/providers/script"
-	"github.com/bloom42/rocket/providers/zeitnow"
+	"github.com/bloom42/rocket/providers"
 	"github.com/bloom42/astroflow-go"
 	"github.com/bloom42/astroflow-go/log"
 	"github.com/spf13/cobra"
@@ -20,10 +14,20 @@ import (
 
 var rocketConfigPath string
 var debug bool
+var dryRun bool
+var jsonOutput bool
+var only []string
+var skip []string
+var environment string
 
 func init() {
 	RocketCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "Display debug information")
-	RocketCmd.Flags().StringVarP(&rocketConfigPath, "config", "c", "", "Use the specified configuration file (and set it's directory as the working directory")
+	RocketCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Display the actions the providers would perform, without deploying")
+	RocketCmd.Flags().BoolVar(&jsonOutput, "json", false, "Write the report of the deployment as JSON to stdout, and the logs to stderr")
+	RocketCmd.Flags().StringSliceVar(&only, "only", nil, "Run only the specified providers (e.g. --only docker,aws_s3), overriding the only field of the configuration")
+	RocketCmd.Flags().StringSliceVar(&skip, "skip", nil, "Do not run the specified providers, overriding the skip field of the configuration")
+	RocketCmd.Flags().StringVarP(&environment, "env", "e", "", "Use the specified environment section of the configuration file")
+	RocketCmd.Flags().StringVarP(&rocketConfigPath, "config", "c", "", "Use the specified configuration file (and set it's directory as the working directory), - to read it from stdin")
 }
 
 // RocketCmd is the rocket's root command. It's used to actually deploy
@@ -39,7 +43,7 @@ var RocketCmd = &cobra.Command{
 		}
 
 		// change working directory as the file's
-		if rocketConfigPath != "" {
+		if rocketConfigPath != "" && rocketConfigPath != config.StdinFileName {
 			dir := filepath.Dir(rocketConfigPath)
 			err = os.Chdir(dir)
 			if err != nil {
@@ -48,89 +52,59 @@ var RocketCmd = &cobra.Command{
 			rocketConfigPath = filepath.Base(rocketConfigPath)
 		}
 
-		conf, err := config.Get(rocketConfigPath)
+		conf, err := config.GetForEnvironment(rocketConfigPath, environment)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
 
-		log.With("configuration", conf).Debug("")
-		log.With("env", os.Environ()).Debug("")
-
-		// script
-		if conf.Script != nil {
-			log.Debug("script: starting provider")
-			err = script.Deploy(conf.Script)
-			if err != nil {
-				log.Fatal(fmt.Sprintf("script: %v", err))
-			}
-		} else {
-			log.Debug("script: provider is empty")
+		// the --debug flag takes precedence over the log_level of the configuration
+		if debug {
+			log.Config(astroflow.SetLevel(astroflow.DebugLevel))
 		}
 
-		// heroku
-		if conf.Heroku != nil {
-			log.Debug("heroku: starting provider")
-			err = heroku.Deploy(*conf.Heroku)
-			if err != nil {
-				log.Fatal(fmt.Sprintf("heroku: %v", err))
-			}
-		} else {
-			log.Debug("heroku: provider is empty")
+		if dryRun {
+			conf.DryRun = true
 		}
 
-		// github_releases
-		if conf.GitHubReleases != nil {
-			log.Debug("github_releases: starting provider")
-			err = ghreleases.Deploy(*conf.GitHubReleases)
-			if err != nil {
-				log.Fatal(fmt.Sprintf("github_releases: %v", err))
+		// the selected providers are validated again, as the flags override the configuration
+		if len(only) != 0 || len(skip) != 0 {
+			if len(only) != 0 {
+				conf.Only = only
 			}
-		} else {
-			log.Debug("github_releases: provider is empty")
-		}
-
-		// docker
-		if conf.Docker != nil {
-			log.Debug("docker: starting provider")
-			err = docker.Deploy(*conf.Docker)
-			if err != nil {
-				log.Fatal(fmt.Sprintf("docker: %v", err))
+			if len(skip) != 0 {
+				conf.Skip = skip
+			}
+			if err = conf.Validate(); err != nil {
+				log.Fatal(err.Error())
 			}
-		} else {
-			log.Debug("docker: provider is empty")
 		}
 
-		// aws_s3
-		if conf.AWSS3 != nil {
-			log.Debug("aws_s3: starting provider")
-			err = awss3.Deploy(*conf.AWSS3)
-			if err != nil {
-				log.Fatal(fmt.Sprintf("aws_s3: %v", err))
-			}
-		} else {
-			log.Debug("aws_s3: provider is empty")
+		log.With("configuration", conf.String()).Debug("")
+		log.With("env", os.Environ()).Debug("")
+
+		if jsonOutput {
+			conf.JSONOutput = true
 		}
 
-		// zeit_now
-		if conf.ZeitNow != nil {
-			log.Debug("zeit_now: starting provider")
-			err = zeitnow.Deploy(*conf.ZeitNow)
+		if !conf.JSONOutput {
+			err = providers.Deploy(conf)
 			if err != nil {
-				log.Fatal(fmt.Sprintf("zeit_now: %v", err))
+				log.Fatal(err.Error())
 			}
-		} else {
-			log.Debug("zeit_now: provider is empty")
+			return
 		}
 
-		// aws_eb
-		if conf.AWSEB != nil {
-			log.Debug("aws_eb: starting provider")
-			err = awseb.Deploy(*conf.AWSEB)
-			if err != nil {
-				log.Fatal(fmt.Sprintf("aws_eb: %v", err))
-			}
-		} else {
-			log.Debug("aws_eb: provider is empty")
+		// stdout only contains the report: the logs and the output of the hooks and providers go to stderr
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		log.Config(astroflow.SetWriter(os.Stderr))
+		report, err := providers.DeployWithReport(conf)
+		os.Stdout = stdout
+		if encodeErr := json.NewEncoder(stdout).Encode(report); encodeErr != nil {
+			log.Fatal(encodeErr.Error())
+		}
+		if err != nil {
+			os.Exit(1)
 		}
 	},
 }
@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bloom42/astroflow-go"
+	"github.com/bloom42/astroflow-go/log"
+	"github.com/bloom42/rocket/config"
+	"github.com/spf13/cobra"
+)
+
+var validateConfigPath string
+
+func init() {
+	RocketCmd.AddCommand(ValidateCmd)
+	ValidateCmd.Flags().StringVarP(&validateConfigPath, "config", "c", "", "Use the specified configuration file, - to read it from stdin")
+}
+
+// ValidateCmd is the rocket's `validate` command. It checks the configuration file without deploying
+var ValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration file without deploying",
+	Long:  "Check the configuration file without deploying. Each problem is displayed on its own line",
+	Run: func(cmd *cobra.Command, args []string) {
+		if debug {
+			log.Config(astroflow.SetLevel(astroflow.DebugLevel))
+		}
+
+		_, err := config.LoadAndValidate(validateConfigPath)
+		if validationErr, ok := err.(*config.ValidationError); ok {
+			for _, fieldErr := range validationErr.Errors {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", fieldErr.Field, fieldErr.Message)
+			}
+			os.Exit(1)
+		} else if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		fmt.Println("configuration is valid")
+	},
+}
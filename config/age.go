@@ -0,0 +1,124 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ageCache holds the files already decrypted during this run, by path
+var ageCache = struct {
+	sync.Mutex
+	files map[string]string
+}{files: map[string]string{}}
+
+// resolveAge decrypts the file referenced by an age://<path>#<key> URI with the age CLI, using the
+// identity of $ROCKET_AGE_KEY: a private key (AGE-SECRET-KEY-1...) or the path of an identity file.
+// The decrypted file holds KEY=VALUE lines, like an env file, and key selects the value. Without #key,
+// the whole decrypted file is returned
+func resolveAge(uri string) (string, error) {
+	ref := strings.TrimPrefix(uri, "age://")
+	parts := strings.SplitN(ref, "#", 2)
+	path := parts[0]
+	if path == "" || (len(parts) == 2 && parts[1] == "") {
+		return "", fmt.Errorf("age: %s should be of the form age://<path>#<key>", uri)
+	}
+
+	data, err := decryptAge(path)
+	if err != nil {
+		return "", err
+	}
+	if len(parts) == 1 {
+		return strings.TrimSpace(data), nil
+	}
+
+	key := parts[1]
+	values, err := envFileValues(data)
+	if err != nil {
+		return "", fmt.Errorf("age: %s: %s", path, err.Error())
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("age: key %s not found in %s", key, path)
+	}
+	return value, nil
+}
+
+// decryptAge returns the decrypted content of the file, decrypting it only once per run
+func decryptAge(path string) (string, error) {
+	ageCache.Lock()
+	defer ageCache.Unlock()
+	if data, ok := ageCache.files[path]; ok {
+		return data, nil
+	}
+
+	identity := os.Getenv("ROCKET_AGE_KEY")
+	if identity == "" {
+		return "", fmt.Errorf("age: ROCKET_AGE_KEY is required to decrypt %s", path)
+	}
+
+	// a private key is passed to age through a pipe, so it's never written to disk
+	identityFile := identity
+	var extraFiles []*os.File
+	if strings.HasPrefix(strings.TrimSpace(identity), "AGE-SECRET-KEY-") {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		go func() {
+			w.WriteString(strings.TrimSpace(identity) + "\n")
+			w.Close()
+		}()
+		// the first extra file is the file descriptor 3 of the command
+		identityFile = "/dev/fd/3"
+		extraFiles = []*os.File{r}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("age", "--decrypt", "--identity", identityFile, path)
+	cmd.ExtraFiles = extraFiles
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return "", fmt.Errorf("age: decrypting %s: %s", path, message)
+	}
+
+	data := stdout.String()
+	ageCache.files[path] = data
+	return data, nil
+}
+
+// envFileValues parses the KEY=VALUE lines of data, like an env file, without expanding the values
+func envFileValues(data string) (map[string]string, error) {
+	ret := map[string]string{}
+	lineNumber := 0
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNumber)
+		}
+		value := strings.TrimSpace(parts[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		ret[strings.TrimSpace(parts[0])] = value
+	}
+	return ret, scanner.Err()
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveAgePrivateKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rocket_age_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the fake age CLI "decrypts" any file to the identity it was given
+	script := "#!/bin/sh\nread -r identity < \"$3\"\necho \"IDENTITY=$identity\"\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "age"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := filepath.Join(dir, "tmp")
+	if err = os.Mkdir(tmpDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]string{"PATH": dir, "TMPDIR": tmpDir, "ROCKET_AGE_KEY": "AGE-SECRET-KEY-1TEST"} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Setenv(key, value)
+	}
+
+	value, err := resolveAge("age://" + filepath.Join(dir, "secrets.env.age") + "#IDENTITY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "AGE-SECRET-KEY-1TEST" {
+		t.Errorf("resolveAge() = %q, expected the identity %q", value, "AGE-SECRET-KEY-1TEST")
+	}
+
+	// the identity is not written to disk
+	entries, err := ioutil.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("temporary files were created: %v", entries)
+	}
+}
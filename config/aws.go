@@ -0,0 +1,72 @@
+package config
+
+import (
+	"strings"
+)
+
+// AWSRegions are the known AWS regions
+var AWSRegions = []string{
+	"af-south-1",
+	"ap-east-1",
+	"ap-east-2",
+	"ap-northeast-1",
+	"ap-northeast-2",
+	"ap-northeast-3",
+	"ap-south-1",
+	"ap-south-2",
+	"ap-southeast-1",
+	"ap-southeast-2",
+	"ap-southeast-3",
+	"ap-southeast-4",
+	"ap-southeast-5",
+	"ap-southeast-6",
+	"ap-southeast-7",
+	"ca-central-1",
+	"ca-west-1",
+	"cn-north-1",
+	"cn-northwest-1",
+	"eu-central-1",
+	"eu-central-2",
+	"eu-north-1",
+	"eu-south-1",
+	"eu-south-2",
+	"eu-west-1",
+	"eu-west-2",
+	"eu-west-3",
+	"il-central-1",
+	"me-central-1",
+	"me-south-1",
+	"mx-central-1",
+	"sa-east-1",
+	"us-east-1",
+	"us-east-2",
+	"us-gov-east-1",
+	"us-gov-west-1",
+	"us-west-1",
+	"us-west-2",
+}
+
+// AWSRegion returns the normalized (trimmed and lower-cased) expanded region, or if it's nil the
+// AWS_REGION or AWS_DEFAULT_REGION env variable. The variables are looked up by getenv
+func AWSRegion(region *string, getenv func(string) string) string {
+	var v string
+	if region == nil {
+		v = getenv("AWS_REGION")
+		if v == "" {
+			v = getenv("AWS_DEFAULT_REGION")
+		}
+	} else {
+		v = Expand(*region, getenv)
+	}
+	return strings.ToLower(strings.TrimSpace(v))
+}
+
+// isAWSRegion returns true if region is a known AWS region
+func isAWSRegion(region string) bool {
+	for _, r := range AWSRegions {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
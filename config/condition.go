@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// condition is a parsed `when` expression, evaluated against the current environment
+type condition func() bool
+
+type token struct {
+	operator string // "==", "!=", "&&" or "||", empty for operands
+	value    string
+	literal  bool // single quoted operands are not expanded
+}
+
+// EvalCondition evaluates a `when` expression: comparisons of operands with == and !=, combined with
+// && and || (&& taking precedence). Operands are bare words or quoted strings, where environment
+// variables are expanded (except in single quoted strings). An operand alone is true if it's not empty.
+// e.g: $ROCKET_BRANCH == master && $ROCKET_LAST_TAG != ""
+func EvalCondition(expr string) (bool, error) {
+	cond, err := parseCondition(expr)
+	if err != nil {
+		return false, err
+	}
+	return cond(), nil
+}
+
+func parseCondition(expr string) (condition, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("when: empty expression")
+	}
+
+	p := &conditionParser{tokens: tokens}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("when: unexpected %s in %q", p.tokens[p.pos].String(), expr)
+	}
+	return cond, nil
+}
+
+func (t token) String() string {
+	if t.operator != "" {
+		return t.operator
+	}
+	return fmt.Sprintf("%q", t.value)
+}
+
+func (t token) eval() string {
+	if t.literal {
+		return t.value
+	}
+	return ExpandEnv(t.value)
+}
+
+func tokenize(expr string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case isOperatorStart(expr[i:]):
+			tokens = append(tokens, token{operator: expr[i : i+2]})
+			i += 2
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end == -1 {
+				return nil, fmt.Errorf("when: unterminated string in %q", expr)
+			}
+			tokens = append(tokens, token{value: expr[i+1 : i+1+end], literal: c == '\''})
+			i += end + 2
+		default:
+			start := i
+			for i < len(expr) && expr[i] != ' ' && expr[i] != '\t' && !isOperatorStart(expr[i:]) {
+				i++
+			}
+			tokens = append(tokens, token{value: expr[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+func isOperatorStart(s string) bool {
+	return strings.HasPrefix(s, "==") || strings.HasPrefix(s, "!=") ||
+		strings.HasPrefix(s, "&&") || strings.HasPrefix(s, "||")
+}
+
+type conditionParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *conditionParser) next(operator string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].operator == operator {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *conditionParser) parseOr() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.next("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func() bool { return l() || right() }
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseAnd() (condition, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.next("&&") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func() bool { return l() && right() }
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseComparison() (condition, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.next("=="):
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return func() bool { return left.eval() == right.eval() }, nil
+	case p.next("!="):
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return func() bool { return left.eval() != right.eval() }, nil
+	}
+
+	return func() bool { return left.eval() != "" }, nil
+}
+
+func (p *conditionParser) parseOperand() (token, error) {
+	if p.pos >= len(p.tokens) {
+		return token{}, fmt.Errorf("when: missing operand at the end of the expression")
+	}
+	t := p.tokens[p.pos]
+	if t.operator != "" {
+		return token{}, fmt.Errorf("when: unexpected %s, an operand was expected", t.operator)
+	}
+	p.pos++
+	return t, nil
+}
@@ -1,37 +1,204 @@
 package config
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/bloom42/astroflow-go"
 	"github.com/bloom42/astroflow-go/log"
 	"github.com/bloom42/san-go"
+	"gopkg.in/yaml.v2"
 )
 
 // DefaultConfigurationFileName is the default configuration file name, without extension
 const DefaultConfigurationFileName = ".rocket.san"
 
+// ConfigurationFileNames are the configuration file names looked up, in order, when no file is given
+var ConfigurationFileNames = []string{
+	DefaultConfigurationFileName,
+	".rocket.yml",
+	".rocket.yaml",
+	".rocket.json",
+}
+
 var PredefinedEnv = []string{
 	"ROCKET_COMMIT_HASH",
+	"ROCKET_COMMIT_SHORT",
+	"ROCKET_COMMIT_AUTHOR",
+	"ROCKET_COMMIT_MESSAGE",
+	"ROCKET_BRANCH",
 	"ROCKET_LAST_TAG",
 	"ROCKET_GIT_REPO",
 }
 
 type Config struct {
-	Description string            `json:"description" san:"description"`
-	Env         map[string]string `json:"env" san:"env"`
+	Description string `json:"description" san:"description" yaml:"description"`
+	// Include are configuration files merged into this one, which takes precedence
+	Include     []string          `json:"include" san:"include" yaml:"include"`
+	Env         map[string]string `json:"env" san:"env" yaml:"env"`
+	EnvFile     *string           `json:"env_file" san:"env_file" yaml:"env_file"`
+	RequiredEnv []string          `json:"required_env" san:"required_env" yaml:"required_env"`
+	Concurrency *int              `json:"concurrency" san:"concurrency" yaml:"concurrency"`
+	DryRun      bool              `json:"dry_run" san:"dry_run" yaml:"dry_run"`
+	// JSONOutput writes the report of the deployment as JSON to stdout, the logs and the output of the
+	// providers going to stderr
+	JSONOutput bool `json:"json_output" san:"json_output" yaml:"json_output"`
+	// Order lists the providers which run first, one after the other, e.g: ["docker", "kubernetes"]
+	Order []string `json:"order" san:"order" yaml:"order"`
+	// Only restricts the providers which run to the listed ones, and Skip removes the listed ones.
+	// A provider with several instances is selected by its name (e.g. aws_s3) or by instance (e.g. aws_s3[1])
+	Only []string `json:"only" san:"only" yaml:"only"`
+	Skip []string `json:"skip" san:"skip" yaml:"skip"`
+	// LogLevel is the minimum level of the displayed logs: debug, info, warn or error
+	LogLevel *string `json:"log_level" san:"log_level" yaml:"log_level"`
+	// WorkingDirectory is the directory the hooks and providers are executed in
+	WorkingDirectory *string `json:"working_directory" san:"working_directory" yaml:"working_directory"`
+	// BeforeHooks are executed before the providers, AfterHooks after all the providers succeeded
+	BeforeHooks []string `json:"before" san:"before" yaml:"before"`
+	AfterHooks  []string `json:"after" san:"after" yaml:"after"`
+	// Retries is the number of times a provider is retried after a network or server error
+	Retries      *int    `json:"retries" san:"retries" yaml:"retries"`
+	RetryBackoff *string `json:"retry_backoff" san:"retry_backoff" yaml:"retry_backoff"`
+	// Proxy is the URL of the proxy of the HTTP requests, overriding HTTP_PROXY and HTTPS_PROXY
+	Proxy *string `json:"proxy" san:"proxy" yaml:"proxy"`
+
+	// HealthCheck verifies that the deployment is up once all the providers succeeded
+	HealthCheck *HealthCheckConfig `json:"health_check" san:"health_check" yaml:"health_check"`
+
+	// GitHubDeployment creates a GitHub deployment before the providers run, and sets its status
+	// from the result of the deployment
+	GitHubDeployment *GitHubDeploymentConfig `json:"github_deployment" san:"github_deployment" yaml:"github_deployment"`
+
+	// Notify are the notifications sent when the deployment finishes
+	Notify *NotifyConfig `json:"notify" san:"notify" yaml:"notify"`
+
+	// Environments are named configurations which override the base one
+	Environments map[string]Config `json:"environments,omitempty" san:"environments,omitempty" yaml:"environments,omitempty"`
+
+	// Instances are the additional instances of the providers written as arrays (e.g. [[aws_s3]]),
+	// each one holding at most one instance of each provider
+	Instances []Config `json:"-" san:"-" yaml:"-"`
 
 	// providers
-	Script         ScriptConfig          `json:"script,omitempty" san:"script,omitempty"`
-	Heroku         *HerokuConfig         `json:"heroku,omitempty" san:"heroku,omitempty"`
-	GitHubReleases *GitHubReleasesConfig `json:"github_releases,omitempty" san:"github_releases,omitempty"`
-	Docker         *DockerConfig         `json:"docker" san:"docker"`
-	AWSS3          *AWSS3Config          `json:"aws_s3" san:"aws_s3"`
-	ZeitNow        *ZeitNowConfig        `json:"zeit_now" san:"zeit_now"`
-	AWSEB          *AWSEBConfig          `json:"aws_eb" san:"aws_eb"`
+	Script         ScriptConfig          `json:"script,omitempty" san:"script,omitempty" yaml:"script,omitempty"`
+	Heroku         *HerokuConfig         `json:"heroku,omitempty" san:"heroku,omitempty" yaml:"heroku,omitempty"`
+	GitHubReleases *GitHubReleasesConfig `json:"github_releases,omitempty" san:"github_releases,omitempty" yaml:"github_releases,omitempty"`
+	Docker         *DockerConfig         `json:"docker" san:"docker" yaml:"docker"`
+	AWSS3          *AWSS3Config          `json:"aws_s3" san:"aws_s3" yaml:"aws_s3"`
+	ZeitNow        *ZeitNowConfig        `json:"zeit_now" san:"zeit_now" yaml:"zeit_now"`
+	AWSEB          *AWSEBConfig          `json:"aws_eb" san:"aws_eb" yaml:"aws_eb"`
+	GCS            *GCSConfig            `json:"gcs" san:"gcs" yaml:"gcs"`
+	GitLabReleases *GitLabReleasesConfig `json:"gitlab_releases" san:"gitlab_releases" yaml:"gitlab_releases"`
+	AzureBlob      *AzureBlobConfig      `json:"azure_blob" san:"azure_blob" yaml:"azure_blob"`
+	Cloudflare     *CloudflareConfig     `json:"cloudflare" san:"cloudflare" yaml:"cloudflare"`
+	FTP            *FTPConfig            `json:"ftp" san:"ftp" yaml:"ftp"`
+	SSH            *SSHConfig            `json:"ssh" san:"ssh" yaml:"ssh"`
+	Netlify        *NetlifyConfig        `json:"netlify" san:"netlify" yaml:"netlify"`
+	PyPI           *PyPIConfig           `json:"pypi" san:"pypi" yaml:"pypi"`
+	NPM            *NPMConfig            `json:"npm" san:"npm" yaml:"npm"`
+	Vercel         *VercelConfig         `json:"vercel" san:"vercel" yaml:"vercel"`
+	Firebase       *FirebaseConfig       `json:"firebase" san:"firebase" yaml:"firebase"`
+	HTTP           *HTTPConfig           `json:"http" san:"http" yaml:"http"`
+	Fly            *FlyConfig            `json:"fly" san:"fly" yaml:"fly"`
+	Kubernetes     *KubernetesConfig     `json:"kubernetes" san:"kubernetes" yaml:"kubernetes"`
+	Maven          *MavenConfig          `json:"maven" san:"maven" yaml:"maven"`
+	Cargo          *CargoConfig          `json:"cargo" san:"cargo" yaml:"cargo"`
+	Render         *RenderConfig         `json:"render" san:"render" yaml:"render"`
+	ExecPlugin     *ExecPluginConfig     `json:"exec_plugin" san:"exec_plugin" yaml:"exec_plugin"`
+	Ansible        *AnsibleConfig        `json:"ansible" san:"ansible" yaml:"ansible"`
+	Sentry         *SentryConfig         `json:"sentry" san:"sentry" yaml:"sentry"`
+	GitHubPages    *GitHubPagesConfig    `json:"github_pages" san:"github_pages" yaml:"github_pages"`
+}
+
+// HealthCheckConfig is the configuration of the health check of the deployment
+type HealthCheckConfig struct {
+	URL          *string `json:"url" san:"url" yaml:"url"`
+	ExpectStatus *int    `json:"expect_status" san:"expect_status" yaml:"expect_status"`
+	// Timeout is the timeout of each request
+	Timeout  *string `json:"timeout" san:"timeout" yaml:"timeout"`
+	Retries  *int    `json:"retries" san:"retries" yaml:"retries"`
+	Interval *string `json:"interval" san:"interval" yaml:"interval"`
+}
+
+// GitHubDeploymentConfig is the configuration of the GitHub deployment tracking the deployment
+type GitHubDeploymentConfig struct {
+	Repo         *string `json:"repo" san:"repo" yaml:"repo"`
+	APIKey       *string `json:"api_key" san:"api_key" yaml:"api_key"`
+	Environment  *string `json:"environment" san:"environment" yaml:"environment"`
+	Ref          *string `json:"ref" san:"ref" yaml:"ref"`
+	AutoInactive *bool   `json:"auto_inactive" san:"auto_inactive" yaml:"auto_inactive"`
+}
+
+// NotifyConfig is the configuration of the notifications sent when the deployment finishes
+type NotifyConfig struct {
+	Slack    *NotifySlack    `json:"slack" san:"slack" yaml:"slack"`
+	Discord  *NotifyDiscord  `json:"discord" san:"discord" yaml:"discord"`
+	Email    *NotifyEmail    `json:"email" san:"email" yaml:"email"`
+	Telegram *NotifyTelegram `json:"telegram" san:"telegram" yaml:"telegram"`
+	Datadog  *NotifyDatadog  `json:"datadog" san:"datadog" yaml:"datadog"`
+}
+
+// NotifySlack is the configuration of the Slack notification
+type NotifySlack struct {
+	WebhookURL     *string `json:"webhook_url" san:"webhook_url" yaml:"webhook_url"`
+	Channel        *string `json:"channel" san:"channel" yaml:"channel"`
+	SuccessMessage *string `json:"success_message" san:"success_message" yaml:"success_message"`
+	FailureMessage *string `json:"failure_message" san:"failure_message" yaml:"failure_message"`
+}
+
+// NotifyDiscord is the configuration of the Discord notification
+type NotifyDiscord struct {
+	WebhookURL     *string `json:"webhook_url" san:"webhook_url" yaml:"webhook_url"`
+	Username       *string `json:"username" san:"username" yaml:"username"`
+	SuccessMessage *string `json:"success_message" san:"success_message" yaml:"success_message"`
+	FailureMessage *string `json:"failure_message" san:"failure_message" yaml:"failure_message"`
+}
+
+// NotifyEmail is the configuration of the email notification
+type NotifyEmail struct {
+	SMTPHost       *string  `json:"smtp_host" san:"smtp_host" yaml:"smtp_host"`
+	Port           *int     `json:"port" san:"port" yaml:"port"`
+	Username       *string  `json:"username" san:"username" yaml:"username"`
+	Password       *string  `json:"password" san:"password" yaml:"password"`
+	From           *string  `json:"from" san:"from" yaml:"from"`
+	To             []string `json:"to" san:"to" yaml:"to"`
+	SuccessSubject *string  `json:"success_subject" san:"success_subject" yaml:"success_subject"`
+	FailureSubject *string  `json:"failure_subject" san:"failure_subject" yaml:"failure_subject"`
+	Body           *string  `json:"body" san:"body" yaml:"body"`
+}
+
+// NotifyTelegram is the configuration of the Telegram notification
+type NotifyTelegram struct {
+	BotToken       *string `json:"bot_token" san:"bot_token" yaml:"bot_token"`
+	ChatID         *string `json:"chat_id" san:"chat_id" yaml:"chat_id"`
+	SuccessMessage *string `json:"success_message" san:"success_message" yaml:"success_message"`
+	FailureMessage *string `json:"failure_message" san:"failure_message" yaml:"failure_message"`
+}
+
+// NotifyDatadog is the configuration of the Datadog event
+type NotifyDatadog struct {
+	APIKey *string  `json:"api_key" san:"api_key" yaml:"api_key"`
+	Site   *string  `json:"site" san:"site" yaml:"site"`
+	Tags   []string `json:"tags" san:"tags" yaml:"tags"`
+	Title  *string  `json:"title" san:"title" yaml:"title"`
+	Text   *string  `json:"text" san:"text" yaml:"text"`
+}
+
+// FileRule sets the headers of the uploaded files matching a glob pattern
+type FileRule struct {
+	// Match is matched against the path of the file relative to the local directory and against its base name
+	Match        string `json:"match" san:"match" yaml:"match"`
+	CacheControl string `json:"cache_control" san:"cache_control" yaml:"cache_control"`
+	ContentType  string `json:"content_type" san:"content_type" yaml:"content_type"`
 }
 
 // ScriptConfig is the configuration for the script provider
@@ -39,87 +206,558 @@ type ScriptConfig []string
 
 // HerokuConfig is the configuration for the `heroku` provider
 type HerokuConfig struct {
-	APIKey    *string `json:"api_key" san:"api_key"`
-	App       *string `json:"app" san:"app"`
-	Directory *string `json:"directory" san:"directory"`
-	Version   *string `json:"version" san:"version"`
+	APIKey       *string           `json:"api_key" san:"api_key" yaml:"api_key"`
+	App          *string           `json:"app" san:"app" yaml:"app"`
+	Directory    *string           `json:"directory" san:"directory" yaml:"directory"`
+	Version      *string           `json:"version" san:"version" yaml:"version"`
+	Rollback     *bool             `json:"rollback" san:"rollback" yaml:"rollback"`
+	RollbackTo   *string           `json:"rollback_to" san:"rollback_to" yaml:"rollback_to"`
+	Container    *bool             `json:"container" san:"container" yaml:"container"`
+	ProcessTypes []string          `json:"process_types" san:"process_types" yaml:"process_types"`
+	Image        *string           `json:"image" san:"image" yaml:"image"`
+	Timeout      *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env          map[string]string `json:"env" san:"env" yaml:"env"`
+	When         *string           `json:"when" san:"when" yaml:"when"`
 }
 
 // GitHubReleasesConfig is the configuration for the `github_releases` provider
 type GitHubReleasesConfig struct {
-	Name       *string  `json:"name" san:"name"`
-	Body       *string  `json:"body" san:"body"`
-	Prerelease *bool    `json:"prerelease" san:"prerelease"`
-	Repo       *string  `json:"repo" san:"repo"`
-	APIKey     *string  `json:"api_key" san:"api_key"`
-	Assets     []string `json:"assets" san:"assets"`
-	Tag        *string  `json:"tag" san:"tag"`
-	BaseURL    *string  `json:"base_url" san:"base_url"`
-	UploadURL  *string  `json:"upload_url" san:"upload_url"`
+	Name             *string           `json:"name" san:"name" yaml:"name"`
+	Body             *string           `json:"body" san:"body" yaml:"body"`
+	BodyFile         *string           `json:"body_file" san:"body_file" yaml:"body_file"`
+	Prerelease       *bool             `json:"prerelease" san:"prerelease" yaml:"prerelease"`
+	Repo             *string           `json:"repo" san:"repo" yaml:"repo"`
+	APIKey           *string           `json:"api_key" san:"api_key" yaml:"api_key"`
+	Assets           []string          `json:"assets" san:"assets" yaml:"assets"`
+	Tag              *string           `json:"tag" san:"tag" yaml:"tag"`
+	BaseURL          *string           `json:"base_url" san:"base_url" yaml:"base_url"`
+	UploadURL        *string           `json:"upload_url" san:"upload_url" yaml:"upload_url"`
+	Sign             *bool             `json:"sign" san:"sign" yaml:"sign"`
+	GPGKey           *string           `json:"gpg_key" san:"gpg_key" yaml:"gpg_key"`
+	Checksums        *string           `json:"checksums" san:"checksums" yaml:"checksums"`
+	Overwrite        *bool             `json:"overwrite" san:"overwrite" yaml:"overwrite"`
+	RateLimitRetries *int              `json:"rate_limit_retries" san:"rate_limit_retries" yaml:"rate_limit_retries"`
+	Timeout          *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env              map[string]string `json:"env" san:"env" yaml:"env"`
+	When             *string           `json:"when" san:"when" yaml:"when"`
 }
 
 // DockerConfig is the configuration for the docker provider
 type DockerConfig struct {
-	Username *string  `json:"username" san:"username"`
-	Password *string  `josn:"password" san:"password"`
-	Login    *bool    `json:"login" san:"login"`
-	Images   []string `json:"images" san:"images"`
+	Username     *string           `json:"username" san:"username" yaml:"username"`
+	Password     *string           `json:"password" san:"password" yaml:"password"`
+	Login        *bool             `json:"login" san:"login" yaml:"login"`
+	RegistryType *string           `json:"registry_type" san:"registry_type" yaml:"registry_type"`
+	Images       []string          `json:"images" san:"images" yaml:"images"`
+	ExtraTags    []string          `json:"extra_tags" san:"extra_tags" yaml:"extra_tags"`
+	Buildx       *bool             `json:"buildx" san:"buildx" yaml:"buildx"`
+	Platforms    []string          `json:"platforms" san:"platforms" yaml:"platforms"`
+	Build        *bool             `json:"build" san:"build" yaml:"build"`
+	Dockerfile   *string           `json:"dockerfile" san:"dockerfile" yaml:"dockerfile"`
+	Context      *string           `json:"context" san:"context" yaml:"context"`
+	BuildArgs    map[string]string `json:"build_args" san:"build_args" yaml:"build_args"`
+	Timeout      *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env          map[string]string `json:"env" san:"env" yaml:"env"`
+	When         *string           `json:"when" san:"when" yaml:"when"`
 }
 
 // AWSS3Config is the configuration for the aws_s3 provider
 type AWSS3Config struct {
-	AccessKeyID     *string `json:"access_key_id" san:"access_key_id"`
-	SecretAccessKey *string `json:"secret_access_key" san:"secret_access_key"`
-	Region          *string `json:"region" san:"region"`
-	Bucket          *string `json:"bucket" san:"bucket"`
-	LocalDirectory  *string `json:"local_directory" san:"local_directory"`
-	RemoteDirectory *string `json:"remote_directory" san:"remote_directory"`
+	AccessKeyID              *string           `json:"access_key_id" san:"access_key_id" yaml:"access_key_id"`
+	SecretAccessKey          *string           `json:"secret_access_key" san:"secret_access_key" yaml:"secret_access_key"`
+	Profile                  *string           `json:"profile" san:"profile" yaml:"profile"`
+	RoleARN                  *string           `json:"role_arn" san:"role_arn" yaml:"role_arn"`
+	ExternalID               *string           `json:"external_id" san:"external_id" yaml:"external_id"`
+	Region                   *string           `json:"region" san:"region" yaml:"region"`
+	Bucket                   *string           `json:"bucket" san:"bucket" yaml:"bucket"`
+	LocalDirectory           *string           `json:"local_directory" san:"local_directory" yaml:"local_directory"`
+	RemoteDirectory          *string           `json:"remote_directory" san:"remote_directory" yaml:"remote_directory"`
+	Endpoint                 *string           `json:"endpoint" san:"endpoint" yaml:"endpoint"`
+	ForcePathStyle           *bool             `json:"force_path_style" san:"force_path_style" yaml:"force_path_style"`
+	GzipExtensions           []string          `json:"gzip_extensions" san:"gzip_extensions" yaml:"gzip_extensions"`
+	CacheControl             *string           `json:"cache_control" san:"cache_control" yaml:"cache_control"`
+	ACL                      *string           `json:"acl" san:"acl" yaml:"acl"`
+	ServerSideEncryption     *string           `json:"server_side_encryption" san:"server_side_encryption" yaml:"server_side_encryption"`
+	KMSKeyID                 *string           `json:"kms_key_id" san:"kms_key_id" yaml:"kms_key_id"`
+	SkipUnchanged            *bool             `json:"skip_unchanged" san:"skip_unchanged" yaml:"skip_unchanged"`
+	Resume                   *bool             `json:"resume" san:"resume" yaml:"resume"`
+	Delete                   *bool             `json:"delete" san:"delete" yaml:"delete"`
+	UploadConcurrency        *int              `json:"upload_concurrency" san:"upload_concurrency" yaml:"upload_concurrency"`
+	PartSize                 *string           `json:"part_size" san:"part_size" yaml:"part_size"`
+	MultipartThreshold       *string           `json:"multipart_threshold" san:"multipart_threshold" yaml:"multipart_threshold"`
+	CloudFrontDistributionID *string           `json:"cloudfront_distribution_id" san:"cloudfront_distribution_id" yaml:"cloudfront_distribution_id"`
+	InvalidationPaths        []string          `json:"invalidation_paths" san:"invalidation_paths" yaml:"invalidation_paths"`
+	WaitForInvalidation      *bool             `json:"wait_for_invalidation" san:"wait_for_invalidation" yaml:"wait_for_invalidation"`
+	ContentTypes             map[string]string `json:"content_types" san:"content_types" yaml:"content_types"`
+	Rules                    []FileRule        `json:"rules" san:"rules" yaml:"rules"`
+	Include                  []string          `json:"include" san:"include" yaml:"include"`
+	Exclude                  []string          `json:"exclude" san:"exclude" yaml:"exclude"`
+	Timeout                  *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env                      map[string]string `json:"env" san:"env" yaml:"env"`
+	When                     *string           `json:"when" san:"when" yaml:"when"`
 }
 
 // ZeitNowConfig is the configuration for the `zeit_now` provider
 type ZeitNowConfig struct {
-	Token           *string           `json:"token" san:"token"`
-	Directory       *string           `json:"directory" san:"directory"`
-	Env             map[string]string `json:"env" san:"env"`
-	Public          *bool             `json:"public" san:"public"`
-	DeploymentType  *string           `json:"deployment_type" san:"deployment_type"`
-	Name            *string           `json:"name" san:"name"`
-	ForceNew        *bool             `json:"force_new" san:"force_new"`
-	Engines         map[string]string `json:"engines" san:"engines"`
-	SessionAffinity *string           `json:"session_affinity" san:"session_affinity"`
+	Token           *string           `json:"token" san:"token" yaml:"token"`
+	Directory       *string           `json:"directory" san:"directory" yaml:"directory"`
+	Timeout         *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env             map[string]string `json:"env" san:"env" yaml:"env"`
+	Public          *bool             `json:"public" san:"public" yaml:"public"`
+	DeploymentType  *string           `json:"deployment_type" san:"deployment_type" yaml:"deployment_type"`
+	Name            *string           `json:"name" san:"name" yaml:"name"`
+	ForceNew        *bool             `json:"force_new" san:"force_new" yaml:"force_new"`
+	Engines         map[string]string `json:"engines" san:"engines" yaml:"engines"`
+	SessionAffinity *string           `json:"session_affinity" san:"session_affinity" yaml:"session_affinity"`
+	Alias           []string          `json:"alias" san:"alias" yaml:"alias"`
+	When            *string           `json:"when" san:"when" yaml:"when"`
 }
 
 // AWSEBConfig is the configuration for the `aws_eb` provider
 type AWSEBConfig struct {
-	AccessKeyID     *string `json:"access_key_id" san:"access_key_id"`
-	SecretAccessKey *string `json:"secret_access_key" san:"secret_access_key"`
-	Region          *string `json:"region" san:"region"`
-	Application     *string `json:"application" san:"application"`
-	Environment     *string `json:"environment" san:"environment"`
-	S3Bucket        *string `json:"s3_bucket" san:"s3_bucket"`
-	Version         *string `json:"version" san:"version"`
-	Directory       *string `json:"directory" san:"directory"`
-	S3Key           *string `json:"s3_key" san:"s3_key"`
+	AccessKeyID     *string           `json:"access_key_id" san:"access_key_id" yaml:"access_key_id"`
+	SecretAccessKey *string           `json:"secret_access_key" san:"secret_access_key" yaml:"secret_access_key"`
+	Profile         *string           `json:"profile" san:"profile" yaml:"profile"`
+	RoleARN         *string           `json:"role_arn" san:"role_arn" yaml:"role_arn"`
+	ExternalID      *string           `json:"external_id" san:"external_id" yaml:"external_id"`
+	Region          *string           `json:"region" san:"region" yaml:"region"`
+	Application     *string           `json:"application" san:"application" yaml:"application"`
+	Environment     *string           `json:"environment" san:"environment" yaml:"environment"`
+	S3Bucket        *string           `json:"s3_bucket" san:"s3_bucket" yaml:"s3_bucket"`
+	Version         *string           `json:"version" san:"version" yaml:"version"`
+	Directory       *string           `json:"directory" san:"directory" yaml:"directory"`
+	S3Key           *string           `json:"s3_key" san:"s3_key" yaml:"s3_key"`
+	WaitTimeout     *string           `json:"wait_timeout" san:"wait_timeout" yaml:"wait_timeout"`
+	Timeout         *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env             map[string]string `json:"env" san:"env" yaml:"env"`
+	When            *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// GCSConfig is the configuration for the `gcs` provider
+type GCSConfig struct {
+	Bucket          *string           `json:"bucket" san:"bucket" yaml:"bucket"`
+	LocalDirectory  *string           `json:"local_directory" san:"local_directory" yaml:"local_directory"`
+	RemoteDirectory *string           `json:"remote_directory" san:"remote_directory" yaml:"remote_directory"`
+	CredentialsJSON *string           `json:"credentials_json" san:"credentials_json" yaml:"credentials_json"`
+	ProjectID       *string           `json:"project_id" san:"project_id" yaml:"project_id"`
+	Include         []string          `json:"include" san:"include" yaml:"include"`
+	Exclude         []string          `json:"exclude" san:"exclude" yaml:"exclude"`
+	Rules           []FileRule        `json:"rules" san:"rules" yaml:"rules"`
+	Timeout         *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env             map[string]string `json:"env" san:"env" yaml:"env"`
+	When            *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// GitLabReleasesConfig is the configuration for the `gitlab_releases` provider
+type GitLabReleasesConfig struct {
+	Name      *string           `json:"name" san:"name" yaml:"name"`
+	Body      *string           `json:"body" san:"body" yaml:"body"`
+	ProjectID *string           `json:"project_id" san:"project_id" yaml:"project_id"`
+	APIKey    *string           `json:"api_key" san:"api_key" yaml:"api_key"`
+	Assets    []string          `json:"assets" san:"assets" yaml:"assets"`
+	Tag       *string           `json:"tag" san:"tag" yaml:"tag"`
+	BaseURL   *string           `json:"base_url" san:"base_url" yaml:"base_url"`
+	Timeout   *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env       map[string]string `json:"env" san:"env" yaml:"env"`
+	When      *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// AzureBlobConfig is the configuration for the `azure_blob` provider
+type AzureBlobConfig struct {
+	AccountName     *string           `json:"account_name" san:"account_name" yaml:"account_name"`
+	AccountKey      *string           `json:"account_key" san:"account_key" yaml:"account_key"`
+	SASToken        *string           `json:"sas_token" san:"sas_token" yaml:"sas_token"`
+	Container       *string           `json:"container" san:"container" yaml:"container"`
+	LocalDirectory  *string           `json:"local_directory" san:"local_directory" yaml:"local_directory"`
+	RemoteDirectory *string           `json:"remote_directory" san:"remote_directory" yaml:"remote_directory"`
+	Include         []string          `json:"include" san:"include" yaml:"include"`
+	Exclude         []string          `json:"exclude" san:"exclude" yaml:"exclude"`
+	Timeout         *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env             map[string]string `json:"env" san:"env" yaml:"env"`
+	When            *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// CloudflareConfig is the configuration for the `cloudflare` provider
+type CloudflareConfig struct {
+	APIToken    *string           `json:"api_token" san:"api_token" yaml:"api_token"`
+	AccountID   *string           `json:"account_id" san:"account_id" yaml:"account_id"`
+	ProjectName *string           `json:"project_name" san:"project_name" yaml:"project_name"`
+	Directory   *string           `json:"directory" san:"directory" yaml:"directory"`
+	Branch      *string           `json:"branch" san:"branch" yaml:"branch"`
+	Include     []string          `json:"include" san:"include" yaml:"include"`
+	Exclude     []string          `json:"exclude" san:"exclude" yaml:"exclude"`
+	Timeout     *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env         map[string]string `json:"env" san:"env" yaml:"env"`
+	When        *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// FTPConfig is the configuration for the `ftp` provider
+type FTPConfig struct {
+	Host            *string           `json:"host" san:"host" yaml:"host"`
+	Port            *int              `json:"port" san:"port" yaml:"port"`
+	Username        *string           `json:"username" san:"username" yaml:"username"`
+	Password        *string           `json:"password" san:"password" yaml:"password"`
+	LocalDirectory  *string           `json:"local_directory" san:"local_directory" yaml:"local_directory"`
+	RemoteDirectory *string           `json:"remote_directory" san:"remote_directory" yaml:"remote_directory"`
+	TLS             *bool             `json:"tls" san:"tls" yaml:"tls"`
+	FileMode        *string           `json:"file_mode" san:"file_mode" yaml:"file_mode"`
+	DirMode         *string           `json:"dir_mode" san:"dir_mode" yaml:"dir_mode"`
+	Include         []string          `json:"include" san:"include" yaml:"include"`
+	Exclude         []string          `json:"exclude" san:"exclude" yaml:"exclude"`
+	Timeout         *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env             map[string]string `json:"env" san:"env" yaml:"env"`
+	When            *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// SSHConfig is the configuration for the `ssh` provider
+type SSHConfig struct {
+	Host            *string           `json:"host" san:"host" yaml:"host"`
+	Port            *int              `json:"port" san:"port" yaml:"port"`
+	User            *string           `json:"user" san:"user" yaml:"user"`
+	PrivateKeyPath  *string           `json:"private_key_path" san:"private_key_path" yaml:"private_key_path"`
+	PrivateKey      *string           `json:"private_key" san:"private_key" yaml:"private_key"`
+	LocalDirectory  *string           `json:"local_directory" san:"local_directory" yaml:"local_directory"`
+	RemoteDirectory *string           `json:"remote_directory" san:"remote_directory" yaml:"remote_directory"`
+	Commands        []string          `json:"commands" san:"commands" yaml:"commands"`
+	FileMode        *string           `json:"file_mode" san:"file_mode" yaml:"file_mode"`
+	DirMode         *string           `json:"dir_mode" san:"dir_mode" yaml:"dir_mode"`
+	Timeout         *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env             map[string]string `json:"env" san:"env" yaml:"env"`
+	When            *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// NetlifyConfig is the configuration for the `netlify` provider
+type NetlifyConfig struct {
+	AccessToken *string           `json:"access_token" san:"access_token" yaml:"access_token"`
+	SiteID      *string           `json:"site_id" san:"site_id" yaml:"site_id"`
+	Directory   *string           `json:"directory" san:"directory" yaml:"directory"`
+	Draft       *bool             `json:"draft" san:"draft" yaml:"draft"`
+	Message     *string           `json:"message" san:"message" yaml:"message"`
+	Include     []string          `json:"include" san:"include" yaml:"include"`
+	Exclude     []string          `json:"exclude" san:"exclude" yaml:"exclude"`
+	Timeout     *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env         map[string]string `json:"env" san:"env" yaml:"env"`
+	When        *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// PyPIConfig is the configuration for the `pypi` provider
+type PyPIConfig struct {
+	Username     *string           `json:"username" san:"username" yaml:"username"`
+	Password     *string           `json:"password" san:"password" yaml:"password"`
+	Token        *string           `json:"token" san:"token" yaml:"token"`
+	Repository   *string           `json:"repository" san:"repository" yaml:"repository"`
+	Directory    *string           `json:"directory" san:"directory" yaml:"directory"`
+	SkipExisting *bool             `json:"skip_existing" san:"skip_existing" yaml:"skip_existing"`
+	Timeout      *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env          map[string]string `json:"env" san:"env" yaml:"env"`
+	When         *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// NPMConfig is the configuration for the `npm` provider
+type NPMConfig struct {
+	Token     *string           `json:"token" san:"token" yaml:"token"`
+	Directory *string           `json:"directory" san:"directory" yaml:"directory"`
+	Access    *string           `json:"access" san:"access" yaml:"access"`
+	Tag       *string           `json:"tag" san:"tag" yaml:"tag"`
+	Registry  *string           `json:"registry" san:"registry" yaml:"registry"`
+	Timeout   *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env       map[string]string `json:"env" san:"env" yaml:"env"`
+	When      *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// VercelConfig is the configuration for the `vercel` provider. Env is the environment of the deployment
+type VercelConfig struct {
+	Token       *string           `json:"token" san:"token" yaml:"token"`
+	Directory   *string           `json:"directory" san:"directory" yaml:"directory"`
+	ProjectName *string           `json:"project_name" san:"project_name" yaml:"project_name"`
+	OrgID       *string           `json:"org_id" san:"org_id" yaml:"org_id"`
+	Prod        *bool             `json:"prod" san:"prod" yaml:"prod"`
+	Alias       []string          `json:"alias" san:"alias" yaml:"alias"`
+	Timeout     *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env         map[string]string `json:"env" san:"env" yaml:"env"`
+	When        *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// FirebaseConfig is the configuration for the `firebase` provider
+type FirebaseConfig struct {
+	Token     *string           `json:"token" san:"token" yaml:"token"`
+	ProjectID *string           `json:"project_id" san:"project_id" yaml:"project_id"`
+	Directory *string           `json:"directory" san:"directory" yaml:"directory"`
+	Channel   *string           `json:"channel" san:"channel" yaml:"channel"`
+	Timeout   *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env       map[string]string `json:"env" san:"env" yaml:"env"`
+	When      *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// HTTPConfig is the configuration for the `http` provider, which sends a request to a webhook
+type HTTPConfig struct {
+	URL          *string           `json:"url" san:"url" yaml:"url"`
+	Method       *string           `json:"method" san:"method" yaml:"method"`
+	Headers      map[string]string `json:"headers" san:"headers" yaml:"headers"`
+	Body         *string           `json:"body" san:"body" yaml:"body"`
+	ExpectStatus *int              `json:"expect_status" san:"expect_status" yaml:"expect_status"`
+	Timeout      *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env          map[string]string `json:"env" san:"env" yaml:"env"`
+	When         *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// FlyConfig is the configuration for the `fly` provider
+type FlyConfig struct {
+	Token      *string           `json:"token" san:"token" yaml:"token"`
+	App        *string           `json:"app" san:"app" yaml:"app"`
+	ConfigPath *string           `json:"config_path" san:"config_path" yaml:"config_path"`
+	Directory  *string           `json:"directory" san:"directory" yaml:"directory"`
+	Strategy   *string           `json:"strategy" san:"strategy" yaml:"strategy"`
+	Timeout    *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env        map[string]string `json:"env" san:"env" yaml:"env"`
+	When       *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// KubernetesConfig is the configuration for the `kubernetes` provider. Kubeconfig is either the path
+// of a kubeconfig file or its content
+type KubernetesConfig struct {
+	Kubeconfig *string           `json:"kubeconfig" san:"kubeconfig" yaml:"kubeconfig"`
+	Context    *string           `json:"context" san:"context" yaml:"context"`
+	Namespace  *string           `json:"namespace" san:"namespace" yaml:"namespace"`
+	Manifests  []string          `json:"manifests" san:"manifests" yaml:"manifests"`
+	Prune      *bool             `json:"prune" san:"prune" yaml:"prune"`
+	Selector   *string           `json:"selector" san:"selector" yaml:"selector"`
+	Timeout    *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env        map[string]string `json:"env" san:"env" yaml:"env"`
+	When       *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// MavenConfig is the configuration for the `maven` provider
+type MavenConfig struct {
+	RepositoryURL     *string           `json:"repository_url" san:"repository_url" yaml:"repository_url"`
+	Username          *string           `json:"username" san:"username" yaml:"username"`
+	Password          *string           `json:"password" san:"password" yaml:"password"`
+	Directory         *string           `json:"directory" san:"directory" yaml:"directory"`
+	GradlePublishTask *string           `json:"gradle_publish_task" san:"gradle_publish_task" yaml:"gradle_publish_task"`
+	Timeout           *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env               map[string]string `json:"env" san:"env" yaml:"env"`
+	When              *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// CargoConfig is the configuration for the `cargo` provider. Registry is either the name of a
+// registry of the cargo configuration or the URL of its index
+type CargoConfig struct {
+	Token      *string           `json:"token" san:"token" yaml:"token"`
+	Directory  *string           `json:"directory" san:"directory" yaml:"directory"`
+	DryRun     *bool             `json:"dry_run" san:"dry_run" yaml:"dry_run"`
+	AllowDirty *bool             `json:"allow_dirty" san:"allow_dirty" yaml:"allow_dirty"`
+	Registry   *string           `json:"registry" san:"registry" yaml:"registry"`
+	Timeout    *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env        map[string]string `json:"env" san:"env" yaml:"env"`
+	When       *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// RenderConfig is the configuration for the `render` provider
+type RenderConfig struct {
+	APIKey     *string           `json:"api_key" san:"api_key" yaml:"api_key"`
+	ServiceID  *string           `json:"service_id" san:"service_id" yaml:"service_id"`
+	ClearCache *bool             `json:"clear_cache" san:"clear_cache" yaml:"clear_cache"`
+	Timeout    *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env        map[string]string `json:"env" san:"env" yaml:"env"`
+	When       *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// ExecPluginConfig is the configuration for the `exec_plugin` provider
+type ExecPluginConfig struct {
+	Command   *string  `json:"command" san:"command" yaml:"command"`
+	Args      []string `json:"args" san:"args" yaml:"args"`
+	Directory *string  `json:"directory" san:"directory" yaml:"directory"`
+	// Config is passed to the plugin on its stdin
+	Config  map[string]string `json:"config" san:"config" yaml:"config"`
+	Timeout *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env     map[string]string `json:"env" san:"env" yaml:"env"`
+	When    *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// AnsibleConfig is the configuration for the `ansible` provider
+type AnsibleConfig struct {
+	Playbook  *string           `json:"playbook" san:"playbook" yaml:"playbook"`
+	Inventory *string           `json:"inventory" san:"inventory" yaml:"inventory"`
+	ExtraVars map[string]string `json:"extra_vars" san:"extra_vars" yaml:"extra_vars"`
+	Tags      []string          `json:"tags" san:"tags" yaml:"tags"`
+	Limit     *string           `json:"limit" san:"limit" yaml:"limit"`
+	Timeout   *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env       map[string]string `json:"env" san:"env" yaml:"env"`
+	When      *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// SentryConfig is the configuration for the `sentry` provider
+type SentryConfig struct {
+	AuthToken     *string           `json:"auth_token" san:"auth_token" yaml:"auth_token"`
+	Org           *string           `json:"org" san:"org" yaml:"org"`
+	Project       *string           `json:"project" san:"project" yaml:"project"`
+	Release       *string           `json:"release" san:"release" yaml:"release"`
+	SourceMapsDir *string           `json:"source_maps_dir" san:"source_maps_dir" yaml:"source_maps_dir"`
+	URLPrefix     *string           `json:"url_prefix" san:"url_prefix" yaml:"url_prefix"`
+	Timeout       *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env           map[string]string `json:"env" san:"env" yaml:"env"`
+	When          *string           `json:"when" san:"when" yaml:"when"`
+}
+
+// GitHubPagesConfig is the configuration for the `github_pages` provider
+type GitHubPagesConfig struct {
+	Repo          *string           `json:"repo" san:"repo" yaml:"repo"`
+	APIKey        *string           `json:"api_key" san:"api_key" yaml:"api_key"`
+	Branch        *string           `json:"branch" san:"branch" yaml:"branch"`
+	Directory     *string           `json:"directory" san:"directory" yaml:"directory"`
+	CommitMessage *string           `json:"commit_message" san:"commit_message" yaml:"commit_message"`
+	Clean         *bool             `json:"clean" san:"clean" yaml:"clean"`
+	Timeout       *string           `json:"timeout" san:"timeout" yaml:"timeout"`
+	Env           map[string]string `json:"env" san:"env" yaml:"env"`
+	When          *string           `json:"when" san:"when" yaml:"when"`
 }
 
 // ExpandEnv 'fix' os.ExpandEnv by allowing to use $$ to escape a dollar e.g: $$HOME -> $HOME
+// It also supports the ${VAR:-default} (default if VAR is unset or empty) and ${VAR:+alt}
+// (alt if VAR is set and not empty) forms
 func ExpandEnv(s string) string {
-	os.Setenv("ROCKET_DOLLAR", "$")
-	return os.ExpandEnv(strings.Replace(s, "$$", "${ROCKET_DOLLAR}", -1))
+	return Expand(s, os.Getenv)
+}
+
+// Expand is ExpandEnv with the variables looked up by getenv instead of os.Getenv
+func Expand(s string, getenv func(string) string) string {
+	return os.Expand(s, func(name string) string {
+		return expandVar(name, getenv)
+	})
+}
+
+// expandVar is the mapping function of Expand. name is the content of ${...} or the name following $
+func expandVar(name string, getenv func(string) string) string {
+	if name == "$" {
+		return "$"
+	}
+
+	if i := strings.Index(name, ":-"); i != -1 {
+		if v := getenv(name[:i]); v != "" {
+			return v
+		}
+		return Expand(name[i+2:], getenv)
+	}
+
+	if i := strings.Index(name, ":+"); i != -1 {
+		if getenv(name[:i]) != "" {
+			return Expand(name[i+2:], getenv)
+		}
+		return ""
+	}
+
+	return getenv(name)
+}
+
+// StdinFileName is the configuration file name meaning that the configuration is read from stdin
+const StdinFileName = "-"
+
+// readConfigFile returns the content of the configuration file, read from stdin for StdinFileName
+func readConfigFile(configFilePath string) ([]byte, error) {
+	if isRemote(configFilePath) {
+		return fetchRemote(configFilePath)
+	}
+	if configFilePath != StdinFileName {
+		return ioutil.ReadFile(configFilePath)
+	}
+	file, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(file)) == 0 {
+		return nil, errors.New("no configuration read from stdin")
+	}
+	return file, nil
 }
 
 func parseConfig(configFilePath string) (Config, error) {
 	var ret Config
 	var err error
 
-	file, err := ioutil.ReadFile(configFilePath)
+	file, err := readConfigFile(configFilePath)
+	if err != nil {
+		return ret, err
+	}
+
+	// the file is decoded a first time without schema to find the providers with several instances,
+	// and to detect the unknown (e.g. misspelled) keys
+	var raw interface{}
+	tag := "san"
+	ext := filepath.Ext(configFilePath)
+	if isRemote(configFilePath) {
+		ext = remoteExt(configFilePath)
+	}
+	switch ext {
+	case ".yml", ".yaml":
+		tag = "yaml"
+		err = yaml.Unmarshal(file, &raw)
+	case ".json":
+		tag = "json"
+		err = json.Unmarshal(file, &raw)
+	default:
+		err = san.Unmarshal(file, &raw)
+	}
+	if err != nil {
+		if tag == "json" {
+			err = jsonError(configFilePath, file, err)
+		}
+		return ret, err
+	}
+
+	instances := splitInstances(raw, tag)
+	if len(instances) == 0 {
+		switch tag {
+		case "yaml":
+			err = yaml.Unmarshal(file, &ret)
+		case "json":
+			err = json.Unmarshal(file, &ret)
+			if err != nil {
+				err = jsonError(configFilePath, file, err)
+			}
+		default:
+			err = san.Unmarshal(file, &ret)
+		}
+	} else {
+		ret, err = decodeRaw(raw)
+	}
 	if err != nil {
 		return ret, err
 	}
 
-	err = san.Unmarshal(file, &ret)
+	for _, instance := range instances {
+		if err = strictError(configFilePath, file, instance, tag); err != nil {
+			return ret, err
+		}
+		instanceConfig, err := decodeRaw(instance)
+		if err != nil {
+			return ret, err
+		}
+		ret.Instances = append(ret.Instances, instanceConfig)
+	}
 
-	return ret, err
+	return ret, strictError(configFilePath, file, raw, tag)
+}
+
+// jsonError add the line and column of the error to the errors returned by encoding/json
+// which only provide an offset
+func jsonError(configFilePath string, data []byte, err error) error {
+	var offset int64
+
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		return err
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	line := bytes.Count(data[:offset], []byte("\n")) + 1
+	column := offset - int64(bytes.LastIndex(data[:offset], []byte("\n")))
+	return fmt.Errorf("%s: line %d, column %d (offset %d): %s", configFilePath, line, column, offset, err.Error())
 }
 
 func fileExists(path string) bool {
@@ -140,8 +778,13 @@ func Default() Config {
 }
 
 // FindConfigFile return the path of the first configuration file found
-// it returns an empty string if none is found
+// it returns an empty string if none is found. StdinFileName is returned as is
+// If file is empty, the configuration files are looked up in the working directory, then in its parents
+// up to the root, like git does for .git. A file found in a parent directory is returned as an absolute path
 func FindConfigFile(file string) string {
+	if file == StdinFileName {
+		return file
+	}
 	if file != "" {
 		if fileExists(file) {
 			return file
@@ -149,8 +792,23 @@ func FindConfigFile(file string) string {
 		return ""
 	}
 
-	if fileExists(DefaultConfigurationFileName) {
-		return DefaultConfigurationFileName
+	for _, fileName := range ConfigurationFileNames {
+		if fileExists(fileName) {
+			return fileName
+		}
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for parent := filepath.Dir(dir); parent != dir; parent = filepath.Dir(dir) {
+		dir = parent
+		for _, fileName := range ConfigurationFileNames {
+			if path := filepath.Join(dir, fileName); fileExists(path) {
+				return path
+			}
+		}
 	}
 
 	return ""
@@ -158,6 +816,21 @@ func FindConfigFile(file string) string {
 
 // Get return the parsed found configuration file or an error
 func Get(file string) (Config, error) {
+	return GetForEnvironment(file, "")
+}
+
+// LoadAndValidate finds and parses the configuration file, sets up the env and validates the configuration
+// without deploying it. If the configuration is not valid, the returned error is a *ValidationError
+// which lists each problem
+func LoadAndValidate(file string) (Config, error) {
+	return GetForEnvironment(file, "")
+}
+
+// GetForEnvironment return the parsed found configuration file, overridden by the given environment
+// section, or an error. If environment is empty, the base configuration is returned.
+// If file is StdinFileName, the configuration is read from stdin, in the SAN format, and its relative
+// includes are resolved against the working directory
+func GetForEnvironment(file, environment string) (Config, error) {
 	var err error
 	var config Config
 
@@ -170,50 +843,173 @@ func Get(file string) (Config, error) {
 		return config, fmt.Errorf("%s file not found.", file)
 	}
 
-	config, err = parseConfig(configFilePath)
+	// a configuration file found in a parent directory applies as if rocket was executed from its directory
+	configDir := ""
+	if file == "" && filepath.Dir(configFilePath) != "." {
+		configDir = filepath.Dir(configFilePath)
+		log.Debug(fmt.Sprintf("using the configuration file %s", configFilePath))
+	}
+
+	config, err = loadConfig(configFilePath, nil)
 	if err != nil {
 		return config, err
 	}
 
+	if environment != "" {
+		environmentConfig, ok := config.Environments[environment]
+		if !ok {
+			return config, fmt.Errorf("environment %s not found in %s", environment, configFilePath)
+		}
+		config = config.Merge(environmentConfig)
+	}
+
+	logWarnings(config.Migrate())
+
 	err = setPredefinedEnv()
 	if err != nil {
 		return config, err
 	}
 
+	if configDir != "" && config.EnvFile != nil {
+		config.EnvFile = resolvePath(configDir, *config.EnvFile)
+	}
+
+	err = parseEnvFile(config)
+	if err != nil {
+		return config, err
+	}
+
+	err = resolveSecrets(&config)
+	if err != nil {
+		return config, err
+	}
+
 	err = parseEnv(config)
 	if err != nil {
 		return config, err
 	}
 
-	return config, err
-}
+	err = checkRequiredEnv(config)
+	if err != nil {
+		return config, err
+	}
 
-// set the default env variables
-// it does not overwrite the already existing
-func setPredefinedEnv() error {
-	if os.Getenv("ROCKET_COMMIT_HASH") == "" {
-		v := ""
-		out, err := exec.Command("git", "rev-parse", "HEAD").Output()
-		if err == nil {
-			v = strings.TrimSpace(string(out))
+	// the relative paths of the hooks and providers are then resolved against the directory of the file
+	if configDir != "" {
+		if config.WorkingDirectory == nil {
+			config.WorkingDirectory = &configDir
 		} else {
-			log.With("err", err, "var", "ROCKET_COMMIT_HASH").Debug("error setting env var")
+			config.WorkingDirectory = resolvePath(configDir, *config.WorkingDirectory)
 		}
-		err = os.Setenv("ROCKET_COMMIT_HASH", v)
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return config, err
+	}
+
+	if config.LogLevel != nil {
+		level, _ := ParseLogLevel(ExpandEnv(*config.LogLevel))
+		log.Config(astroflow.SetLevel(level))
+	}
+
+	return config, nil
+}
+
+// resolvePath expands the env of path and, if it is relative, joins it to dir
+func resolvePath(dir, path string) *string {
+	v := ExpandEnv(path)
+	if !filepath.IsAbs(v) {
+		v = filepath.Join(dir, v)
+	}
+	return &v
+}
+
+// ParseLogLevel returns the astroflow level of the given log_level
+func ParseLogLevel(level string) (astroflow.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return astroflow.DebugLevel, nil
+	case "info", "":
+		return astroflow.InfoLevel, nil
+	case "warn", "warning":
+		return astroflow.WarnLevel, nil
+	case "error":
+		return astroflow.ErrorLevel, nil
+	}
+	return astroflow.InfoLevel, fmt.Errorf("log_level should be debug, info, warn or error, not '%s'", level)
+}
+
+// loadConfig parse the given configuration file and merge its includes into it, the including file
+// taking precedence. Relative includes are resolved against the directory of the including file, or
+// against its URL for a remote (https://) file.
+// including is the chain of files currently being included, used to detect circular includes
+func loadConfig(configFilePath string, including []string) (Config, error) {
+	var err error
+	absPath := configFilePath
+	if !isRemote(configFilePath) {
+		absPath, err = filepath.Abs(configFilePath)
 		if err != nil {
-			return err
+			return Config{}, err
 		}
 	}
+	for i, file := range including {
+		if file == absPath {
+			return Config{}, fmt.Errorf("circular include: %s", strings.Join(append(including[i:], absPath), " -> "))
+		}
+	}
+	including = append(including, absPath)
 
-	if os.Getenv("ROCKET_LAST_TAG") == "" {
-		v := ""
-		out, err := exec.Command("git", "describe", "--tags", "--abbrev=0").Output()
-		if err == nil {
-			v = strings.TrimSpace(string(out))
-		} else {
-			log.With("err", err, "var", "ROCKET_LAST_TAG").Debug("error setting env var")
+	config, err := parseConfig(configFilePath)
+	if err != nil {
+		return config, err
+	}
+
+	base := Config{}
+	for _, include := range config.Include {
+		include = ExpandEnv(include)
+		switch {
+		case isRemote(include):
+		case isRemote(configFilePath):
+			// a remote file can only include other remote files
+			include, err = resolveRemote(configFilePath, include)
+			if err != nil {
+				return config, err
+			}
+		case !filepath.IsAbs(include):
+			include = filepath.Join(filepath.Dir(configFilePath), include)
 		}
-		err = os.Setenv("ROCKET_LAST_TAG", v)
+		if !isRemote(include) && !fileExists(include) {
+			return config, fmt.Errorf("%s: included file %s not found", configFilePath, include)
+		}
+
+		included, err := loadConfig(include, including)
+		if err != nil {
+			return config, err
+		}
+		base = base.Merge(included)
+	}
+
+	return base.Merge(config), nil
+}
+
+// set the default env variables
+// it does not overwrite the already existing
+func setPredefinedEnv() error {
+	gitVars := []struct {
+		key  string
+		args []string
+	}{
+		{"ROCKET_COMMIT_HASH", []string{"rev-parse", "HEAD"}},
+		{"ROCKET_COMMIT_SHORT", []string{"rev-parse", "--short", "HEAD"}},
+		{"ROCKET_COMMIT_AUTHOR", []string{"log", "-1", "--format=%an"}},
+		{"ROCKET_COMMIT_MESSAGE", []string{"log", "-1", "--format=%s"}},
+		{"ROCKET_BRANCH", []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+		{"ROCKET_LAST_TAG", []string{"describe", "--tags", "--abbrev=0"}},
+	}
+
+	for _, gitVar := range gitVars {
+		err := setGitEnv(gitVar.key, gitVar.args...)
 		if err != nil {
 			return err
 		}
@@ -239,6 +1035,23 @@ func setPredefinedEnv() error {
 	return nil
 }
 
+// setGitEnv set the key env variable to the trimmed output of the given git command
+// it does not overwrite the already existing, and set an empty string if the command fails
+func setGitEnv(key string, args ...string) error {
+	if os.Getenv(key) != "" {
+		return nil
+	}
+
+	v := ""
+	out, err := exec.Command("git", args...).Output()
+	if err == nil {
+		v = strings.TrimSpace(string(out))
+	} else {
+		log.With("err", err, "var", key).Debug("error setting env var")
+	}
+	return os.Setenv(key, v)
+}
+
 func isPredefined(key string) bool {
 	for _, v := range PredefinedEnv {
 		if v == key {
@@ -252,11 +1065,18 @@ func isPredefined(key string) bool {
 // parseVariables parse the 'variables' field of the configuration, expand them and set them as env
 func parseEnv(conf Config) error {
 	if conf.Env != nil {
+		// the variables are set after the ones they reference, so they can be used in any order
+		keys, err := SortEnv(conf.Env)
+		if err != nil {
+			return err
+		}
+		values := map[string]string{}
 		for key, value := range conf.Env {
-			var err error
-			key = strings.ToUpper(key)
+			values[strings.ToUpper(key)] = value
+		}
+		for _, key := range keys {
 			if os.Getenv(key) == "" || isPredefined(key) {
-				err = os.Setenv(key, ExpandEnv(value))
+				err = os.Setenv(key, ExpandEnv(values[key]))
 				if err != nil {
 					return err
 				}
@@ -266,3 +1086,148 @@ func parseEnv(conf Config) error {
 
 	return nil
 }
+
+// SortEnv returns the upper cased keys of env sorted so each variable comes after the variables of env
+// it references, e.g: DOMAIN before BASE_URL = "https://$DOMAIN". The independent variables are sorted
+// alphabetically, and an error is returned if variables reference each other in a cycle
+func SortEnv(env map[string]string) ([]string, error) {
+	values := map[string]string{}
+	keys := []string{}
+	for key, value := range env {
+		key = strings.ToUpper(key)
+		values[key] = value
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ret := []string{}
+	visiting := map[string]bool{}
+	visited := map[string]bool{}
+	var visit func(key string, path []string) error
+	visit = func(key string, path []string) error {
+		if visited[key] {
+			return nil
+		}
+		if visiting[key] {
+			for i, k := range path {
+				if k == key {
+					path = path[i:]
+					break
+				}
+			}
+			return fmt.Errorf("env: circular reference: %s", strings.Join(append(path, key), " -> "))
+		}
+		visiting[key] = true
+		for _, ref := range envReferences(values[key]) {
+			// a variable referencing itself (e.g. PATH = "$PATH:./bin") uses the already set value
+			if _, ok := values[ref]; ok && ref != key {
+				if err := visit(ref, append(path, key)); err != nil {
+					return err
+				}
+			}
+		}
+		visiting[key] = false
+		visited[key] = true
+		ret = append(ret, key)
+		return nil
+	}
+
+	for _, key := range keys {
+		if err := visit(key, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// envReferences returns the names of the variables referenced by value, including in the default and
+// alternative values (${VAR:-default}), without the escaped ones ($$VAR)
+func envReferences(value string) []string {
+	ret := []string{}
+	var mapping func(name string) string
+	mapping = func(name string) string {
+		if name == "$" {
+			return ""
+		}
+		for _, op := range []string{":-", ":+"} {
+			if i := strings.Index(name, op); i != -1 {
+				os.Expand(name[i+2:], mapping)
+				name = name[:i]
+				break
+			}
+		}
+		ret = append(ret, name)
+		return ""
+	}
+	os.Expand(value, mapping)
+	return ret
+}
+
+// checkRequiredEnv returns an error listing the variables of the 'required_env' field of the
+// configuration which are not set or empty, so a missing secret does not silently expand to ""
+func checkRequiredEnv(conf Config) error {
+	missing := []string{}
+	for _, key := range conf.RequiredEnv {
+		key = strings.ToUpper(strings.TrimSpace(key))
+		if os.Getenv(key) == "" {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) != 0 {
+		return fmt.Errorf("required environment variables not set: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// parseEnvFile read the KEY=VALUE lines of the 'env_file' field of the configuration, expand them
+// and set them as env. Like parseEnv, it does not overwrite the already existing variables
+func parseEnvFile(conf Config) error {
+	if conf.EnvFile == nil {
+		return nil
+	}
+
+	envFilePath := ExpandEnv(*conf.EnvFile)
+	file, err := os.Open(envFilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	lineNumber := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("%s: line %d: expected KEY=VALUE", envFilePath, lineNumber)
+		}
+		key := strings.ToUpper(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		// single quoted values are not expanded
+		expand := true
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			expand = value[0] == '"'
+			value = value[1 : len(value)-1]
+		}
+		if expand {
+			value = ExpandEnv(value)
+		}
+
+		if os.Getenv(key) == "" || isPredefined(key) {
+			err = os.Setenv(key, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return scanner.Err()
+}
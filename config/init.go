@@ -0,0 +1,263 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// initHeader is the beginning of the files generated by InitConfig
+const initHeader = `# This is a configuration file for rocket: automated software delivery as fast and easy as possible.
+# See https://github.com/bloom42/rocket
+# Environment variables ($VAR or ${VAR}) are expanded in the values.
+description = "My project"
+`
+
+// initTemplates are the sections generated by InitConfig, by provider
+var initTemplates = map[string]string{
+	"script": `# the commands to execute
+script = [
+  "./scripts/deploy.sh",
+]
+`,
+	"heroku": `heroku = {
+  api_key = "$HEROKU_API_KEY" # the Heroku API key
+  app = "my-app" # the Heroku app to deploy
+  directory = "." # the directory to tar gzip and upload
+}
+`,
+	"github_releases": `github_releases = {
+  api_key = "$GITHUB_API_KEY" # a GitHub token with the repo scope
+  repo = "owner/repo" # default to the repository of the origin remote
+  tag = "$ROCKET_LAST_TAG" # the tag to release
+  name = "$ROCKET_LAST_TAG" # the name of the release
+  assets = ["dist/*"] # the files to upload, as glob patterns
+}
+`,
+	"docker": `docker = {
+  username = "$DOCKER_USERNAME" # the username to login to the registry
+  password = "$DOCKER_PASSWORD" # the password to login to the registry
+  images = ["owner/image:$ROCKET_LAST_TAG", "owner/image:latest"] # the images to push
+}
+`,
+	"aws_s3": `aws_s3 = {
+  access_key_id = "$AWS_ACCESS_KEY_ID" # the AWS access key ID
+  secret_access_key = "$AWS_SECRET_ACCESS_KEY" # the AWS secret access key
+  region = "us-east-1" # the region of the bucket
+  bucket = "my-bucket" # the bucket to upload to
+  local_directory = "dist" # the local directory to upload
+  remote_directory = "/" # the directory of the bucket to upload to
+}
+`,
+	"zeit_now": `zeit_now = {
+  token = "$ZEIT_TOKEN" # a ZEIT token
+  name = "my-app" # the name of the deployment
+  directory = "." # the directory to deploy
+}
+`,
+	"aws_eb": `aws_eb = {
+  access_key_id = "$AWS_ACCESS_KEY_ID" # the AWS access key ID
+  secret_access_key = "$AWS_SECRET_ACCESS_KEY" # the AWS secret access key
+  region = "us-east-1" # the region of the application
+  application = "my-app" # the Elastic Beanstalk application
+  environment = "my-app-production" # the environment to update
+  s3_bucket = "my-bucket" # the bucket to upload the bundle to
+  directory = "." # the directory to zip and deploy
+}
+`,
+	"gcs": `gcs = {
+  credentials_json = "$GOOGLE_APPLICATION_CREDENTIALS" # the service account credentials (path or JSON)
+  bucket = "my-bucket" # the bucket to upload to
+  local_directory = "dist" # the local directory to upload
+  remote_directory = "/" # the directory of the bucket to upload to
+}
+`,
+	"gitlab_releases": `gitlab_releases = {
+  api_key = "$GITLAB_API_KEY" # a GitLab token with the api scope
+  project_id = "group/project" # default to the repository of the origin remote
+  tag = "$ROCKET_LAST_TAG" # the tag to release
+  assets = ["dist/*"] # the files to upload, as glob patterns
+}
+`,
+	"azure_blob": `azure_blob = {
+  account_name = "$AZURE_STORAGE_ACCOUNT" # the storage account
+  account_key = "$AZURE_STORAGE_KEY" # the account key (or use sas_token)
+  container = "my-container" # the container to upload to
+  local_directory = "dist" # the local directory to upload
+}
+`,
+	"cloudflare": `cloudflare = {
+  api_token = "$CLOUDFLARE_API_TOKEN" # an API token with the Pages edit permission
+  account_id = "$CLOUDFLARE_ACCOUNT_ID" # the ID of the account
+  project_name = "my-project" # the Pages project
+  directory = "dist" # the directory to deploy
+}
+`,
+	"ftp": `ftp = {
+  host = "$FTP_HOST" # the FTP server
+  username = "$FTP_USERNAME" # the user to login as
+  password = "$FTP_PASSWORD" # the password of the user
+  local_directory = "dist" # the local directory to upload
+  remote_directory = "/" # the directory of the server to upload to
+  tls = true # use explicit FTPS
+}
+`,
+	"ssh": `ssh = {
+  host = "$SSH_HOST" # the server
+  user = "deploy" # the user to connect as
+  private_key_path = "$HOME/.ssh/id_ed25519" # the key to authenticate with
+  local_directory = "dist" # the local directory to copy
+  remote_directory = "/var/www/my-app" # the directory of the server to copy to
+  commands = ["sudo systemctl restart my-app"] # the commands to execute after the copy
+}
+`,
+	"netlify": `netlify = {
+  access_token = "$NETLIFY_AUTH_TOKEN" # a Netlify personal access token
+  site_id = "$NETLIFY_SITE_ID" # the ID of the site
+  directory = "dist" # the directory to deploy
+}
+`,
+	"pypi": `pypi = {
+  token = "$PYPI_TOKEN" # a PyPI API token
+  directory = "dist" # the directory containing the distributions to upload
+}
+`,
+	"npm": `npm = {
+  token = "$NPM_TOKEN" # an npm automation token
+  directory = "." # the directory containing the package.json file
+  access = "public" # public or restricted
+}
+`,
+	"vercel": `vercel = {
+  token = "$VERCEL_TOKEN" # a Vercel token
+  project_name = "my-app" # the project to deploy to
+  directory = "." # the directory to deploy
+  prod = false # create a production deployment
+}
+`,
+	"firebase": `firebase = {
+  token = "$FIREBASE_TOKEN" # a token created with firebase login:ci
+  project_id = "my-project" # the Firebase project
+  directory = "." # the directory containing the firebase.json file
+}
+`,
+	"http": `http = {
+  url = "https://example.com/deploy" # the URL to send the request to
+  method = "POST" # the method of the request
+  headers = {
+    Authorization = "Bearer $DEPLOY_TOKEN"
+  }
+  body = "" # the body of the request
+}
+`,
+	"fly": `fly = {
+  token = "$FLY_API_TOKEN" # a Fly API token
+  app = "my-app" # the app to deploy
+  config_path = "fly.toml" # the configuration of the app
+  strategy = "rolling" # rolling, immediate, canary or bluegreen
+}
+`,
+	"kubernetes": `kubernetes = {
+  kubeconfig = "$KUBECONFIG" # the path of the kubeconfig file, or its content
+  context = "production" # the kubeconfig context to use
+  namespace = "my-app" # the namespace of the resources
+  manifests = ["k8s/*.yml"] # the manifests to apply
+}
+`,
+	"maven": `maven = {
+  repository_url = "https://repo.example.com/releases" # the Maven repository to upload to
+  username = "$MAVEN_USERNAME" # the username of the repository
+  password = "$MAVEN_PASSWORD" # the password of the repository
+  directory = "target" # the directory containing the artifacts and their pom
+}
+`,
+	"cargo": `cargo = {
+  token = "$CARGO_REGISTRY_TOKEN" # a crates.io API token
+  directory = "." # the directory of the crate
+}
+`,
+	"render": `render = {
+  api_key = "$RENDER_API_KEY" # a Render API key
+  service_id = "srv-xxxxxxxx" # the ID of the service to deploy
+}
+`,
+	"exec_plugin": `exec_plugin = {
+  command = "./deploy-plugin" # the plugin binary
+  config = { # passed to the plugin as JSON on its stdin
+    target = "production"
+  }
+}
+`,
+	"ansible": `ansible = {
+  playbook = "deploy.yml"
+  inventory = "inventory/production" # default to $ANSIBLE_INVENTORY, or the inventory of ansible.cfg
+  extra_vars = {
+    version = "$ROCKET_COMMIT_SHORT"
+  }
+}
+`,
+	"sentry": `sentry = {
+  auth_token = "$SENTRY_AUTH_TOKEN" # a Sentry auth token with the project:releases scope
+  org = "my-org"
+  project = "my-project"
+  release = "my-app@$ROCKET_LAST_TAG" # default to $ROCKET_COMMIT_HASH
+  source_maps_dir = "dist" # the directory of the minified files and their source maps
+}
+`,
+	"github_pages": `github_pages = {
+  api_key = "$GITHUB_API_KEY" # a GitHub token allowed to push to the repository
+  directory = "site" # the directory of the built site
+  branch = "gh-pages"
+}
+`,
+}
+
+// InitConfig returns a commented configuration file with a section, with placeholder values, for
+// each of the given providers (e.g. aws_s3, docker)
+func InitConfig(providers []string) (string, error) {
+	sections := []string{initHeader}
+	seen := map[string]bool{}
+
+	for _, provider := range providers {
+		provider = strings.TrimSpace(provider)
+		if seen[provider] {
+			continue
+		}
+		template, ok := initTemplates[provider]
+		if !ok {
+			names := make([]string, 0, len(initTemplates))
+			for name := range initTemplates {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return "", fmt.Errorf("unknown provider %s, the available providers are: %s", provider, strings.Join(names, ", "))
+		}
+		seen[provider] = true
+		sections = append(sections, template)
+	}
+
+	return strings.Join(sections, "\n"), nil
+}
+
+// WriteInitConfig writes the configuration file returned by InitConfig to path.
+// It fails if the file already exists
+func WriteInitConfig(path string, providers []string) error {
+	content, err := InitConfig(providers)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%s already exists", path)
+		}
+		return err
+	}
+	if _, err = file.WriteString(content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
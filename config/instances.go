@@ -0,0 +1,144 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// splitInstances replaces the providers written as arrays (e.g. [[aws_s3]]) in raw, the configuration
+// file decoded without a schema, by their first instance. The other instances are returned grouped
+// by index, as configuration documents holding only providers
+func splitInstances(raw interface{}, tag string) []map[string]interface{} {
+	ret := []map[string]interface{}{}
+	t := reflect.TypeOf(Config{})
+
+	for key, value := range rawMap(raw) {
+		field, ok := fieldByKey(t, key, tag)
+		list, isList := value.([]interface{})
+		if !ok || !isList || !isProvider(field) {
+			continue
+		}
+		if len(list) == 0 {
+			setRawKey(raw, key, nil)
+			continue
+		}
+		setRawKey(raw, key, list[0])
+		for i, instance := range list[1:] {
+			for len(ret) <= i {
+				ret = append(ret, map[string]interface{}{})
+			}
+			ret[i][key] = instance
+		}
+	}
+	return ret
+}
+
+// isProvider returns true if the field of Config is a provider which can have several instances
+func isProvider(field reflect.StructField) bool {
+	t := field.Type
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	_, ok := t.Elem().FieldByName("When")
+	return ok
+}
+
+// Providers returns the names of the providers set in the configuration, in the order of the fields
+// of Config, followed by the additional instances named after their index, e.g: aws_s3[1].
+// The providers are found from the fields of Config, so the new ones are listed without changes here
+func (conf Config) Providers() []string {
+	ret := providerNames(conf)
+	for index, instance := range conf.Instances {
+		for _, name := range providerNames(instance) {
+			ret = append(ret, instanceField(name, index+1))
+		}
+	}
+	return ret
+}
+
+// providerNames returns the names of the providers set in conf, without its additional instances
+func providerNames(conf Config) []string {
+	ret := []string{}
+	v := reflect.ValueOf(conf)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Name == "Script" && len(conf.Script) != 0 || isProvider(field) && !v.Field(i).IsNil() {
+			ret = append(ret, tagName(field, "san"))
+		}
+	}
+	return ret
+}
+
+// setRawKey sets (or deletes if value is nil) the key of a table returned by the decoders
+func setRawKey(raw interface{}, key string, value interface{}) {
+	switch m := raw.(type) {
+	case map[string]interface{}:
+		if value == nil {
+			delete(m, key)
+		} else {
+			m[key] = value
+		}
+	case map[interface{}]interface{}:
+		if value == nil {
+			delete(m, key)
+		} else {
+			m[key] = value
+		}
+	}
+}
+
+// decodeRaw decodes a configuration file decoded without a schema into a Config. It goes through
+// JSON, the json tags having the same keys as the san and yaml ones
+func decodeRaw(raw interface{}) (Config, error) {
+	var ret Config
+	data, err := json.Marshal(jsonValue(raw))
+	if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(data, &ret)
+	return ret, err
+}
+
+// jsonValue converts the tables of v, recursively, to map[string]interface{} so it can be encoded as JSON
+func jsonValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+		ret := map[string]interface{}{}
+		for key, elem := range rawMap(value) {
+			ret[key] = jsonValue(elem)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(value))
+		for i, elem := range value {
+			ret[i] = jsonValue(elem)
+		}
+		return ret
+	}
+	return v
+}
+
+// Selected returns true if the provider named name (e.g. aws_s3 or aws_s3[1]) is selected by conf.Only
+// and conf.Skip
+func (conf Config) Selected(name string) bool {
+	if len(conf.Only) != 0 && !matchProvider(name, conf.Only) {
+		return false
+	}
+	return !matchProvider(name, conf.Skip)
+}
+
+// matchProvider returns true if one of the selectors is the name of the provider, or its name without
+// the index of the instance, which selects all the instances
+func matchProvider(name string, selectors []string) bool {
+	base := name
+	if i := strings.Index(name, "["); i != -1 {
+		base = name[:i]
+	}
+	for _, selector := range selectors {
+		if selector == name || selector == base {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"reflect"
+)
+
+// Merge returns a copy of conf overridden by other, which is how the environments and the includes
+// are applied. Neither conf nor other are modified:
+//   - the pointers set in other replace the ones of conf, even to a zero value: a provider (e.g. Heroku)
+//     or a section (e.g. Notify) of other replaces the one of conf wholesale, its fields are not merged
+//   - the maps (e.g. Env) are merged key by key, the values of other winning
+//   - the non-nil slices of other (e.g. BeforeHooks, Include, Instances) replace the ones of conf wholesale
+//   - the plain values (e.g. DryRun) of other replace the ones of conf if they are not the zero value
+func (conf Config) Merge(other Config) Config {
+	return merge(conf, other)
+}
+
+// merge returns base overridden by override, see Config.Merge
+func merge(base, override Config) Config {
+	ret := reflect.New(reflect.TypeOf(base)).Elem()
+	ret.Set(reflect.ValueOf(base))
+	mergeValue(ret, reflect.ValueOf(override))
+	return ret.Interface().(Config)
+}
+
+func mergeValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if !src.IsNil() {
+			dst.Set(src)
+		}
+	case reflect.Struct:
+		for i := 0; i < src.NumField(); i++ {
+			if dst.Field(i).CanSet() {
+				mergeValue(dst.Field(i), src.Field(i))
+			}
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		m := reflect.MakeMap(src.Type())
+		if !dst.IsNil() {
+			for _, key := range dst.MapKeys() {
+				m.SetMapIndex(key, dst.MapIndex(key))
+			}
+		}
+		for _, key := range src.MapKeys() {
+			m.SetMapIndex(key, src.MapIndex(key))
+		}
+		dst.Set(m)
+	case reflect.Slice:
+		if !src.IsNil() {
+			dst.Set(src)
+		}
+	default:
+		if src.Interface() != reflect.Zero(src.Type()).Interface() {
+			dst.Set(src)
+		}
+	}
+}
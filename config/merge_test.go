@@ -0,0 +1,193 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// jsonString returns the JSON representation of conf, without redacting it like Config.String
+func jsonString(conf Config) string {
+	data, err := json.Marshal(conf)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     Config
+		other    Config
+		expected Config
+	}{
+		// pointers
+		{
+			name:     "nil pointer of other keeps the base one",
+			base:     Config{LogLevel: stringPtr("debug"), Retries: intPtr(3)},
+			other:    Config{},
+			expected: Config{LogLevel: stringPtr("debug"), Retries: intPtr(3)},
+		},
+		{
+			name:     "set pointer of other replaces the base one",
+			base:     Config{LogLevel: stringPtr("debug"), Retries: intPtr(3)},
+			other:    Config{LogLevel: stringPtr("error")},
+			expected: Config{LogLevel: stringPtr("error"), Retries: intPtr(3)},
+		},
+		{
+			name:     "set pointer of other to a zero value replaces the base one",
+			base:     Config{Retries: intPtr(3), Concurrency: intPtr(2)},
+			other:    Config{Retries: intPtr(0)},
+			expected: Config{Retries: intPtr(0), Concurrency: intPtr(2)},
+		},
+		{
+			name:     "set pointer of other with a nil base",
+			base:     Config{},
+			other:    Config{Proxy: stringPtr("http://proxy:3128")},
+			expected: Config{Proxy: stringPtr("http://proxy:3128")},
+		},
+		// plain values
+		{
+			name:     "plain values of other replace the base ones unless zero",
+			base:     Config{Description: "base", DryRun: true},
+			other:    Config{Description: "other"},
+			expected: Config{Description: "other", DryRun: true},
+		},
+		// maps
+		{
+			name:     "maps are merged, other winning",
+			base:     Config{Env: map[string]string{"A": "base", "B": "base"}},
+			other:    Config{Env: map[string]string{"B": "other", "C": "other"}},
+			expected: Config{Env: map[string]string{"A": "base", "B": "other", "C": "other"}},
+		},
+		{
+			name:     "nil map of other keeps the base one",
+			base:     Config{Env: map[string]string{"A": "base"}},
+			other:    Config{},
+			expected: Config{Env: map[string]string{"A": "base"}},
+		},
+		{
+			name:     "map of other with a nil base",
+			base:     Config{},
+			other:    Config{Env: map[string]string{"A": "other"}},
+			expected: Config{Env: map[string]string{"A": "other"}},
+		},
+		// slices
+		{
+			name:     "slices of other replace the base ones",
+			base:     Config{BeforeHooks: []string{"make", "make test"}, Order: []string{"docker"}},
+			other:    Config{BeforeHooks: []string{"make release"}},
+			expected: Config{BeforeHooks: []string{"make release"}, Order: []string{"docker"}},
+		},
+		{
+			name:     "empty slice of other replaces the base one",
+			base:     Config{Skip: []string{"heroku"}},
+			other:    Config{Skip: []string{}},
+			expected: Config{Skip: []string{}},
+		},
+		{
+			name:     "nil slice of other keeps the base one",
+			base:     Config{Only: []string{"heroku"}},
+			other:    Config{},
+			expected: Config{Only: []string{"heroku"}},
+		},
+		// providers
+		{
+			name:     "provider of other with a nil base",
+			base:     Config{},
+			other:    Config{Heroku: &HerokuConfig{App: stringPtr("my-app")}},
+			expected: Config{Heroku: &HerokuConfig{App: stringPtr("my-app")}},
+		},
+		{
+			name:     "nil provider of other keeps the base one",
+			base:     Config{Heroku: &HerokuConfig{App: stringPtr("my-app")}},
+			other:    Config{Docker: &DockerConfig{Images: []string{"my-app"}}},
+			expected: Config{Heroku: &HerokuConfig{App: stringPtr("my-app")}, Docker: &DockerConfig{Images: []string{"my-app"}}},
+		},
+		{
+			name: "providers of other replace the base ones wholesale",
+			base: Config{AWSS3: &AWSS3Config{
+				Bucket:         stringPtr("staging"),
+				Region:         stringPtr("eu-west-1"),
+				GzipExtensions: []string{".js", ".css"},
+				Env:            map[string]string{"A": "base", "B": "base"},
+			}},
+			other: Config{AWSS3: &AWSS3Config{
+				Bucket:         stringPtr("production"),
+				GzipExtensions: []string{".html"},
+				Delete:         boolPtr(true),
+				Env:            map[string]string{"B": "other"},
+			}},
+			expected: Config{AWSS3: &AWSS3Config{
+				Bucket:         stringPtr("production"),
+				GzipExtensions: []string{".html"},
+				Delete:         boolPtr(true),
+				Env:            map[string]string{"B": "other"},
+			}},
+		},
+		{
+			name: "sections of other replace the base ones wholesale",
+			base: Config{Notify: &NotifyConfig{
+				Slack:   &NotifySlack{WebhookURL: stringPtr("https://hooks.slack.com/base")},
+				Discord: &NotifyDiscord{WebhookURL: stringPtr("https://discord.com/base")},
+			}},
+			other: Config{Notify: &NotifyConfig{
+				Slack: &NotifySlack{WebhookURL: stringPtr("https://hooks.slack.com/other")},
+			}},
+			expected: Config{Notify: &NotifyConfig{
+				Slack: &NotifySlack{WebhookURL: stringPtr("https://hooks.slack.com/other")},
+			}},
+		},
+		{
+			name:     "script of other replaces the base one",
+			base:     Config{Script: ScriptConfig{"make deploy"}},
+			other:    Config{Script: ScriptConfig{"make deploy-production"}},
+			expected: Config{Script: ScriptConfig{"make deploy-production"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.base.Merge(test.other)
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("Merge() = %s, expected %s", jsonString(got), jsonString(test.expected))
+			}
+		})
+	}
+}
+
+func TestMergeDoesNotModify(t *testing.T) {
+	base := Config{
+		Env:    map[string]string{"A": "base"},
+		AWSS3:  &AWSS3Config{Bucket: stringPtr("staging"), Env: map[string]string{"A": "base"}},
+		Notify: &NotifyConfig{Slack: &NotifySlack{WebhookURL: stringPtr("https://hooks.slack.com/base")}},
+	}
+	other := Config{
+		Env:    map[string]string{"A": "other"},
+		AWSS3:  &AWSS3Config{Bucket: stringPtr("production"), Env: map[string]string{"A": "other"}},
+		Notify: &NotifyConfig{Slack: &NotifySlack{WebhookURL: stringPtr("https://hooks.slack.com/other")}},
+	}
+
+	base.Merge(other)
+
+	if base.Env["A"] != "base" || *base.AWSS3.Bucket != "staging" || base.AWSS3.Env["A"] != "base" ||
+		*base.Notify.Slack.WebhookURL != "https://hooks.slack.com/base" {
+		t.Errorf("the base configuration was modified: %s", jsonString(base))
+	}
+	if other.Env["A"] != "other" || *other.AWSS3.Bucket != "production" || other.AWSS3.Env["A"] != "other" {
+		t.Errorf("the other configuration was modified: %s", jsonString(other))
+	}
+}
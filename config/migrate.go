@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+)
+
+// Warning is a non fatal problem of the configuration, like the use of a deprecated field
+type Warning struct {
+	// Field is the path of the field, e.g: zeit_now.token
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (warning Warning) String() string {
+	return warning.Message
+}
+
+// Migrate detects the deprecated sections and fields of the configuration and, where possible,
+// maps their values to their replacement. It returns a warning for each of them with the suggested
+// replacement
+func (conf *Config) Migrate() []Warning {
+	warnings := migrateZeitNow(conf)
+
+	for i := range conf.Instances {
+		for _, warning := range conf.Instances[i].Migrate() {
+			field := instanceField(warning.Field, i+1)
+			warnings = append(warnings, Warning{field, strings.Replace(warning.Message, warning.Field, field, -1)})
+		}
+	}
+
+	return warnings
+}
+
+// migrateZeitNow maps the `zeit_now` section, deprecated since ZEIT was renamed to Vercel, to
+// the `vercel` one. The section is only migrated if none of its fields would be lost, otherwise the
+// zeit_now provider keeps deploying it. Configuring both zeit_now and vercel fails the validation
+func migrateZeitNow(conf *Config) []Warning {
+	if conf.ZeitNow == nil || conf.Vercel != nil {
+		return nil
+	}
+
+	zeitNow := conf.ZeitNow
+	// the fields of zeit_now without vercel equivalent
+	kept := []string{}
+	for _, field := range []struct {
+		name string
+		set  bool
+	}{
+		{"public", zeitNow.Public != nil},
+		{"deployment_type", zeitNow.DeploymentType != nil},
+		{"force_new", zeitNow.ForceNew != nil},
+		{"engines", zeitNow.Engines != nil},
+		{"session_affinity", zeitNow.SessionAffinity != nil},
+	} {
+		if field.set {
+			kept = append(kept, field.name)
+		}
+	}
+	if len(kept) != 0 {
+		return []Warning{{"zeit_now", fmt.Sprintf(
+			"zeit_now is deprecated, please use vercel instead. It was not migrated to vercel as %s has no vercel equivalent",
+			strings.Join(kept, ", "),
+		)}}
+	}
+
+	// the environment variables of zeit_now are kept as fallbacks
+	token := "$ZEIT_TOKEN"
+	if zeitNow.Token != nil {
+		token = *zeitNow.Token
+	}
+	projectName := "$ZEIT_NOW_NAME"
+	if zeitNow.Name != nil {
+		projectName = *zeitNow.Name
+	}
+
+	conf.Vercel = &VercelConfig{
+		Token:       &token,
+		Directory:   zeitNow.Directory,
+		ProjectName: &projectName,
+		Timeout:     zeitNow.Timeout,
+		Env:         zeitNow.Env,
+		When:        zeitNow.When,
+		Alias:       zeitNow.Alias,
+	}
+	conf.ZeitNow = nil
+
+	return []Warning{{"zeit_now", "zeit_now is deprecated and was migrated to vercel, please use vercel instead"}}
+}
+
+// logWarnings logs the warnings of the configuration
+func logWarnings(warnings []Warning) {
+	for _, warning := range warnings {
+		log.With("field", warning.Field).Warn(warning.Message)
+	}
+}
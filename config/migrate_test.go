@@ -0,0 +1,84 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMigrateZeitNow(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     Config
+		expected Config
+		warnings int
+	}{
+		{
+			name:     "without zeit_now",
+			conf:     Config{Vercel: &VercelConfig{ProjectName: stringPtr("my-app")}},
+			expected: Config{Vercel: &VercelConfig{ProjectName: stringPtr("my-app")}},
+		},
+		{
+			name: "migrated without losing a setting",
+			conf: Config{ZeitNow: &ZeitNowConfig{
+				Name:      stringPtr("my-app"),
+				Directory: stringPtr("dist"),
+				Alias:     []string{"my-app.com"},
+				Env:       map[string]string{"NODE_ENV": "production"},
+			}},
+			expected: Config{Vercel: &VercelConfig{
+				Token:       stringPtr("$ZEIT_TOKEN"),
+				ProjectName: stringPtr("my-app"),
+				Directory:   stringPtr("dist"),
+				Alias:       []string{"my-app.com"},
+				Env:         map[string]string{"NODE_ENV": "production"},
+			}},
+			warnings: 1,
+		},
+		{
+			name:     "kept as a setting would be lost",
+			conf:     Config{ZeitNow: &ZeitNowConfig{Name: stringPtr("my-app"), Public: boolPtr(true)}},
+			expected: Config{ZeitNow: &ZeitNowConfig{Name: stringPtr("my-app"), Public: boolPtr(true)}},
+			warnings: 1,
+		},
+		{
+			name: "kept with vercel",
+			conf: Config{
+				ZeitNow: &ZeitNowConfig{Name: stringPtr("legacy")},
+				Vercel:  &VercelConfig{ProjectName: stringPtr("my-app")},
+			},
+			expected: Config{
+				ZeitNow: &ZeitNowConfig{Name: stringPtr("legacy")},
+				Vercel:  &VercelConfig{ProjectName: stringPtr("my-app")},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warnings := test.conf.Migrate()
+			if len(warnings) != test.warnings {
+				t.Errorf("%d warning(s), expected %d: %v", len(warnings), test.warnings, warnings)
+			}
+			if !reflect.DeepEqual(test.conf, test.expected) {
+				t.Errorf("Migrate() = %s, expected %s", jsonString(test.conf), jsonString(test.expected))
+			}
+		})
+	}
+}
+
+func TestValidateZeitNowWithVercel(t *testing.T) {
+	conf := Config{
+		ZeitNow: &ZeitNowConfig{Token: stringPtr("token"), Name: stringPtr("legacy")},
+		Vercel:  &VercelConfig{Token: stringPtr("token"), ProjectName: stringPtr("my-app")},
+	}
+	err, ok := conf.Validate().(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a *ValidationError, got %v", conf.Validate())
+	}
+	for _, fieldErr := range err.Errors {
+		if fieldErr.Field == "zeit_now" {
+			return
+		}
+	}
+	t.Errorf("no error for zeit_now: %v", err)
+}
@@ -0,0 +1,17 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ParseFileMode parses the octal permissions of a file, e.g: "0644" or "755"
+func ParseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(strings.TrimSpace(s), 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("'%s' is not a valid octal file mode, e.g: 0644", s)
+	}
+	return os.FileMode(mode), nil
+}
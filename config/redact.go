@@ -0,0 +1,296 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+const redacted = "***"
+
+// String returns the JSON representation of the configuration with all the secrets
+// (API keys, passwords, tokens...) replaced by ***, so it can safely be logged
+func (conf Config) String() string {
+	buf, err := json.Marshal(conf.Redacted())
+	if err != nil {
+		return err.Error()
+	}
+	return string(buf)
+}
+
+// Redacted returns a copy of the configuration with all the secrets, and the values of the env
+// variables and of the other free-form tables (build args, extra vars...), replaced by ***
+func (conf Config) Redacted() Config {
+	// the env variables often hold credentials, only their names are kept
+	conf.Env = redactValues(conf.Env)
+	redactProvidersEnv(&conf)
+
+	// the URL of the proxy may contain credentials
+	if conf.Proxy != nil && strings.Contains(*conf.Proxy, "@") {
+		conf.Proxy = redact(conf.Proxy)
+	}
+
+	if conf.Heroku != nil {
+		v := *conf.Heroku
+		v.APIKey = redact(v.APIKey)
+		conf.Heroku = &v
+	}
+
+	if conf.GitHubReleases != nil {
+		v := *conf.GitHubReleases
+		v.APIKey = redact(v.APIKey)
+		v.GPGKey = redact(v.GPGKey)
+		conf.GitHubReleases = &v
+	}
+
+	if conf.Docker != nil {
+		v := *conf.Docker
+		v.Password = redact(v.Password)
+		// the build args are the usual way to pass secrets to the build
+		v.BuildArgs = redactValues(v.BuildArgs)
+		conf.Docker = &v
+	}
+
+	if conf.AWSS3 != nil {
+		v := *conf.AWSS3
+		v.SecretAccessKey = redact(v.SecretAccessKey)
+		conf.AWSS3 = &v
+	}
+
+	if conf.ZeitNow != nil {
+		v := *conf.ZeitNow
+		v.Token = redact(v.Token)
+		conf.ZeitNow = &v
+	}
+
+	if conf.AWSEB != nil {
+		v := *conf.AWSEB
+		v.SecretAccessKey = redact(v.SecretAccessKey)
+		conf.AWSEB = &v
+	}
+
+	if conf.GCS != nil {
+		v := *conf.GCS
+		v.CredentialsJSON = redact(v.CredentialsJSON)
+		conf.GCS = &v
+	}
+
+	if conf.GitLabReleases != nil {
+		v := *conf.GitLabReleases
+		v.APIKey = redact(v.APIKey)
+		conf.GitLabReleases = &v
+	}
+
+	if conf.AzureBlob != nil {
+		v := *conf.AzureBlob
+		v.AccountKey = redact(v.AccountKey)
+		v.SASToken = redact(v.SASToken)
+		conf.AzureBlob = &v
+	}
+
+	if conf.Cloudflare != nil {
+		v := *conf.Cloudflare
+		v.APIToken = redact(v.APIToken)
+		conf.Cloudflare = &v
+	}
+
+	if conf.FTP != nil {
+		v := *conf.FTP
+		v.Password = redact(v.Password)
+		conf.FTP = &v
+	}
+
+	if conf.SSH != nil {
+		v := *conf.SSH
+		v.PrivateKey = redact(v.PrivateKey)
+		conf.SSH = &v
+	}
+
+	if conf.Netlify != nil {
+		v := *conf.Netlify
+		v.AccessToken = redact(v.AccessToken)
+		conf.Netlify = &v
+	}
+
+	if conf.PyPI != nil {
+		v := *conf.PyPI
+		v.Password = redact(v.Password)
+		v.Token = redact(v.Token)
+		conf.PyPI = &v
+	}
+
+	if conf.NPM != nil {
+		v := *conf.NPM
+		v.Token = redact(v.Token)
+		conf.NPM = &v
+	}
+
+	if conf.Vercel != nil {
+		v := *conf.Vercel
+		v.Token = redact(v.Token)
+		conf.Vercel = &v
+	}
+
+	if conf.Firebase != nil {
+		v := *conf.Firebase
+		v.Token = redact(v.Token)
+		conf.Firebase = &v
+	}
+
+	if conf.HTTP != nil {
+		v := *conf.HTTP
+		// headers often contain credentials (Authorization...), and so may the body
+		v.Headers = redactValues(v.Headers)
+		v.Body = redact(v.Body)
+		conf.HTTP = &v
+	}
+
+	if conf.Fly != nil {
+		v := *conf.Fly
+		v.Token = redact(v.Token)
+		conf.Fly = &v
+	}
+
+	if conf.Kubernetes != nil {
+		v := *conf.Kubernetes
+		// an inline kubeconfig contains the credentials of the cluster
+		if v.Kubeconfig != nil && strings.Contains(*v.Kubeconfig, "\n") {
+			v.Kubeconfig = redact(v.Kubeconfig)
+		}
+		conf.Kubernetes = &v
+	}
+
+	if conf.Maven != nil {
+		v := *conf.Maven
+		v.Password = redact(v.Password)
+		conf.Maven = &v
+	}
+
+	if conf.Cargo != nil {
+		v := *conf.Cargo
+		v.Token = redact(v.Token)
+		conf.Cargo = &v
+	}
+
+	if conf.Render != nil {
+		v := *conf.Render
+		v.APIKey = redact(v.APIKey)
+		conf.Render = &v
+	}
+
+	if conf.ExecPlugin != nil {
+		v := *conf.ExecPlugin
+		v.Config = redactValues(v.Config)
+		conf.ExecPlugin = &v
+	}
+
+	if conf.Ansible != nil {
+		v := *conf.Ansible
+		v.ExtraVars = redactValues(v.ExtraVars)
+		conf.Ansible = &v
+	}
+
+	if conf.Sentry != nil {
+		v := *conf.Sentry
+		v.AuthToken = redact(v.AuthToken)
+		conf.Sentry = &v
+	}
+
+	if conf.GitHubPages != nil {
+		v := *conf.GitHubPages
+		v.APIKey = redact(v.APIKey)
+		conf.GitHubPages = &v
+	}
+
+	if conf.GitHubDeployment != nil {
+		v := *conf.GitHubDeployment
+		v.APIKey = redact(v.APIKey)
+		conf.GitHubDeployment = &v
+	}
+
+	if conf.Notify != nil {
+		v := *conf.Notify
+		if v.Slack != nil {
+			slack := *v.Slack
+			slack.WebhookURL = redact(slack.WebhookURL)
+			v.Slack = &slack
+		}
+		if v.Discord != nil {
+			discord := *v.Discord
+			discord.WebhookURL = redact(discord.WebhookURL)
+			v.Discord = &discord
+		}
+		if v.Email != nil {
+			email := *v.Email
+			email.Password = redact(email.Password)
+			v.Email = &email
+		}
+		if v.Telegram != nil {
+			telegram := *v.Telegram
+			telegram.BotToken = redact(telegram.BotToken)
+			v.Telegram = &telegram
+		}
+		if v.Datadog != nil {
+			datadog := *v.Datadog
+			datadog.APIKey = redact(datadog.APIKey)
+			v.Datadog = &datadog
+		}
+		conf.Notify = &v
+	}
+
+	if conf.Environments != nil {
+		environments := make(map[string]Config, len(conf.Environments))
+		for name, environment := range conf.Environments {
+			environments[name] = environment.Redacted()
+		}
+		conf.Environments = environments
+	}
+
+	return conf
+}
+
+// redact returns *** if value is set, the empty values are kept as is
+func redact(value *string) *string {
+	if value == nil || *value == "" {
+		return value
+	}
+	v := redacted
+	return &v
+}
+
+// redactValues returns a copy of values with all the values replaced by ***, only the keys are kept
+func redactValues(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	ret := make(map[string]string, len(values))
+	for key := range values {
+		ret[key] = redacted
+	}
+	return ret
+}
+
+// redactProvidersEnv redacts the env of each provider of conf. The providers are found from the fields
+// of Config, so the new ones are redacted without changes here
+func redactProvidersEnv(conf *Config) {
+	v := reflect.ValueOf(conf).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() != reflect.Ptr || field.IsNil() || field.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		envField := field.Elem().FieldByName("Env")
+		if !envField.IsValid() {
+			continue
+		}
+		env, ok := envField.Interface().(map[string]string)
+		if !ok || env == nil {
+			continue
+		}
+		// copy the provider so the configuration is not modified
+		copied := reflect.New(field.Elem().Type())
+		copied.Elem().Set(field.Elem())
+		copied.Elem().FieldByName("Env").Set(reflect.ValueOf(redactValues(env)))
+		field.Set(copied)
+	}
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactedTables(t *testing.T) {
+	conf := Config{
+		Docker:     &DockerConfig{BuildArgs: map[string]string{"NPM_TOKEN": "secret"}},
+		HTTP:       &HTTPConfig{Headers: map[string]string{"Authorization": "Bearer secret"}, Body: stringPtr(`{"token":"secret"}`)},
+		ExecPlugin: &ExecPluginConfig{Config: map[string]string{"api_key": "secret"}},
+		Ansible:    &AnsibleConfig{ExtraVars: map[string]string{"db_password": "secret"}},
+	}
+
+	got := conf.Redacted()
+	expected := Config{
+		Docker:     &DockerConfig{BuildArgs: map[string]string{"NPM_TOKEN": redacted}},
+		HTTP:       &HTTPConfig{Headers: map[string]string{"Authorization": redacted}, Body: stringPtr(redacted)},
+		ExecPlugin: &ExecPluginConfig{Config: map[string]string{"api_key": redacted}},
+		Ansible:    &AnsibleConfig{ExtraVars: map[string]string{"db_password": redacted}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Redacted() = %s, expected %s", jsonString(got), jsonString(expected))
+	}
+
+	// the configuration itself is not modified
+	if conf.Docker.BuildArgs["NPM_TOKEN"] != "secret" || *conf.HTTP.Body != `{"token":"secret"}` ||
+		conf.ExecPlugin.Config["api_key"] != "secret" || conf.Ansible.ExtraVars["db_password"] != "secret" {
+		t.Errorf("the configuration was modified: %s", jsonString(conf))
+	}
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bloom42/astroflow-go/log"
+)
+
+// remoteCacheTTL is how long a fetched remote include is reused before being fetched again
+const remoteCacheTTL = 5 * time.Minute
+
+var remoteClient = &http.Client{Timeout: 30 * time.Second}
+
+// isRemote returns true if the configuration file is an https:// URL
+func isRemote(file string) bool {
+	return strings.HasPrefix(file, "https://")
+}
+
+// resolveRemote resolves the include ref against the URL of the remote including file base
+func resolveRemote(base, ref string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	ret := baseURL.ResolveReference(refURL).String()
+	if !isRemote(ret) {
+		return "", fmt.Errorf("%s: included file %s should be an https:// URL", base, ref)
+	}
+	return ret, nil
+}
+
+// remoteExt returns the extension of the path of the URL, without its query, which selects the format
+func remoteExt(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	return path.Ext(u.Path)
+}
+
+// fetchRemote returns the content of the remote configuration file. It is cached for remoteCacheTTL in
+// the user's cache directory, so successive runs do not fetch it again
+func fetchRemote(rawurl string) ([]byte, error) {
+	cachePath := remoteCachePath(rawurl)
+	if cachePath != "" {
+		if stat, err := os.Stat(cachePath); err == nil && time.Since(stat.ModTime()) < remoteCacheTTL {
+			log.With("url", rawurl, "cache", cachePath).Debug("using the cached remote include")
+			return ioutil.ReadFile(cachePath)
+		}
+	}
+
+	log.With("url", rawurl).Debug("fetching remote include")
+	res, err := remoteClient.Get(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %s", rawurl, err.Error())
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %s", rawurl, err.Error())
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status code %d: %s", rawurl, res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if cachePath != "" {
+		// a cache failure only means the file is fetched again next time
+		err = os.MkdirAll(filepath.Dir(cachePath), 0700)
+		if err == nil {
+			err = ioutil.WriteFile(cachePath, body, 0600)
+		}
+		if err != nil {
+			log.With("err", err, "cache", cachePath).Debug("error caching the remote include")
+		}
+	}
+	return body, nil
+}
+
+// remoteCachePath returns the path of the cached copy of the remote configuration file, or an empty string
+// if there is no cache directory
+func remoteCachePath(rawurl string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "rocket", "includes", fmt.Sprintf("%x", sha256.Sum256([]byte(rawurl))))
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SecretResolver returns the secret referenced by uri, e.g: vault://secret/data/deploy#api_key
+type SecretResolver func(uri string) (string, error)
+
+// SecretResolvers are the secret resolvers, by URI scheme. The configuration values which, after env
+// expansion, start with one of the schemes followed by :// are replaced by the resolved secret
+var SecretResolvers = map[string]SecretResolver{
+	"vault": resolveVault,
+	"age":   resolveAge,
+}
+
+// resolveSecrets replaces the secret URIs of the configuration by their value. The environments
+// are skipped as they are merged into the configuration before
+func resolveSecrets(conf *Config) error {
+	return resolveSecretsValue(reflect.ValueOf(conf).Elem(), "")
+}
+
+func resolveSecretsValue(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Elem().Kind() == reflect.String {
+			secret, ok, err := resolveSecret(v.Elem().String())
+			if err != nil {
+				return fmt.Errorf("%s: %s", path, err.Error())
+			}
+			if ok {
+				v.Set(reflect.ValueOf(&secret))
+			}
+			return nil
+		}
+		// copy the struct as it may be shared with the environments
+		copied := reflect.New(v.Elem().Type())
+		copied.Elem().Set(v.Elem())
+		if err := resolveSecretsValue(copied.Elem(), path); err != nil {
+			return err
+		}
+		v.Set(copied)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if t.Field(i).Name == "Environments" || !v.Field(i).CanSet() {
+				continue
+			}
+			name := strings.Split(t.Field(i).Tag.Get("san"), ",")[0]
+			if path != "" {
+				name = path + "." + name
+			}
+			if err := resolveSecretsValue(v.Field(i), name); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(copied, v)
+		for i := 0; i < copied.Len(); i++ {
+			if err := resolveSecretsValue(copied.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		v.Set(copied)
+	case reflect.Map:
+		if v.IsNil() || v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		copied := reflect.MakeMap(v.Type())
+		for _, key := range v.MapKeys() {
+			value := v.MapIndex(key).String()
+			secret, ok, err := resolveSecret(value)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %s", path, key.String(), err.Error())
+			}
+			if ok {
+				value = secret
+			}
+			copied.SetMapIndex(key, reflect.ValueOf(value).Convert(v.Type().Elem()))
+		}
+		v.Set(copied)
+	case reflect.String:
+		secret, ok, err := resolveSecret(v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err.Error())
+		}
+		if ok {
+			v.SetString(secret)
+		}
+	}
+	return nil
+}
+
+// resolveSecret returns the secret referenced by value if it's a secret URI. ok is false otherwise.
+// The dollars of the secret are escaped so it's not modified by the env expansion of the providers
+func resolveSecret(value string) (secret string, ok bool, err error) {
+	uri := ExpandEnv(value)
+	i := strings.Index(uri, "://")
+	if i == -1 {
+		return "", false, nil
+	}
+	resolver, ok := SecretResolvers[uri[:i]]
+	if !ok {
+		return "", false, nil
+	}
+	secret, err = resolver(uri)
+	if err != nil {
+		return "", false, err
+	}
+	return strings.Replace(secret, "$", "$$", -1), true, nil
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// unknownKeys returns the keys of raw (the configuration file decoded without a schema) which do
+// not map to any field of t, as dotted paths. tag is the struct tag holding the keys names
+func unknownKeys(path string, raw interface{}, t reflect.Type, tag string) []string {
+	ret := []string{}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for key, value := range rawMap(raw) {
+			field, ok := fieldByKey(t, key, tag)
+			if !ok {
+				ret = append(ret, path+key)
+				continue
+			}
+			ret = append(ret, unknownKeys(path+key+".", value, field.Type, tag)...)
+		}
+	case reflect.Map:
+		for key, value := range rawMap(raw) {
+			ret = append(ret, unknownKeys(path+key+".", value, t.Elem(), tag)...)
+		}
+	case reflect.Slice:
+		if values, ok := raw.([]interface{}); ok {
+			for i, value := range values {
+				ret = append(ret, unknownKeys(fmt.Sprintf("%s%d.", path, i), value, t.Elem(), tag)...)
+			}
+		}
+	}
+
+	sort.Strings(ret)
+	return ret
+}
+
+// rawMap converts the tables returned by the different decoders to map[string]interface{}.
+// Values which are not tables return nil
+func rawMap(raw interface{}) map[string]interface{} {
+	switch m := raw.(type) {
+	case map[string]interface{}:
+		return m
+	case map[interface{}]interface{}:
+		ret := make(map[string]interface{}, len(m))
+		for key, value := range m {
+			ret[fmt.Sprint(key)] = value
+		}
+		return ret
+	}
+	return nil
+}
+
+// fieldByKey returns the field of the struct type t whose tag name is key
+func fieldByKey(t reflect.Type, key, tag string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if tagName(field, tag) == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func tagName(field reflect.StructField, tag string) string {
+	return strings.Split(field.Tag.Get(tag), ",")[0]
+}
+
+// suggest returns the key of the struct type t the closest to the last part of the path,
+// or "" if none is close enough
+func suggest(path string, t reflect.Type, tag string) string {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := fieldByKey(t, part, tag)
+			if !ok {
+				return ""
+			}
+			t = field.Type
+		case reflect.Map, reflect.Slice:
+			t = t.Elem()
+		default:
+			return ""
+		}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return ""
+	}
+
+	key := parts[len(parts)-1]
+	best, bestDistance := "", 3
+	for i := 0; i < t.NumField(); i++ {
+		name := tagName(t.Field(i), tag)
+		if d := distance(key, name); name != "" && d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// distance returns the Levenshtein distance between a and b
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// keyLine returns the line of the first definition of the last part of path in data, or 0 if not found
+func keyLine(data []byte, path string) int {
+	parts := strings.Split(path, ".")
+	key := parts[len(parts)-1]
+	for i, line := range strings.Split(string(data), "\n") {
+		if j := strings.Index(line, `"`+key+`"`); j != -1 && isAssignment(line[j+len(key)+2:]) {
+			return i + 1
+		}
+		line = strings.TrimLeft(line, " \t[-")
+		if strings.HasPrefix(line, key) && isAssignment(line[len(key):]) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// isAssignment returns true if s starts the value of a key
+func isAssignment(s string) bool {
+	s = strings.TrimLeft(s, " \t")
+	return s == "" || strings.HasPrefix(s, "=") || strings.HasPrefix(s, ":") || strings.HasPrefix(s, "]")
+}
+
+// strictError returns an error listing the unknown keys of the configuration file, or nil
+// if all the keys are known
+func strictError(configFilePath string, data []byte, raw interface{}, tag string) error {
+	t := reflect.TypeOf(Config{})
+	keys := unknownKeys("", raw, t, tag)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	messages := make([]string, len(keys))
+	for i, key := range keys {
+		messages[i] = key
+		if line := keyLine(data, key); line != 0 {
+			messages[i] = fmt.Sprintf("%s (line %d)", messages[i], line)
+		}
+		if suggestion := suggest(key, t, tag); suggestion != "" {
+			messages[i] = fmt.Sprintf("%s, did you mean %s?", messages[i], suggestion)
+		}
+	}
+	return fmt.Errorf("%s: unknown keys: %s", configFilePath, strings.Join(messages, "; "))
+}
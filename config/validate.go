@@ -0,0 +1,683 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// FieldError is a problem of a configuration field
+type FieldError struct {
+	// Field is the path of the field, e.g: heroku.api_key
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (err FieldError) Error() string {
+	return err.Message
+}
+
+// ValidationError is returned by Validate and lists all the problems of the configuration
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (err *ValidationError) Error() string {
+	messages := make([]string, len(err.Errors))
+	for i, fieldErr := range err.Errors {
+		messages[i] = fieldErr.Error()
+	}
+	return strings.Join(messages, ", ")
+}
+
+// Validate checks that the required fields of each configured provider are set, either directly
+// or through their environment variable fallback.
+// It returns a *ValidationError listing every problem
+func (conf Config) Validate() error {
+	errs := []FieldError{}
+
+	if conf.Concurrency != nil && *conf.Concurrency < 1 {
+		errs = append(errs, FieldError{"concurrency", "concurrency should be greater than 0"})
+	}
+
+	if conf.Retries != nil && *conf.Retries < 0 {
+		errs = append(errs, FieldError{"retries", "retries should not be negative"})
+	}
+
+	if conf.RetryBackoff != nil {
+		if _, err := time.ParseDuration(*conf.RetryBackoff); err != nil {
+			errs = append(errs, FieldError{"retry_backoff", fmt.Sprintf("retry_backoff is not a valid duration: %s", err.Error())})
+		}
+	}
+
+	if conf.Proxy != nil && !isAbsoluteURL(ExpandEnv(*conf.Proxy)) {
+		errs = append(errs, FieldError{"proxy", "proxy should be an absolute URL, e.g: http://proxy.example.com:3128"})
+	}
+
+	if conf.HealthCheck != nil {
+		errs = validateHealthCheck(errs, *conf.HealthCheck)
+	}
+
+	if conf.LogLevel != nil {
+		if _, err := ParseLogLevel(ExpandEnv(*conf.LogLevel)); err != nil {
+			errs = append(errs, FieldError{"log_level", err.Error()})
+		}
+	}
+
+	if conf.Heroku != nil {
+		errs = requireString(errs, "heroku.api_key", conf.Heroku.APIKey, "HEROKU_API_KEY")
+		errs = requireString(errs, "heroku.app", conf.Heroku.App, "HEROKU_APP")
+		for _, processType := range conf.Heroku.ProcessTypes {
+			if strings.TrimSpace(processType) == "" {
+				errs = append(errs, FieldError{"heroku.process_types", "heroku.process_types should not contain an empty process type"})
+				break
+			}
+		}
+		if conf.Heroku.Image != nil && (conf.Heroku.Container == nil || !*conf.Heroku.Container) {
+			errs = append(errs, FieldError{"heroku.image", "heroku.image requires heroku.container to be true"})
+		}
+	}
+
+	if conf.GitHubReleases != nil {
+		errs = requireString(errs, "github_releases.api_key", conf.GitHubReleases.APIKey, "GITHUB_API_KEY")
+		errs = requireString(errs, "github_releases.repo", conf.GitHubReleases.Repo, "ROCKET_GIT_REPO")
+		errs = requireString(errs, "github_releases.tag", conf.GitHubReleases.Tag, "ROCKET_LAST_TAG")
+		if conf.GitHubReleases.RateLimitRetries != nil && *conf.GitHubReleases.RateLimitRetries < 0 {
+			errs = append(errs, FieldError{"github_releases.rate_limit_retries", "github_releases.rate_limit_retries should not be negative"})
+		}
+	}
+
+	if conf.Docker != nil {
+		registryType := ""
+		if conf.Docker.RegistryType != nil {
+			registryType = ExpandEnv(*conf.Docker.RegistryType)
+		}
+		switch registryType {
+		case "", "docker":
+			if conf.Docker.Login != nil && *conf.Docker.Login {
+				errs = requireString(errs, "docker.username", conf.Docker.Username, "DOCKER_USERNAME")
+				errs = requireString(errs, "docker.password", conf.Docker.Password, "DOCKER_PASSWORD")
+			}
+		case "ecr", "gcr":
+		default:
+			errs = append(errs, FieldError{"docker.registry_type", "docker.registry_type should be docker, ecr or gcr"})
+		}
+		if len(conf.Docker.Platforms) != 0 && (conf.Docker.Buildx == nil || !*conf.Docker.Buildx) {
+			errs = append(errs, FieldError{"docker.platforms", "docker.platforms requires docker.buildx to be true"})
+		}
+	}
+
+	if conf.AWSS3 != nil {
+		errs = requireString(errs, "aws_s3.bucket", conf.AWSS3.Bucket, "AWS_S3_BUCKET")
+		errs = validateAWSRole(errs, "aws_s3", conf.AWSS3.RoleARN, conf.AWSS3.ExternalID)
+		if isSet(conf.AWSS3.ACL, "") && !isCannedACL(ExpandEnv(*conf.AWSS3.ACL)) {
+			errs = append(errs, FieldError{"aws_s3.acl", fmt.Sprintf("aws_s3.acl should be one of %s", strings.Join(cannedACLs, ", "))})
+		}
+		errs = validateEncryption(errs, "aws_s3", conf.AWSS3.ServerSideEncryption, conf.AWSS3.KMSKeyID)
+		errs = validateByteSize(errs, "aws_s3.part_size", conf.AWSS3.PartSize, minPartSize, maxPartSize)
+		errs = validateByteSize(errs, "aws_s3.multipart_threshold", conf.AWSS3.MultipartThreshold, minPartSize, maxPartSize)
+		if conf.AWSS3.UploadConcurrency != nil && *conf.AWSS3.UploadConcurrency < 1 {
+			errs = append(errs, FieldError{"aws_s3.upload_concurrency", "aws_s3.upload_concurrency should be greater than 0"})
+		}
+		for _, path := range conf.AWSS3.InvalidationPaths {
+			if !strings.HasPrefix(path, "/") {
+				errs = append(errs, FieldError{"aws_s3.invalidation_paths", fmt.Sprintf("aws_s3.invalidation_paths: %s should start with /", path)})
+			}
+		}
+		if (len(conf.AWSS3.InvalidationPaths) != 0 || conf.AWSS3.WaitForInvalidation != nil) && !isSet(conf.AWSS3.CloudFrontDistributionID, "") {
+			errs = append(errs, FieldError{"aws_s3.cloudfront_distribution_id", "aws_s3.cloudfront_distribution_id is required with invalidation_paths or wait_for_invalidation"})
+		}
+		// S3 compatible services have their own regions
+		if conf.AWSS3.Endpoint == nil {
+			errs = requireAWSRegion(errs, "aws_s3.region", conf.AWSS3.Region)
+		}
+	}
+
+	if conf.ZeitNow != nil {
+		errs = requireString(errs, "zeit_now.token", conf.ZeitNow.Token, "ZEIT_TOKEN")
+		errs = requireString(errs, "zeit_now.name", conf.ZeitNow.Name, "ZEIT_NOW_NAME")
+		// both would deploy the same project, zeit_now being the deprecated version of vercel
+		if conf.Vercel != nil {
+			errs = append(errs, FieldError{"zeit_now", "zeit_now can't be configured with vercel, please migrate it to vercel"})
+		}
+	}
+
+	if conf.AWSEB != nil {
+		errs = requireString(errs, "aws_eb.application", conf.AWSEB.Application, "AWS_EB_APPLICATION")
+		errs = requireString(errs, "aws_eb.environment", conf.AWSEB.Environment, "AWS_EB_ENVIRONMENT")
+		errs = requireString(errs, "aws_eb.s3_bucket", conf.AWSEB.S3Bucket, "AWS_S3_BUCKET")
+		errs = requireAWSRegion(errs, "aws_eb.region", conf.AWSEB.Region)
+		errs = validateAWSRole(errs, "aws_eb", conf.AWSEB.RoleARN, conf.AWSEB.ExternalID)
+		if conf.AWSEB.WaitTimeout != nil {
+			if _, err := time.ParseDuration(ExpandEnv(*conf.AWSEB.WaitTimeout)); err != nil {
+				errs = append(errs, FieldError{"aws_eb.wait_timeout", fmt.Sprintf("aws_eb.wait_timeout is not a valid duration: %s", err.Error())})
+			}
+		}
+	}
+
+	if conf.GCS != nil {
+		errs = requireString(errs, "gcs.bucket", conf.GCS.Bucket, "GCS_BUCKET")
+		errs = requireString(errs, "gcs.credentials_json", conf.GCS.CredentialsJSON, "GOOGLE_APPLICATION_CREDENTIALS")
+	}
+
+	if conf.GitLabReleases != nil {
+		errs = requireString(errs, "gitlab_releases.api_key", conf.GitLabReleases.APIKey, "GITLAB_API_KEY")
+		errs = requireString(errs, "gitlab_releases.project_id", conf.GitLabReleases.ProjectID, "ROCKET_GIT_REPO")
+		errs = requireString(errs, "gitlab_releases.tag", conf.GitLabReleases.Tag, "ROCKET_LAST_TAG")
+	}
+
+	if conf.AzureBlob != nil {
+		errs = requireString(errs, "azure_blob.account_name", conf.AzureBlob.AccountName, "AZURE_STORAGE_ACCOUNT")
+		errs = requireString(errs, "azure_blob.container", conf.AzureBlob.Container, "AZURE_STORAGE_CONTAINER")
+		if !isSet(conf.AzureBlob.AccountKey, "AZURE_STORAGE_KEY") && !isSet(conf.AzureBlob.SASToken, "AZURE_STORAGE_SAS_TOKEN") {
+			errs = append(errs, FieldError{"azure_blob.account_key", "azure_blob.account_key or azure_blob.sas_token is required"})
+		}
+	}
+
+	if conf.Cloudflare != nil {
+		errs = requireString(errs, "cloudflare.api_token", conf.Cloudflare.APIToken, "CLOUDFLARE_API_TOKEN")
+		errs = requireString(errs, "cloudflare.account_id", conf.Cloudflare.AccountID, "CLOUDFLARE_ACCOUNT_ID")
+		errs = requireString(errs, "cloudflare.project_name", conf.Cloudflare.ProjectName, "")
+	}
+
+	if conf.FTP != nil {
+		errs = requireString(errs, "ftp.host", conf.FTP.Host, "FTP_HOST")
+		if conf.FTP.Port != nil && (*conf.FTP.Port < 1 || *conf.FTP.Port > 65535) {
+			errs = append(errs, FieldError{"ftp.port", "ftp.port should be between 1 and 65535"})
+		}
+		errs = validateFileMode(errs, "ftp.file_mode", conf.FTP.FileMode)
+		errs = validateFileMode(errs, "ftp.dir_mode", conf.FTP.DirMode)
+	}
+
+	if conf.SSH != nil {
+		errs = requireString(errs, "ssh.host", conf.SSH.Host, "SSH_HOST")
+		if conf.SSH.Port != nil && (*conf.SSH.Port < 1 || *conf.SSH.Port > 65535) {
+			errs = append(errs, FieldError{"ssh.port", "ssh.port should be between 1 and 65535"})
+		}
+		errs = validateFileMode(errs, "ssh.file_mode", conf.SSH.FileMode)
+		errs = validateFileMode(errs, "ssh.dir_mode", conf.SSH.DirMode)
+	}
+
+	if conf.Netlify != nil {
+		errs = requireString(errs, "netlify.access_token", conf.Netlify.AccessToken, "NETLIFY_AUTH_TOKEN")
+		errs = requireString(errs, "netlify.site_id", conf.Netlify.SiteID, "NETLIFY_SITE_ID")
+	}
+
+	if conf.GitHubDeployment != nil {
+		errs = requireString(errs, "github_deployment.api_key", conf.GitHubDeployment.APIKey, "GITHUB_API_KEY")
+		errs = requireString(errs, "github_deployment.repo", conf.GitHubDeployment.Repo, "ROCKET_GIT_REPO")
+		errs = requireString(errs, "github_deployment.ref", conf.GitHubDeployment.Ref, "ROCKET_COMMIT_HASH")
+	}
+
+	if conf.Notify != nil && conf.Notify.Slack != nil {
+		errs = requireString(errs, "notify.slack.webhook_url", conf.Notify.Slack.WebhookURL, "SLACK_WEBHOOK_URL")
+	}
+
+	if conf.Notify != nil && conf.Notify.Discord != nil {
+		errs = requireString(errs, "notify.discord.webhook_url", conf.Notify.Discord.WebhookURL, "DISCORD_WEBHOOK_URL")
+	}
+
+	if conf.Notify != nil && conf.Notify.Email != nil {
+		email := conf.Notify.Email
+		errs = requireString(errs, "notify.email.smtp_host", email.SMTPHost, "SMTP_HOST")
+		if email.Port != nil && (*email.Port < 1 || *email.Port > 65535) {
+			errs = append(errs, FieldError{"notify.email.port", "notify.email.port should be between 1 and 65535"})
+		}
+		// the sender defaults to the username
+		from := email.From
+		if from == nil {
+			from = email.Username
+		}
+		errs = requireString(errs, "notify.email.from", from, "SMTP_USERNAME")
+		if len(email.To) == 0 {
+			errs = append(errs, FieldError{"notify.email.to", "notify.email.to is required"})
+		}
+	}
+
+	if conf.Notify != nil && conf.Notify.Telegram != nil {
+		errs = requireString(errs, "notify.telegram.bot_token", conf.Notify.Telegram.BotToken, "TELEGRAM_BOT_TOKEN")
+		errs = requireString(errs, "notify.telegram.chat_id", conf.Notify.Telegram.ChatID, "TELEGRAM_CHAT_ID")
+	}
+
+	if conf.Notify != nil && conf.Notify.Datadog != nil {
+		errs = requireString(errs, "notify.datadog.api_key", conf.Notify.Datadog.APIKey, "DD_API_KEY")
+	}
+
+	if conf.PyPI != nil {
+		if !isSet(conf.PyPI.Token, "PYPI_TOKEN") && !isSet(conf.PyPI.Password, "TWINE_PASSWORD") {
+			errs = append(errs, FieldError{"pypi.token", "pypi.token or pypi.password is required"})
+		}
+	}
+
+	if conf.NPM != nil {
+		errs = requireString(errs, "npm.token", conf.NPM.Token, "NPM_TOKEN")
+		if conf.NPM.Access != nil {
+			access := ExpandEnv(*conf.NPM.Access)
+			if access != "" && access != "public" && access != "restricted" {
+				errs = append(errs, FieldError{"npm.access", fmt.Sprintf("npm.access should be public or restricted, not '%s'", access)})
+			}
+		}
+	}
+
+	if conf.Vercel != nil {
+		errs = requireString(errs, "vercel.token", conf.Vercel.Token, "VERCEL_TOKEN")
+	}
+
+	if conf.Firebase != nil {
+		errs = requireString(errs, "firebase.token", conf.Firebase.Token, "FIREBASE_TOKEN")
+		errs = requireString(errs, "firebase.project_id", conf.Firebase.ProjectID, "FIREBASE_PROJECT_ID")
+	}
+
+	if conf.HTTP != nil {
+		errs = requireString(errs, "http.url", conf.HTTP.URL, "")
+		if conf.HTTP.ExpectStatus != nil && (*conf.HTTP.ExpectStatus < 100 || *conf.HTTP.ExpectStatus > 599) {
+			errs = append(errs, FieldError{"http.expect_status", "http.expect_status should be between 100 and 599"})
+		}
+	}
+
+	if conf.Fly != nil {
+		errs = requireString(errs, "fly.token", conf.Fly.Token, "FLY_API_TOKEN")
+		errs = requireString(errs, "fly.app", conf.Fly.App, "FLY_APP")
+		if conf.Fly.Strategy != nil {
+			strategy := ExpandEnv(*conf.Fly.Strategy)
+			if strategy != "" && strategy != "rolling" && strategy != "immediate" && strategy != "canary" && strategy != "bluegreen" {
+				errs = append(errs, FieldError{"fly.strategy", fmt.Sprintf("fly.strategy should be rolling, immediate, canary or bluegreen, not '%s'", strategy)})
+			}
+		}
+	}
+
+	if conf.Kubernetes != nil {
+		if len(conf.Kubernetes.Manifests) == 0 {
+			errs = append(errs, FieldError{"kubernetes.manifests", "kubernetes.manifests is required"})
+		}
+		if conf.Kubernetes.Prune != nil && *conf.Kubernetes.Prune {
+			errs = requireString(errs, "kubernetes.selector", conf.Kubernetes.Selector, "")
+		}
+	}
+
+	if conf.GitHubReleases != nil {
+		if conf.GitHubReleases.Body != nil && conf.GitHubReleases.BodyFile != nil {
+			errs = append(errs, FieldError{"github_releases.body_file", "github_releases.body and github_releases.body_file are mutually exclusive"})
+		}
+		if conf.GitHubReleases.Sign != nil && *conf.GitHubReleases.Sign {
+			errs = requireString(errs, "github_releases.gpg_key", conf.GitHubReleases.GPGKey, "GPG_PRIVATE_KEY")
+		}
+		for _, pattern := range conf.GitHubReleases.Assets {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				errs = append(errs, FieldError{"github_releases.assets", fmt.Sprintf("github_releases.assets: invalid pattern '%s'", pattern)})
+			}
+		}
+		if conf.GitHubReleases.Checksums != nil {
+			algorithm := strings.ToLower(ExpandEnv(*conf.GitHubReleases.Checksums))
+			if algorithm != "" && algorithm != "sha256" && algorithm != "sha512" {
+				errs = append(errs, FieldError{"github_releases.checksums", fmt.Sprintf("github_releases.checksums should be sha256 or sha512, not '%s'", algorithm)})
+			}
+		}
+	}
+
+	if conf.Maven != nil {
+		// the repository is optional for gradle, which may configure it in the build script
+		if conf.Maven.GradlePublishTask == nil || ExpandEnv(*conf.Maven.GradlePublishTask) == "" {
+			errs = requireString(errs, "maven.repository_url", conf.Maven.RepositoryURL, "MAVEN_REPOSITORY_URL")
+		}
+		repositoryURL := os.Getenv("MAVEN_REPOSITORY_URL")
+		if conf.Maven.RepositoryURL != nil {
+			repositoryURL = ExpandEnv(*conf.Maven.RepositoryURL)
+		}
+		if repositoryURL != "" && !isAbsoluteURL(repositoryURL) {
+			errs = append(errs, FieldError{"maven.repository_url", fmt.Sprintf("maven.repository_url should be an absolute URL, not '%s'", repositoryURL)})
+		}
+	}
+
+	if conf.Cargo != nil && (conf.Cargo.DryRun == nil || !*conf.Cargo.DryRun) {
+		errs = requireString(errs, "cargo.token", conf.Cargo.Token, "CARGO_REGISTRY_TOKEN")
+	}
+
+	if conf.Render != nil {
+		errs = requireString(errs, "render.api_key", conf.Render.APIKey, "RENDER_API_KEY")
+		errs = requireString(errs, "render.service_id", conf.Render.ServiceID, "RENDER_SERVICE_ID")
+	}
+
+	if conf.ExecPlugin != nil {
+		errs = requireString(errs, "exec_plugin.command", conf.ExecPlugin.Command, "")
+	}
+
+	if conf.Ansible != nil {
+		errs = requireString(errs, "ansible.playbook", conf.Ansible.Playbook, "")
+	}
+
+	if conf.Sentry != nil {
+		errs = requireString(errs, "sentry.auth_token", conf.Sentry.AuthToken, "SENTRY_AUTH_TOKEN")
+		errs = requireString(errs, "sentry.org", conf.Sentry.Org, "SENTRY_ORG")
+		errs = requireString(errs, "sentry.project", conf.Sentry.Project, "SENTRY_PROJECT")
+		errs = requireString(errs, "sentry.release", conf.Sentry.Release, "ROCKET_COMMIT_HASH")
+	}
+
+	if conf.GitHubPages != nil {
+		errs = requireString(errs, "github_pages.api_key", conf.GitHubPages.APIKey, "GITHUB_API_KEY")
+		errs = requireString(errs, "github_pages.repo", conf.GitHubPages.Repo, "ROCKET_GIT_REPO")
+		if conf.GitHubPages.Branch != nil && !isSet(conf.GitHubPages.Branch, "") {
+			errs = append(errs, FieldError{"github_pages.branch", "github_pages.branch should not be empty"})
+		}
+	}
+
+	if conf.AWSS3 != nil {
+		errs = validatePatterns(errs, "aws_s3", conf.AWSS3.Include, conf.AWSS3.Exclude)
+	}
+	if conf.GCS != nil {
+		errs = validatePatterns(errs, "gcs", conf.GCS.Include, conf.GCS.Exclude)
+	}
+	if conf.AWSS3 != nil {
+		errs = validateRules(errs, "aws_s3", conf.AWSS3.Rules)
+	}
+	if conf.GCS != nil {
+		errs = validateRules(errs, "gcs", conf.GCS.Rules)
+	}
+	if conf.AzureBlob != nil {
+		errs = validatePatterns(errs, "azure_blob", conf.AzureBlob.Include, conf.AzureBlob.Exclude)
+	}
+	if conf.Cloudflare != nil {
+		errs = validatePatterns(errs, "cloudflare", conf.Cloudflare.Include, conf.Cloudflare.Exclude)
+	}
+	if conf.FTP != nil {
+		errs = validatePatterns(errs, "ftp", conf.FTP.Include, conf.FTP.Exclude)
+	}
+	if conf.Netlify != nil {
+		errs = validatePatterns(errs, "netlify", conf.Netlify.Include, conf.Netlify.Exclude)
+	}
+
+	errs = validateOrder(errs, conf)
+	errs = validateSelection(errs, "only", conf.Only, conf)
+	errs = validateSelection(errs, "skip", conf.Skip, conf)
+	errs = validateConditions(errs, conf)
+	errs = validateTimeouts(errs, conf)
+
+	for i, instance := range conf.Instances {
+		errs = append(errs, instanceErrors(instance, i+1)...)
+	}
+
+	if len(errs) != 0 {
+		return &ValidationError{errs}
+	}
+	return nil
+}
+
+// requireString appends an error to errs if the field is not set
+func requireString(errs []FieldError, field string, value *string, envVar string) []FieldError {
+	if isSet(value, envVar) {
+		return errs
+	}
+	return append(errs, FieldError{field, fmt.Sprintf("%s is required", field)})
+}
+
+// isSet returns true if value is not empty after env expansion.
+// If value is nil, the envVar fallback is checked instead
+func isSet(value *string, envVar string) bool {
+	if value == nil {
+		return envVar != "" && os.Getenv(envVar) != ""
+	}
+	return ExpandEnv(*value) != ""
+}
+
+// requireAWSRegion checks that the region, if set, is a known AWS region
+func requireAWSRegion(errs []FieldError, field string, region *string) []FieldError {
+	v := AWSRegion(region, os.Getenv)
+	if v == "" || isAWSRegion(v) {
+		return errs
+	}
+	return append(errs, FieldError{field, fmt.Sprintf("unknown AWS region '%s'", v)})
+}
+
+// the limits of the parts of the S3 multipart uploads, and of the single part uploads
+const (
+	minPartSize = 5 << 20
+	maxPartSize = 5 << 30
+)
+
+// validateByteSize checks that the size, if set, is valid and between min and max bytes
+func validateByteSize(errs []FieldError, field string, value *string, min, max int64) []FieldError {
+	if value == nil {
+		return errs
+	}
+	size, err := ParseByteSize(ExpandEnv(*value))
+	if err != nil {
+		return append(errs, FieldError{field, fmt.Sprintf("%s: %s", field, err.Error())})
+	}
+	if size < min || size > max {
+		errs = append(errs, FieldError{field, fmt.Sprintf("%s should be between 5MB and 5GB", field)})
+	}
+	return errs
+}
+
+// validateFileMode checks that the file mode, if set, is valid octal permissions
+func validateFileMode(errs []FieldError, field string, value *string) []FieldError {
+	if value == nil {
+		return errs
+	}
+	if _, err := ParseFileMode(ExpandEnv(*value)); err != nil {
+		errs = append(errs, FieldError{field, fmt.Sprintf("%s: %s", field, err.Error())})
+	}
+	return errs
+}
+
+// validateEncryption checks that the server side encryption of the S3 objects, if set, is AES256 or
+// aws:kms, and that the KMS key is only set with aws:kms
+func validateEncryption(errs []FieldError, provider string, encryption, kmsKeyID *string) []FieldError {
+	value := ""
+	if encryption != nil {
+		value = ExpandEnv(*encryption)
+	}
+	if value != "" && value != "AES256" && value != "aws:kms" {
+		errs = append(errs, FieldError{provider + ".server_side_encryption", fmt.Sprintf("%s.server_side_encryption should be AES256 or aws:kms", provider)})
+	}
+	if isSet(kmsKeyID, "") && value != "aws:kms" {
+		errs = append(errs, FieldError{provider + ".kms_key_id", fmt.Sprintf("%s.kms_key_id requires %s.server_side_encryption to be aws:kms", provider, provider)})
+	}
+	return errs
+}
+
+// cannedACLs are the canned ACLs of the S3 objects
+var cannedACLs = []string{
+	"private",
+	"public-read",
+	"public-read-write",
+	"authenticated-read",
+	"aws-exec-read",
+	"bucket-owner-read",
+	"bucket-owner-full-control",
+}
+
+// isCannedACL returns true if acl is a canned ACL of the S3 objects
+func isCannedACL(acl string) bool {
+	for _, v := range cannedACLs {
+		if v == acl {
+			return true
+		}
+	}
+	return false
+}
+
+// validateHealthCheck checks that the URL of the health check is set, and its settings valid
+func validateHealthCheck(errs []FieldError, check HealthCheckConfig) []FieldError {
+	if !isSet(check.URL, "") {
+		errs = append(errs, FieldError{"health_check.url", "health_check.url is required"})
+	} else if !isAbsoluteURL(ExpandEnv(*check.URL)) {
+		errs = append(errs, FieldError{"health_check.url", "health_check.url should be an absolute URL"})
+	}
+	if check.ExpectStatus != nil && (*check.ExpectStatus < 100 || *check.ExpectStatus > 599) {
+		errs = append(errs, FieldError{"health_check.expect_status", "health_check.expect_status should be an HTTP status code"})
+	}
+	if check.Retries != nil && *check.Retries < 0 {
+		errs = append(errs, FieldError{"health_check.retries", "health_check.retries should not be negative"})
+	}
+	for _, duration := range []struct {
+		field string
+		value *string
+	}{{"health_check.timeout", check.Timeout}, {"health_check.interval", check.Interval}} {
+		if duration.value == nil {
+			continue
+		}
+		if _, err := time.ParseDuration(ExpandEnv(*duration.value)); err != nil {
+			errs = append(errs, FieldError{duration.field, fmt.Sprintf("%s is not a valid duration: %s", duration.field, err.Error())})
+		}
+	}
+	return errs
+}
+
+// validateAWSRole checks that the role to assume, if set, is an ARN, and that the external ID is
+// only set with a role
+func validateAWSRole(errs []FieldError, provider string, roleARN, externalID *string) []FieldError {
+	if isSet(roleARN, "") {
+		if !strings.HasPrefix(ExpandEnv(*roleARN), "arn:") {
+			errs = append(errs, FieldError{provider + ".role_arn", fmt.Sprintf("%s.role_arn should be an ARN, e.g: arn:aws:iam::123456789012:role/deploy", provider)})
+		}
+	} else if isSet(externalID, "") {
+		errs = append(errs, FieldError{provider + ".external_id", fmt.Sprintf("%s.external_id requires %s.role_arn", provider, provider)})
+	}
+	return errs
+}
+
+// isAbsoluteURL returns true if s is an absolute URL, with a scheme and a host
+func isAbsoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.IsAbs() && u.Host != ""
+}
+
+// validatePatterns checks the syntax of the include and exclude glob patterns of a provider
+func validatePatterns(errs []FieldError, provider string, include, exclude []string) []FieldError {
+	for _, field := range []struct {
+		name     string
+		patterns []string
+	}{{"include", include}, {"exclude", exclude}} {
+		for _, pattern := range field.patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				name := provider + "." + field.name
+				errs = append(errs, FieldError{name, fmt.Sprintf("%s: invalid pattern '%s'", name, pattern)})
+			}
+		}
+	}
+	return errs
+}
+
+// validateRules checks that the rules of a provider have a valid pattern
+func validateRules(errs []FieldError, provider string, rules []FileRule) []FieldError {
+	for i, rule := range rules {
+		field := fmt.Sprintf("%s.rules[%d].match", provider, i)
+		if rule.Match == "" {
+			errs = append(errs, FieldError{field, fmt.Sprintf("%s is required", field)})
+		} else if _, err := filepath.Match(ExpandEnv(rule.Match), ""); err != nil {
+			errs = append(errs, FieldError{field, fmt.Sprintf("%s: invalid pattern '%s'", field, rule.Match)})
+		}
+	}
+	return errs
+}
+
+// validateTimeouts checks that the timeouts of the providers are valid durations
+func validateTimeouts(errs []FieldError, conf Config) []FieldError {
+	v := reflect.ValueOf(conf)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() != reflect.Ptr || field.IsNil() || field.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		timeout := field.Elem().FieldByName("Timeout")
+		if !timeout.IsValid() || timeout.IsNil() {
+			continue
+		}
+		duration, err := time.ParseDuration(ExpandEnv(timeout.Elem().String()))
+		if err == nil && duration <= 0 {
+			err = fmt.Errorf("it should be positive")
+		}
+		if err != nil {
+			field := tagName(v.Type().Field(i), "san") + ".timeout"
+			errs = append(errs, FieldError{field, fmt.Sprintf("%s is not a valid duration: %s", field, err.Error())})
+		}
+	}
+	return errs
+}
+
+// instanceErrors returns the problems of the providers of the instance-th additional instance,
+// their fields being prefixed by the index of the instance, e.g: aws_s3[1].bucket
+func instanceErrors(instance Config, index int) []FieldError {
+	ret := []FieldError{}
+	err, ok := instance.Validate().(*ValidationError)
+	if !ok {
+		return ret
+	}
+	for _, fieldErr := range err.Errors {
+		field := instanceField(fieldErr.Field, index)
+		ret = append(ret, FieldError{field, strings.Replace(fieldErr.Message, fieldErr.Field, field, 1)})
+	}
+	return ret
+}
+
+// instanceField returns the path of field in the instance at index, e.g: aws_s3[1].bucket
+func instanceField(field string, index int) string {
+	parts := strings.SplitN(field, ".", 2)
+	ret := fmt.Sprintf("%s[%d]", parts[0], index)
+	if len(parts) == 2 {
+		ret += "." + parts[1]
+	}
+	return ret
+}
+
+// validateConditions checks the syntax of the when conditions of the providers
+func validateConditions(errs []FieldError, conf Config) []FieldError {
+	v := reflect.ValueOf(conf)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() != reflect.Ptr || field.IsNil() || field.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		when := field.Elem().FieldByName("When")
+		if !when.IsValid() || when.IsNil() {
+			continue
+		}
+		if _, err := parseCondition(when.Elem().String()); err != nil {
+			field := tagName(v.Type().Field(i), "san") + ".when"
+			errs = append(errs, FieldError{field, fmt.Sprintf("%s is not valid: %s", field, err.Error())})
+		}
+	}
+	return errs
+}
+
+// validateSelection checks that each provider of selectors (only or skip) matches a configured provider
+func validateSelection(errs []FieldError, field string, selectors []string, conf Config) []FieldError {
+	configured := conf.Providers()
+	for _, selector := range selectors {
+		found := false
+		for _, name := range configured {
+			if matchProvider(name, []string{selector}) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, FieldError{field, fmt.Sprintf("%s: provider '%s' is not configured", field, selector)})
+		}
+	}
+	return errs
+}
+
+// validateOrder checks that the providers listed in order are configured, and listed only once
+func validateOrder(errs []FieldError, conf Config) []FieldError {
+	configured := map[string]bool{}
+	for _, name := range conf.Providers() {
+		configured[name] = true
+	}
+
+	listed := map[string]bool{}
+	for _, name := range conf.Order {
+		if !configured[name] {
+			errs = append(errs, FieldError{"order", fmt.Sprintf("order: provider '%s' is not configured", name)})
+		} else if listed[name] {
+			errs = append(errs, FieldError{"order", fmt.Sprintf("order: provider '%s' is listed more than once", name)})
+		}
+		listed[name] = true
+	}
+	return errs
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var vaultClient = &http.Client{Timeout: 30 * time.Second}
+
+// vaultCache holds the data of the secrets already read during this run, by path
+var vaultCache = struct {
+	sync.Mutex
+	secrets map[string]map[string]interface{}
+}{secrets: map[string]map[string]interface{}{}}
+
+// resolveVault reads the key of the secret referenced by a vault://<path>#<key> URI from the Vault
+// server at $VAULT_ADDR, authenticated with $VAULT_TOKEN. Both the KV v1 and v2 secret engines are supported
+func resolveVault(uri string) (string, error) {
+	ref := strings.TrimPrefix(uri, "vault://")
+	parts := strings.SplitN(ref, "#", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("vault: %s should be of the form vault://<path>#<key>", uri)
+	}
+	path, key := strings.Trim(parts[0], "/"), parts[1]
+
+	data, err := readVaultSecret(path)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("vault: key %s not found in secret %s", key, path)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	buf, err := json.Marshal(value)
+	return string(buf), err
+}
+
+// readVaultSecret returns the data of the secret at path, from the cache if it was already read
+func readVaultSecret(path string) (map[string]interface{}, error) {
+	vaultCache.Lock()
+	defer vaultCache.Unlock()
+
+	if data, ok := vaultCache.secrets[path]; ok {
+		return data, nil
+	}
+
+	addr := os.Getenv("VAULT_ADDR")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, fmt.Errorf("vault: VAULT_ADDR and VAULT_TOKEN are required to read %s", path)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	res, err := vaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault: reading %s: unexpected status code %d: %s", path, res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err = json.Unmarshal(body, &secret); err != nil {
+		return nil, fmt.Errorf("vault: reading %s: %s", path, err.Error())
+	}
+
+	// the KV v2 engine wraps the data of the secret with its metadata
+	data := secret.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok = data["metadata"]; ok {
+			data = inner
+		}
+	}
+
+	vaultCache.secrets[path] = data
+	return data, nil
+}
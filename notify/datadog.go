@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bloom42/astroflow-go/log"
+	"github.com/bloom42/rocket/config"
+)
+
+// datadogMaxText is the maximum length of the text of an event
+const datadogMaxText = 4000
+
+type datadogEvent struct {
+	Title          string   `json:"title"`
+	Text           string   `json:"text"`
+	Tags           []string `json:"tags"`
+	AlertType      string   `json:"alert_type"`
+	SourceTypeName string   `json:"source_type_name"`
+}
+
+// datadog posts a deployment event, with its status, to the Datadog events API
+func datadog(conf config.NotifyDatadog, deployErr error, dryRun bool) error {
+	if conf.APIKey == nil {
+		v := os.Getenv("DD_API_KEY")
+		conf.APIKey = &v
+	} else {
+		v := config.ExpandEnv(*conf.APIKey)
+		conf.APIKey = &v
+	}
+
+	if conf.Site == nil {
+		v := os.Getenv("DD_SITE")
+		conf.Site = &v
+	} else {
+		v := config.ExpandEnv(*conf.Site)
+		conf.Site = &v
+	}
+	if *conf.Site == "" {
+		v := "datadoghq.com"
+		conf.Site = &v
+	}
+
+	if conf.Title == nil {
+		v := "Deployment of $ROCKET_GIT_REPO $ROCKET_LAST_TAG"
+		conf.Title = &v
+	}
+
+	if conf.Text == nil {
+		v := "Commit $ROCKET_COMMIT_SHORT on $ROCKET_BRANCH: $ROCKET_COMMIT_MESSAGE"
+		conf.Text = &v
+	}
+
+	event := datadogEvent{
+		Title:          config.ExpandEnv(*conf.Title) + " succeeded",
+		Text:           config.ExpandEnv(*conf.Text),
+		Tags:           []string{"status:succeeded"},
+		AlertType:      "success",
+		SourceTypeName: "rocket",
+	}
+	if deployErr != nil {
+		event.Title = config.ExpandEnv(*conf.Title) + " failed"
+		event.Text = fmt.Sprintf("%s\n\n%s", event.Text, deployErr.Error())
+		event.Tags[0] = "status:failed"
+		event.AlertType = "error"
+	}
+	event.Text = truncate(event.Text, datadogMaxText)
+	for _, tag := range conf.Tags {
+		event.Tags = append(event.Tags, config.ExpandEnv(tag))
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("notify: datadog: would post the event %q", event.Title))
+		return nil
+	}
+
+	url := fmt.Sprintf("https://api.%s/api/v1/events", *conf.Site)
+	err := postJSONWithHeaders(url, map[string]string{"DD-API-KEY": *conf.APIKey}, event)
+	if err != nil {
+		return err
+	}
+
+	log.Debug("notify: datadog: event posted")
+	return nil
+}
@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bloom42/astroflow-go/log"
+	"github.com/bloom42/rocket/config"
+)
+
+const (
+	discordSuccessColor = 0x2ecc71
+	discordFailureColor = 0xe74c3c
+	// discordMaxDescription is the maximum length of the description of an embed
+	discordMaxDescription = 2048
+)
+
+type discordMessage struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// discord posts an embed with the status of the deployment to the Discord webhook
+func discord(conf config.NotifyDiscord, deployErr error, dryRun bool) error {
+	if conf.WebhookURL == nil {
+		v := os.Getenv("DISCORD_WEBHOOK_URL")
+		conf.WebhookURL = &v
+	} else {
+		v := config.ExpandEnv(*conf.WebhookURL)
+		conf.WebhookURL = &v
+	}
+
+	if conf.Username == nil {
+		v := ""
+		conf.Username = &v
+	} else {
+		v := config.ExpandEnv(*conf.Username)
+		conf.Username = &v
+	}
+
+	if conf.SuccessMessage == nil {
+		v := "Deployment of $ROCKET_GIT_REPO $ROCKET_LAST_TAG succeeded"
+		conf.SuccessMessage = &v
+	}
+
+	if conf.FailureMessage == nil {
+		v := "Deployment of $ROCKET_GIT_REPO $ROCKET_LAST_TAG failed"
+		conf.FailureMessage = &v
+	}
+
+	embed := discordEmbed{
+		Title: config.ExpandEnv(*conf.SuccessMessage),
+		Color: discordSuccessColor,
+		Fields: []discordField{
+			{"Status", "succeeded", true},
+			{"Commit", fieldValue(os.Getenv("ROCKET_COMMIT_SHORT")), true},
+			{"Tag", fieldValue(os.Getenv("ROCKET_LAST_TAG")), true},
+		},
+	}
+	if deployErr != nil {
+		embed.Title = config.ExpandEnv(*conf.FailureMessage)
+		embed.Color = discordFailureColor
+		embed.Fields[0].Value = "failed"
+		embed.Description = fmt.Sprintf("```%s```", truncate(deployErr.Error(), discordMaxDescription-6))
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("notify: discord: would send %q", embed.Title))
+		return nil
+	}
+
+	err := postJSON(*conf.WebhookURL, discordMessage{Username: *conf.Username, Embeds: []discordEmbed{embed}})
+	if err != nil {
+		return err
+	}
+
+	log.Debug("notify: discord: message sent")
+	return nil
+}
+
+// fieldValue returns value, or "-" if it is empty as Discord rejects the empty fields
+func fieldValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// truncate shortens s to at most max bytes
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max-3] + "..."
+}
@@ -0,0 +1,175 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloom42/astroflow-go/log"
+	"github.com/bloom42/rocket/config"
+)
+
+// smtpsPort is the port of SMTP over implicit TLS, other ports use STARTTLS when the server supports it
+const smtpsPort = 465
+
+// email sends the success or failure email through the SMTP server
+func email(conf config.NotifyEmail, deployErr error, dryRun bool) error {
+	if conf.SMTPHost == nil {
+		v := os.Getenv("SMTP_HOST")
+		conf.SMTPHost = &v
+	} else {
+		v := config.ExpandEnv(*conf.SMTPHost)
+		conf.SMTPHost = &v
+	}
+
+	if conf.Port == nil {
+		v := 587
+		conf.Port = &v
+	}
+
+	if conf.Username == nil {
+		v := os.Getenv("SMTP_USERNAME")
+		conf.Username = &v
+	} else {
+		v := config.ExpandEnv(*conf.Username)
+		conf.Username = &v
+	}
+
+	if conf.Password == nil {
+		v := os.Getenv("SMTP_PASSWORD")
+		conf.Password = &v
+	} else {
+		v := config.ExpandEnv(*conf.Password)
+		conf.Password = &v
+	}
+
+	if conf.From == nil {
+		conf.From = conf.Username
+	} else {
+		v := config.ExpandEnv(*conf.From)
+		conf.From = &v
+	}
+
+	to := make([]string, len(conf.To))
+	for i, recipient := range conf.To {
+		to[i] = config.ExpandEnv(recipient)
+	}
+
+	if conf.SuccessSubject == nil {
+		v := "Deployment of $ROCKET_GIT_REPO $ROCKET_LAST_TAG succeeded"
+		conf.SuccessSubject = &v
+	}
+
+	if conf.FailureSubject == nil {
+		v := "Deployment of $ROCKET_GIT_REPO $ROCKET_LAST_TAG failed"
+		conf.FailureSubject = &v
+	}
+
+	if conf.Body == nil {
+		v := "Repository: $ROCKET_GIT_REPO\nTag: $ROCKET_LAST_TAG\nCommit: $ROCKET_COMMIT_HASH\n"
+		conf.Body = &v
+	}
+
+	subject := config.ExpandEnv(*conf.SuccessSubject)
+	body := config.ExpandEnv(*conf.Body)
+	if deployErr != nil {
+		subject = config.ExpandEnv(*conf.FailureSubject)
+		body = fmt.Sprintf("%s\n%s\n", body, deployErr.Error())
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("notify: email: would send %q to %s", subject, strings.Join(to, ", ")))
+		return nil
+	}
+
+	err := sendMail(conf, to, emailMessage(*conf.From, to, subject, body))
+	if err != nil {
+		return err
+	}
+
+	log.Debug("notify: email: message sent")
+	return nil
+}
+
+// emailMessage returns the headers and the body of a plain text email
+func emailMessage(from string, to []string, subject, body string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	body = strings.Replace(body, "\r\n", "\n", -1)
+	buf.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	return buf.Bytes()
+}
+
+// sendMail sends the message through the SMTP server of conf, over TLS for the port 465 or after
+// a STARTTLS if the server supports it. The credentials are never sent in clear text
+func sendMail(conf config.NotifyEmail, to []string, message []byte) error {
+	host := *conf.SMTPHost
+	addr := net.JoinHostPort(host, strconv.Itoa(*conf.Port))
+	tlsConfig := &tls.Config{ServerName: host}
+
+	var conn net.Conn
+	var err error
+	if *conf.Port == smtpsPort {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: httpClient.Timeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, httpClient.Timeout)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(httpClient.Timeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && *conf.Port != smtpsPort {
+		if err = client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if *conf.Username != "" {
+		// PlainAuth refuses to send the credentials over an unencrypted connection
+		if err = client.Auth(smtp.PlainAuth("", *conf.Username, *conf.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(*conf.From); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err = client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(message); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
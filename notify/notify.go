@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/bloom42/astroflow-go/log"
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/version"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+var userAgent = fmt.Sprintf("rocket/%s", version.Version)
+
+// Send sends the notifications set in the configuration for the result of the deployment:
+// the success messages if deployErr is nil, the failure ones otherwise.
+// Notifications are not critical: failing to send one is logged as a warning but does not fail the deployment
+func Send(conf config.NotifyConfig, deployErr error, dryRun bool) {
+	if conf.Slack != nil {
+		if err := slack(*conf.Slack, deployErr, dryRun); err != nil {
+			log.Warn(fmt.Sprintf("notify: slack: %s", err.Error()))
+		}
+	}
+	if conf.Discord != nil {
+		if err := discord(*conf.Discord, deployErr, dryRun); err != nil {
+			log.Warn(fmt.Sprintf("notify: discord: %s", err.Error()))
+		}
+	}
+	if conf.Email != nil {
+		if err := email(*conf.Email, deployErr, dryRun); err != nil {
+			log.Warn(fmt.Sprintf("notify: email: %s", err.Error()))
+		}
+	}
+	if conf.Telegram != nil {
+		if err := telegram(*conf.Telegram, deployErr, dryRun); err != nil {
+			log.Warn(fmt.Sprintf("notify: telegram: %s", err.Error()))
+		}
+	}
+	if conf.Datadog != nil {
+		if err := datadog(*conf.Datadog, deployErr, dryRun); err != nil {
+			log.Warn(fmt.Sprintf("notify: datadog: %s", err.Error()))
+		}
+	}
+}
+
+// postJSON posts the JSON encoding of message to the webhook at url
+func postJSON(url string, message interface{}) error {
+	return postJSONWithHeaders(url, nil, message)
+}
+
+// postJSONWithHeaders is postJSON with additional headers, e.g. to authenticate
+func postJSONWithHeaders(url string, headers map[string]string, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bloom42/astroflow-go/log"
+	"github.com/bloom42/rocket/config"
+)
+
+type slackMessage struct {
+	Text    string `json:"text"`
+	Channel string `json:"channel,omitempty"`
+}
+
+// slack posts the success or failure message to the Slack incoming webhook
+func slack(conf config.NotifySlack, deployErr error, dryRun bool) error {
+	if conf.WebhookURL == nil {
+		v := os.Getenv("SLACK_WEBHOOK_URL")
+		conf.WebhookURL = &v
+	} else {
+		v := config.ExpandEnv(*conf.WebhookURL)
+		conf.WebhookURL = &v
+	}
+
+	if conf.Channel == nil {
+		v := ""
+		conf.Channel = &v
+	} else {
+		v := config.ExpandEnv(*conf.Channel)
+		conf.Channel = &v
+	}
+
+	if conf.SuccessMessage == nil {
+		v := "Deployment of $ROCKET_GIT_REPO $ROCKET_LAST_TAG succeeded"
+		conf.SuccessMessage = &v
+	}
+
+	if conf.FailureMessage == nil {
+		v := "Deployment of $ROCKET_GIT_REPO $ROCKET_LAST_TAG failed"
+		conf.FailureMessage = &v
+	}
+
+	text := config.ExpandEnv(*conf.SuccessMessage)
+	if deployErr != nil {
+		text = fmt.Sprintf("%s\n```%s```", config.ExpandEnv(*conf.FailureMessage), deployErr.Error())
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("notify: slack: would send %q", text))
+		return nil
+	}
+
+	err := postJSON(*conf.WebhookURL, slackMessage{Text: text, Channel: *conf.Channel})
+	if err != nil {
+		return err
+	}
+
+	log.Debug("notify: slack: message sent")
+	return nil
+}
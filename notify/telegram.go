@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/bloom42/astroflow-go/log"
+	"github.com/bloom42/rocket/config"
+)
+
+// telegramMaxText is the maximum length of the text of a message
+const telegramMaxText = 4096
+
+type telegramMessage struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+// telegram sends the message to the chat with the Telegram Bot API
+func telegram(conf config.NotifyTelegram, deployErr error, dryRun bool) error {
+	if conf.BotToken == nil {
+		v := os.Getenv("TELEGRAM_BOT_TOKEN")
+		conf.BotToken = &v
+	} else {
+		v := config.ExpandEnv(*conf.BotToken)
+		conf.BotToken = &v
+	}
+
+	if conf.ChatID == nil {
+		v := os.Getenv("TELEGRAM_CHAT_ID")
+		conf.ChatID = &v
+	} else {
+		v := config.ExpandEnv(*conf.ChatID)
+		conf.ChatID = &v
+	}
+
+	if conf.SuccessMessage == nil {
+		v := "Deployment of $ROCKET_GIT_REPO $ROCKET_LAST_TAG succeeded"
+		conf.SuccessMessage = &v
+	}
+
+	if conf.FailureMessage == nil {
+		v := "Deployment of $ROCKET_GIT_REPO $ROCKET_LAST_TAG failed"
+		conf.FailureMessage = &v
+	}
+
+	text := config.ExpandEnv(*conf.SuccessMessage)
+	if deployErr != nil {
+		text = truncate(fmt.Sprintf("%s\n\n%s", config.ExpandEnv(*conf.FailureMessage), deployErr.Error()), telegramMaxText)
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("notify: telegram: would send %q to %s", text, *conf.ChatID))
+		return nil
+	}
+
+	message := telegramMessage{ChatID: *conf.ChatID, Text: text, DisableWebPagePreview: true}
+	err := postJSON(fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", *conf.BotToken), message)
+	if urlErr, ok := err.(*url.Error); ok {
+		// the URL contains the token of the bot
+		err = urlErr.Err
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Debug("notify: telegram: message sent")
+	return nil
+}
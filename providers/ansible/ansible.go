@@ -0,0 +1,144 @@
+package ansible
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/command"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/registry"
+)
+
+// maxFailureLength is the maximum length of a failed task line in the returned error, as ansible
+// writes the whole result of the task
+const maxFailureLength = 300
+
+func init() {
+	registry.Register("ansible", func(conf config.Config) registry.Provider {
+		if conf.Ansible == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.Ansible.Env, When: conf.Ansible.When, Timeout: conf.Ansible.Timeout}
+		return registry.New("ansible", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.Ansible, conf.DryRun)
+		})
+	})
+}
+
+// Deploy runs the playbook with ansible-playbook, which should be installed. If the playbook fails, the
+// returned error contains the exit code and the failed tasks
+func Deploy(conf config.AnsibleConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.AnsibleConfig, dryRun bool) error {
+	if conf.Playbook == nil {
+		v := ""
+		conf.Playbook = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Playbook)
+		conf.Playbook = &v
+	}
+
+	if conf.Inventory == nil {
+		v := environ.Getenv(ctx, "ANSIBLE_INVENTORY")
+		conf.Inventory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Inventory)
+		conf.Inventory = &v
+	}
+
+	if conf.Limit == nil {
+		v := ""
+		conf.Limit = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Limit)
+		conf.Limit = &v
+	}
+
+	args := []string{}
+	if *conf.Inventory != "" {
+		args = append(args, "--inventory", *conf.Inventory)
+	}
+	if *conf.Limit != "" {
+		args = append(args, "--limit", *conf.Limit)
+	}
+	if len(conf.Tags) != 0 {
+		tags := make([]string, len(conf.Tags))
+		for i, tag := range conf.Tags {
+			tags[i] = environ.ExpandEnv(ctx, tag)
+		}
+		args = append(args, "--tags", strings.Join(tags, ","))
+	}
+	if len(conf.ExtraVars) != 0 {
+		// passed as JSON, so the values do not need to be quoted
+		extraVars := map[string]string{}
+		for key, value := range conf.ExtraVars {
+			extraVars[key] = environ.ExpandEnv(ctx, value)
+		}
+		data, err := json.Marshal(extraVars)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--extra-vars", string(data))
+	}
+	args = append(args, *conf.Playbook)
+
+	if dryRun {
+		log.Info(fmt.Sprintf("ansible: would run playbook %s", *conf.Playbook))
+		return nil
+	}
+
+	log.Info(fmt.Sprintf("ansible: running playbook %s", *conf.Playbook))
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ansible-playbook", args...)
+	cmd.Env = environ.Environ(ctx)
+	cmd.Stdout = io.MultiWriter(os.Stdout, &stdout)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	err := cmd.Run()
+	if err != nil {
+		exitCode, _ := command.ExitCode(err)
+		message := strings.Join(failedTasks(stdout.String()), "\n")
+		if message == "" {
+			message = strings.TrimSpace(stderr.String())
+		}
+		return fmt.Errorf("ansible: ansible-playbook failed with exit code %d: %s", exitCode, message)
+	}
+
+	log.Info(fmt.Sprintf("ansible: playbook %s successfully run", *conf.Playbook))
+	return nil
+}
+
+// failedTasks returns the failed and unreachable results of the output of ansible-playbook, each one
+// prefixed by the name of its task, e.g: TASK [restart app] fatal: [web1]: FAILED! => {...}
+func failedTasks(output string) []string {
+	ret := []string{}
+	task := ""
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "TASK ["):
+			task = strings.TrimRight(line, " *")
+		case strings.HasPrefix(line, "fatal: ["), strings.HasPrefix(line, "failed: ["):
+			if len(line) > maxFailureLength {
+				line = line[:maxFailureLength] + "..."
+			}
+			ret = append(ret, strings.TrimSpace(task+" "+line))
+		}
+	}
+	return ret
+}
@@ -2,78 +2,123 @@ package awseb
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/bloom42/rocket/config"
-	"github.com/bloom42/astroflow-go/log"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/bloom42/astroflow-go/log"
 	"github.com/z0mbie42/fswalk"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/providers/tempfile"
 )
 
+func init() {
+	registry.Register("aws_eb", func(conf config.Config) registry.Provider {
+		if conf.AWSEB == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.AWSEB.Env, When: conf.AWSEB.When, Timeout: conf.AWSEB.Timeout}
+		return registry.New("aws_eb", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.AWSEB, conf.DryRun)
+		})
+	})
+}
+
 // Deploy perform the elastic beanstalk deployment
-func Deploy(conf config.AWSEBConfig) error {
+func Deploy(conf config.AWSEBConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.AWSEBConfig, dryRun bool) error {
 	var err error
 
 	if conf.AccessKeyID == nil {
-		v := os.Getenv("AWS_ACCESS_KEY_ID")
+		v := environ.Getenv(ctx, "AWS_ACCESS_KEY_ID")
 		conf.AccessKeyID = &v
 	} else {
-		v := config.ExpandEnv(*conf.AccessKeyID)
+		v := environ.ExpandEnv(ctx, *conf.AccessKeyID)
 		conf.AccessKeyID = &v
 	}
 
 	if conf.SecretAccessKey == nil {
-		v := os.Getenv("AWS_SECRET_ACCESS_KEY")
+		v := environ.Getenv(ctx, "AWS_SECRET_ACCESS_KEY")
 		conf.SecretAccessKey = &v
 	} else {
-		v := config.ExpandEnv(*conf.SecretAccessKey)
+		v := environ.ExpandEnv(ctx, *conf.SecretAccessKey)
 		conf.SecretAccessKey = &v
 	}
 
-	if conf.Region == nil {
-		v := os.Getenv("AWS_REGION")
-		conf.Region = &v
+	if conf.Profile == nil {
+		v := environ.Getenv(ctx, "AWS_PROFILE")
+		conf.Profile = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Profile)
+		conf.Profile = &v
+	}
+
+	if conf.RoleARN == nil {
+		v := ""
+		conf.RoleARN = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.RoleARN)
+		conf.RoleARN = &v
+	}
+
+	if conf.ExternalID == nil {
+		v := ""
+		conf.ExternalID = &v
 	} else {
-		v := config.ExpandEnv(*conf.Region)
-		conf.Region = &v
+		v := environ.ExpandEnv(ctx, *conf.ExternalID)
+		conf.ExternalID = &v
 	}
 
+	region := config.AWSRegion(conf.Region, environ.Getter(ctx))
+	conf.Region = &region
+
 	if conf.Application == nil {
-		v := os.Getenv("AWS_EB_APPLICATION")
+		v := environ.Getenv(ctx, "AWS_EB_APPLICATION")
 		conf.Application = &v
 	} else {
-		v := config.ExpandEnv(*conf.Application)
+		v := environ.ExpandEnv(ctx, *conf.Application)
 		conf.Application = &v
 	}
 
 	if conf.Environment == nil {
-		v := os.Getenv("AWS_EB_ENVIRONMENT")
+		v := environ.Getenv(ctx, "AWS_EB_ENVIRONMENT")
 		conf.Environment = &v
 	} else {
-		v := config.ExpandEnv(*conf.Environment)
+		v := environ.ExpandEnv(ctx, *conf.Environment)
 		conf.Environment = &v
 	}
 
 	if conf.S3Bucket == nil {
-		v := os.Getenv("AWS_S3_BUCKET")
+		v := environ.Getenv(ctx, "AWS_S3_BUCKET")
 		conf.S3Bucket = &v
 	} else {
-		v := config.ExpandEnv(*conf.S3Bucket)
+		v := environ.ExpandEnv(ctx, *conf.S3Bucket)
 		conf.S3Bucket = &v
 	}
 
 	if conf.Version == nil {
-		v := os.Getenv("ROCKET_COMMIT_HASH")
+		v := environ.Getenv(ctx, "ROCKET_COMMIT_HASH")
 		conf.Version = &v
 	} else {
-		v := config.ExpandEnv(*conf.Version)
+		v := environ.ExpandEnv(ctx, *conf.Version)
 		conf.Version = &v
 	}
 
@@ -84,15 +129,29 @@ func Deploy(conf config.AWSEBConfig) error {
 
 	if conf.S3Key == nil {
 		str := "/${AWS_EB_APPLICATION}_${AWS_EB_ENVIRONMENT}_${ROCKET_COMMIT_HASH}.zip"
-		v := config.ExpandEnv(str)
+		v := environ.ExpandEnv(ctx, str)
 		conf.S3Key = &v
 	} else {
-		v := config.ExpandEnv(*conf.S3Key)
+		v := environ.ExpandEnv(ctx, *conf.S3Key)
 		conf.S3Key = &v
 	}
 
+	if conf.WaitTimeout == nil {
+		v := "10m"
+		conf.WaitTimeout = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.WaitTimeout)
+		conf.WaitTimeout = &v
+	}
+	waitTimeout, err := time.ParseDuration(*conf.WaitTimeout)
+	if err != nil {
+		return err
+	}
+
 	var awsConf aws.Config
 
+	// without inline keys, the credentials are looked up by the default credential chain: the env
+	// variables, the shared credentials file (using the profile) and the EC2 or ECS role
 	if *conf.AccessKeyID != "" && *conf.SecretAccessKey != "" {
 		awsConf = aws.Config{
 			Credentials: credentials.NewStaticCredentials(*conf.AccessKeyID, *conf.SecretAccessKey, ""),
@@ -100,15 +159,46 @@ func Deploy(conf config.AWSEBConfig) error {
 	} else {
 		awsConf = aws.Config{}
 	}
-	awsConf.Region = aws.String(*conf.Region)
-	sess := session.New(&awsConf)
+	// the region of the profile is used if none is set
+	if *conf.Region != "" {
+		awsConf.Region = aws.String(*conf.Region)
+	}
+	awsConf.HTTPClient = httpclient.WithContext(ctx, &http.Client{})
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            awsConf,
+		Profile:           *conf.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return err
+	}
+	if *conf.RoleARN != "" {
+		sess = assumeRole(sess, *conf.RoleARN, *conf.ExternalID)
+	}
+
+	if dryRun {
+		walker, _ := fswalk.NewWalker()
+		filesc, _ := walker.Walk(*conf.Directory)
+		for file := range filesc {
+			if file.Path == "." || file.IsDir || file.IsSymLink {
+				continue
+			}
+			log.With("file", file.Path).Debug("aws_eb: would add file to bundle")
+		}
+		log.Info(fmt.Sprintf("aws_eb: would upload bundle to s3://%s/%s", *conf.S3Bucket, strings.TrimPrefix(*conf.S3Key, "/")))
+		log.Info(fmt.Sprintf("aws_eb: would create version %s of application %s", *conf.Version, *conf.Application))
+		if *conf.Environment != "" {
+			log.Info(fmt.Sprintf("aws_eb: would deploy version %s to environment %s and wait until it's ready", *conf.Version, *conf.Environment))
+		}
+		return nil
+	}
 
 	// 1) create the archive
-	tmpFile, err := ioutil.TempFile("", "rocket.*.zip")
+	tmpFile, err := tempfile.File("", "rocket.*.zip")
 	if err != nil {
 		return err
 	}
-	defer os.Remove(tmpFile.Name())
+	defer tempfile.Remove(tmpFile.Name())
 	// set up the zip writer
 	zipWriter := zip.NewWriter(tmpFile)
 
@@ -159,6 +249,32 @@ func Deploy(conf config.AWSEBConfig) error {
 	}
 
 	log.Info("aws_eb: new application version successfully created")
+
+	if *conf.Environment == "" {
+		return nil
+	}
+
+	// 4) deploy it to the environment, and wait for the environment to be ready and healthy
+	deadline := time.Now().Add(waitTimeout)
+	if err = waitForVersion(ctx, svc, *conf.Application, *conf.Version, deadline); err != nil {
+		return err
+	}
+
+	since := time.Now()
+	_, err = svc.UpdateEnvironment(&elasticbeanstalk.UpdateEnvironmentInput{
+		ApplicationName: aws.String(*conf.Application),
+		EnvironmentName: aws.String(*conf.Environment),
+		VersionLabel:    aws.String(*conf.Version),
+	})
+	if err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("aws_eb: deploying version %s to environment %s", *conf.Version, *conf.Environment))
+
+	if err = waitForEnvironment(ctx, svc, *conf.Application, *conf.Environment, *conf.Version, since, deadline); err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("aws_eb: environment %s is ready and healthy", *conf.Environment))
 	return nil
 }
 
@@ -209,3 +325,15 @@ func uploadFileToS3(conf config.AWSEBConfig, s *session.Session, filePath string
 	})
 	return err
 }
+
+// assumeRole returns a copy of sess using the temporary credentials of the role, assumed with the
+// credentials of sess
+func assumeRole(sess *session.Session, roleARN, externalID string) *session.Session {
+	creds := stscreds.NewCredentials(sess, roleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = "rocket"
+		if externalID != "" {
+			p.ExternalID = aws.String(externalID)
+		}
+	})
+	return sess.Copy(&aws.Config{Credentials: creds})
+}
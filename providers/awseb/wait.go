@@ -0,0 +1,120 @@
+package awseb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/bloom42/astroflow-go/log"
+)
+
+// pollInterval is the interval between two checks of the application version and of the environment
+const pollInterval = 10 * time.Second
+
+// waitForVersion waits until the application version is processed (its bundle validated by EB), so it
+// can be deployed
+func waitForVersion(ctx context.Context, svc *elasticbeanstalk.ElasticBeanstalk, application, version string, deadline time.Time) error {
+	for {
+		out, err := svc.DescribeApplicationVersions(&elasticbeanstalk.DescribeApplicationVersionsInput{
+			ApplicationName: aws.String(application),
+			VersionLabels:   []*string{aws.String(version)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.ApplicationVersions) == 0 {
+			return fmt.Errorf("aws_eb: version %s of application %s not found", version, application)
+		}
+
+		status := aws.StringValue(out.ApplicationVersions[0].Status)
+		switch status {
+		case "PROCESSED":
+			return nil
+		case "FAILED":
+			return fmt.Errorf("aws_eb: processing of version %s failed", version)
+		}
+		log.Debug(fmt.Sprintf("aws_eb: version %s is %s", version, status))
+
+		if err = sleep(ctx, deadline); err != nil {
+			return fmt.Errorf("aws_eb: version %s not processed before the wait timeout (status: %s)", version, status)
+		}
+	}
+}
+
+// waitForEnvironment polls the environment until it is Ready and its health Green, running version, and
+// logs its events since since. It returns an error if the environment ends up Degraded, Severe or Red,
+// if the update was rolled back, or if deadline is reached
+func waitForEnvironment(ctx context.Context, svc *elasticbeanstalk.ElasticBeanstalk, application, environment, version string, since, deadline time.Time) error {
+	for {
+		events, err := svc.DescribeEvents(&elasticbeanstalk.DescribeEventsInput{
+			ApplicationName: aws.String(application),
+			EnvironmentName: aws.String(environment),
+			StartTime:       aws.Time(since),
+		})
+		if err != nil {
+			return err
+		}
+		// the events are returned newest first
+		for i := len(events.Events) - 1; i >= 0; i-- {
+			event := events.Events[i]
+			message := fmt.Sprintf("aws_eb: %s: %s", environment, aws.StringValue(event.Message))
+			switch aws.StringValue(event.Severity) {
+			case "WARN", "ERROR", "FATAL":
+				log.Warn(message)
+			default:
+				log.Info(message)
+			}
+			if date := aws.TimeValue(event.EventDate); !date.Before(since) {
+				since = date.Add(time.Millisecond)
+			}
+		}
+
+		out, err := svc.DescribeEnvironments(&elasticbeanstalk.DescribeEnvironmentsInput{
+			ApplicationName:  aws.String(application),
+			EnvironmentNames: []*string{aws.String(environment)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.Environments) == 0 {
+			return fmt.Errorf("aws_eb: environment %s of application %s not found", environment, application)
+		}
+
+		env := out.Environments[0]
+		status := aws.StringValue(env.Status)
+		health := aws.StringValue(env.Health)
+		// HealthStatus is only set with the enhanced health reporting
+		healthStatus := aws.StringValue(env.HealthStatus)
+		if status == "Ready" {
+			if healthStatus == "Degraded" || healthStatus == "Severe" || health == "Red" {
+				return fmt.Errorf("aws_eb: environment %s is unhealthy after the deployment (health: %s %s)", environment, health, healthStatus)
+			}
+			if running := aws.StringValue(env.VersionLabel); running != version {
+				return fmt.Errorf("aws_eb: environment %s runs version %s instead of %s, the deployment failed", environment, running, version)
+			}
+			if health == "Green" {
+				return nil
+			}
+		}
+		log.Debug(fmt.Sprintf("aws_eb: environment %s is %s (health: %s %s)", environment, status, health, healthStatus))
+
+		if err = sleep(ctx, deadline); err != nil {
+			return fmt.Errorf("aws_eb: environment %s not ready before the wait timeout (status: %s, health: %s)", environment, status, health)
+		}
+	}
+}
+
+// sleep waits pollInterval, or returns an error if deadline would be reached or ctx is done
+func sleep(ctx context.Context, deadline time.Time) error {
+	if time.Now().Add(pollInterval).After(deadline) {
+		return context.DeadlineExceeded
+	}
+	select {
+	case <-time.After(pollInterval):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,55 @@
+package awss3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+)
+
+// invalidate creates an invalidation of conf.InvalidationPaths in the CloudFront distribution, so the
+// uploaded files are served instead of the cached ones. With conf.WaitForInvalidation, it returns once
+// the invalidation is completed, otherwise once it is submitted
+func invalidate(ctx context.Context, conf config.AWSS3Config, sess *session.Session) error {
+	// CloudFront is a global service: the endpoint of S3 compatible services does not apply to it
+	svc := cloudfront.New(sess.Copy(&aws.Config{Endpoint: aws.String("")}))
+
+	out, err := svc.CreateInvalidation(&cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(*conf.CloudFrontDistributionID),
+		InvalidationBatch: &cloudfront.InvalidationBatch{
+			// the caller reference identifies the invalidation, and should be unique
+			CallerReference: aws.String(fmt.Sprintf("rocket-%d", time.Now().UnixNano())),
+			Paths: &cloudfront.Paths{
+				Quantity: aws.Int64(int64(len(conf.InvalidationPaths))),
+				Items:    aws.StringSlice(conf.InvalidationPaths),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("aws_s3: creating the CloudFront invalidation: %s", err.Error())
+	}
+	id := aws.StringValue(out.Invalidation.Id)
+	log.With("id", id).Info(fmt.Sprintf("aws_s3: invalidation of %s created in the CloudFront distribution %s", strings.Join(conf.InvalidationPaths, ", "), *conf.CloudFrontDistributionID))
+
+	if !*conf.WaitForInvalidation {
+		return nil
+	}
+
+	log.Info(fmt.Sprintf("aws_s3: waiting for the invalidation %s to complete", id))
+	err = svc.WaitUntilInvalidationCompletedWithContext(ctx, &cloudfront.GetInvalidationInput{
+		DistributionId: aws.String(*conf.CloudFrontDistributionID),
+		Id:             aws.String(id),
+	})
+	if err != nil {
+		return fmt.Errorf("aws_s3: waiting for the invalidation %s: %s", id, err.Error())
+	}
+	log.Info(fmt.Sprintf("aws_s3: invalidation %s completed", id))
+	return nil
+}
@@ -0,0 +1,165 @@
+package awss3
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+)
+
+// SyncOperation is an operation of a SyncPlan: the upload of File to the object Key, or the deletion
+// of the object Key, File being empty
+type SyncOperation struct {
+	File string
+	Key  string
+}
+
+// SyncPlan are the operations the deployment of an aws_s3 configuration would perform
+type SyncPlan struct {
+	// Create are the files without remote object
+	Create []SyncOperation
+	// Update are the files whose remote object has a different checksum
+	Update []SyncOperation
+	// Delete are the remote objects without local file, only if conf.Delete is true
+	Delete []SyncOperation
+	// Unchanged are the files whose remote object is identical
+	Unchanged []SyncOperation
+}
+
+// DiffS3 returns the operations the deployment of conf would perform, by comparing the local files
+// to the objects of the bucket
+func DiffS3(conf config.AWSS3Config) (*SyncPlan, error) {
+	return DiffS3Context(context.Background(), conf)
+}
+
+// DiffS3Context is DiffS3 with a context: the requests are cancelled when ctx is done
+func DiffS3Context(ctx context.Context, conf config.AWSS3Config) (*SyncPlan, error) {
+	setDefaults(ctx, &conf)
+
+	files, err := localFiles(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := newSession(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return diff(conf, sess, files)
+}
+
+// diff compares the given local files to the objects of the bucket under the remote directory
+func diff(conf config.AWSS3Config, sess *session.Session, files []string) (*SyncPlan, error) {
+	remote, err := remoteObjects(conf, sess)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &SyncPlan{}
+	for _, file := range files {
+		key := objectKey(conf, file)
+		operation := SyncOperation{File: file, Key: key}
+
+		object, ok := remote[key]
+		if !ok {
+			plan.Create = append(plan.Create, operation)
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		body, err := openBody(conf, file)
+		if err != nil {
+			return nil, err
+		}
+		if unchanged(object.ETag, object.Size, object.LastModified, body, info.ModTime()) {
+			plan.Unchanged = append(plan.Unchanged, operation)
+		} else {
+			plan.Update = append(plan.Update, operation)
+		}
+		body.Close()
+	}
+
+	if *conf.Delete {
+		for _, key := range orphans(conf, remote, files) {
+			plan.Delete = append(plan.Delete, SyncOperation{Key: key})
+		}
+	}
+
+	return plan, nil
+}
+
+// orphans returns the sorted keys of the remote objects without local file. Only the objects under the
+// remote directory are returned
+func orphans(conf config.AWSS3Config, remote map[string]*s3.Object, files []string) []string {
+	local := map[string]bool{}
+	for _, file := range files {
+		local[objectKey(conf, file)] = true
+	}
+
+	prefix := remotePrefix(conf)
+	keys := []string{}
+	for key := range remote {
+		if !local[key] && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// remotePrefix returns the prefix of the keys of the objects under the remote directory
+func remotePrefix(conf config.AWSS3Config) string {
+	prefix := strings.Trim(*conf.RemoteDirectory, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// remoteObjects returns the objects of the bucket under the remote directory, by key
+func remoteObjects(conf config.AWSS3Config, sess *session.Session) (map[string]*s3.Object, error) {
+	ret := map[string]*s3.Object{}
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(*conf.Bucket),
+		Prefix: aws.String(remotePrefix(conf)),
+	}
+	err := s3.New(sess).ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			if object.Key != nil {
+				ret[*object.Key] = object
+			}
+		}
+		return true
+	})
+	return ret, err
+}
+
+// logPlan displays the operations of the plan
+func logPlan(conf config.AWSS3Config, plan *SyncPlan) {
+	for _, operation := range plan.Create {
+		log.Info(fmt.Sprintf("aws_s3: would create s3://%s/%s from %s", *conf.Bucket, operation.Key, operation.File))
+	}
+	for _, operation := range plan.Update {
+		log.Info(fmt.Sprintf("aws_s3: would update s3://%s/%s from %s", *conf.Bucket, operation.Key, operation.File))
+	}
+	for _, operation := range plan.Delete {
+		log.Info(fmt.Sprintf("aws_s3: would delete s3://%s/%s", *conf.Bucket, operation.Key))
+	}
+	for _, operation := range plan.Unchanged {
+		log.With("file", operation.File).Debug("aws_s3: file unchanged, would be skipped")
+	}
+	log.Info(fmt.Sprintf("aws_s3: %d object(s) to create, %d to update, %d to delete, %d unchanged",
+		len(plan.Create), len(plan.Update), len(plan.Delete), len(plan.Unchanged)))
+}
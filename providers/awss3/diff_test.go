@@ -0,0 +1,89 @@
+package awss3
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/bloom42/rocket/config"
+)
+
+func s3Config(localDirectory, remoteDirectory string) config.AWSS3Config {
+	return config.AWSS3Config{LocalDirectory: &localDirectory, RemoteDirectory: &remoteDirectory}
+}
+
+func remoteKeys(keys ...string) map[string]*s3.Object {
+	ret := map[string]*s3.Object{}
+	for _, key := range keys {
+		ret[key] = &s3.Object{}
+	}
+	return ret
+}
+
+func TestOrphansNestedFiles(t *testing.T) {
+	files := []string{
+		filepath.Join("dist", "index.html"),
+		filepath.Join("dist", "css", "app.css"),
+		filepath.Join("dist", "js", "vendor", "lib.js"),
+	}
+
+	tests := []struct {
+		name            string
+		remoteDirectory string
+		remote          []string
+		expected        []string
+	}{
+		{
+			name:            "root remote directory",
+			remoteDirectory: "/",
+			remote:          []string{"index.html", "css/app.css", "js/vendor/lib.js", "old.html", "css/old.css"},
+			expected:        []string{"css/old.css", "old.html"},
+		},
+		{
+			name:            "remote subdirectory",
+			remoteDirectory: "/my/app",
+			remote:          []string{"my/app/index.html", "my/app/css/app.css", "my/app/js/vendor/lib.js", "my/app/js/old.js"},
+			expected:        []string{"my/app/js/old.js"},
+		},
+		{
+			name:            "objects outside of the remote directory",
+			remoteDirectory: "my/app/",
+			remote:          []string{"my/app/index.html", "my/app/css/app.css", "my/app/js/vendor/lib.js", "other/index.html", "my/application.css"},
+			expected:        []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := s3Config("dist", test.remoteDirectory)
+			got := orphans(conf, remoteKeys(test.remote...), files)
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("orphans() = %v, expected %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestObjectKey(t *testing.T) {
+	tests := []struct {
+		localDirectory  string
+		remoteDirectory string
+		file            string
+		expected        string
+	}{
+		{".", "/", "index.html", "index.html"},
+		{".", "/", filepath.Join("css", "app.css"), "css/app.css"},
+		{"dist", "/", filepath.Join("dist", "css", "app.css"), "css/app.css"},
+		{"dist/", "/my/app", filepath.Join("dist", "js", "vendor", "lib.js"), "my/app/js/vendor/lib.js"},
+		{"./dist", "my/app/", filepath.Join("dist", "index.html"), "my/app/index.html"},
+	}
+
+	for _, test := range tests {
+		got := objectKey(s3Config(test.localDirectory, test.remoteDirectory), test.file)
+		if got != test.expected {
+			t.Errorf("objectKey(%q, %q, %q) = %q, expected %q", test.localDirectory, test.remoteDirectory, test.file, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package awss3
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+)
+
+// manifestTTL is how long the manifest of an interrupted upload is reused by the next run
+const manifestTTL = time.Hour
+
+// manifest records the files uploaded during an interrupted run, so the next run does not check or upload
+// them again. It's a file of "<fingerprint> <key>" lines in the temp directory, appended after each upload
+type manifest struct {
+	mutex    sync.Mutex
+	path     string
+	uploaded map[string]string
+	file     *os.File
+}
+
+// openManifest opens the manifest of the uploads of conf to its bucket and remote directory, loading
+// the files uploaded by a previous run if it's recent enough
+func openManifest(conf config.AWSS3Config) (*manifest, error) {
+	id := sha256.Sum256([]byte(strings.Join([]string{*conf.Endpoint, *conf.Bucket, *conf.RemoteDirectory}, "\n")))
+	m := &manifest{
+		path:     filepath.Join(os.TempDir(), fmt.Sprintf("rocket-aws_s3-%x", id[:8])),
+		uploaded: map[string]string{},
+	}
+
+	if stat, err := os.Stat(m.path); err == nil && time.Since(stat.ModTime()) < manifestTTL {
+		file, err := os.Open(m.path)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			parts := strings.SplitN(scanner.Text(), " ", 2)
+			if len(parts) == 2 {
+				m.uploaded[parts[1]] = parts[0]
+			}
+		}
+		file.Close()
+		if len(m.uploaded) != 0 {
+			log.Info(fmt.Sprintf("aws_s3: resuming the previous upload, %d file(s) already uploaded", len(m.uploaded)))
+		}
+	}
+
+	file, err := os.OpenFile(m.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	m.file = file
+	return m, nil
+}
+
+// fingerprint identifies the content and the headers of an upload, so a file modified since, or uploaded
+// with other headers, is uploaded again
+func fingerprint(input ...string) string {
+	sum := md5.Sum([]byte(strings.Join(input, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// done returns true if the object key was uploaded with this fingerprint by the previous run
+func (m *manifest) done(key, fingerprint string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.uploaded[key] == fingerprint
+}
+
+// add records the upload of the object key. Failing to record it only means it's checked again by the
+// next run
+func (m *manifest) add(key, fingerprint string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.uploaded[key] = fingerprint
+	if _, err := fmt.Fprintf(m.file, "%s %s\n", fingerprint, key); err != nil {
+		log.With("key", key, "err", err).Debug("aws_s3: error recording the upload in the manifest")
+	}
+}
+
+// close closes the manifest. It's removed if all the files were uploaded, as the next run does not resume
+// this upload
+func (m *manifest) close(complete bool) {
+	m.file.Close()
+	if complete {
+		os.Remove(m.path)
+	}
+}
@@ -1,45 +1,282 @@
 package awss3
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/bloom42/rocket/config"
-	"github.com/bloom42/astroflow-go/log"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/bloom42/astroflow-go/log"
 	"github.com/z0mbie42/fswalk"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/filter"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/providers/upload"
 )
 
+func init() {
+	registry.Register("aws_s3", func(conf config.Config) registry.Provider {
+		if conf.AWSS3 == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.AWSS3.Env, When: conf.AWSS3.When, Timeout: conf.AWSS3.Timeout}
+		return registry.New("aws_s3", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.AWSS3, conf.DryRun)
+		})
+	})
+}
+
 // Deploy perform the S3 upload
-func Deploy(conf config.AWSS3Config) error {
-	var err error
+func Deploy(conf config.AWSS3Config, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.AWSS3Config, dryRun bool) error {
+	setDefaults(ctx, &conf)
+
+	// a missing local directory must fail before the deletion of the orphans, which would delete everything
+	files, err := localFiles(conf)
+	if err != nil {
+		return err
+	}
+
+	sess, err := newSession(ctx, conf)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		plan, err := diff(conf, sess, files)
+		if err != nil {
+			// the plan requires access to the bucket, the files are listed anyway
+			log.Warn(fmt.Sprintf("aws_s3: computing the sync plan: %s", err.Error()))
+			for _, file := range files {
+				log.Info(fmt.Sprintf("aws_s3: would upload %s to s3://%s/%s", file, *conf.Bucket, objectKey(conf, file)))
+			}
+			return nil
+		}
+		logPlan(conf, plan)
+		if *conf.CloudFrontDistributionID != "" {
+			log.Info(fmt.Sprintf("aws_s3: would invalidate %s in the CloudFront distribution %s", strings.Join(conf.InvalidationPaths, ", "), *conf.CloudFrontDistributionID))
+		}
+		return nil
+	}
+
+	// with resume, the files uploaded by an interrupted run are recorded in a manifest and not uploaded again
+	var m *manifest
+	if *conf.Resume {
+		if m, err = openManifest(conf); err != nil {
+			return err
+		}
+	}
+
+	log.Info(fmt.Sprintf("aws_s3: uploading %d files to s3://%s/%s", len(files), *conf.Bucket, strings.TrimPrefix(*conf.RemoteDirectory, "/")))
+	uploaded, skipped, failed := uploadFiles(ctx, conf, sess, files, m)
+	log.Info(fmt.Sprintf("aws_s3: %d file(s) uploaded, %d unchanged file(s) skipped", uploaded, skipped))
+	if m != nil {
+		m.close(ctx.Err() == nil && len(failed) == 0)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(failed) != 0 {
+		return upload.Error("aws_s3", failed)
+	}
+
+	// the deletion is only reached when all the files are uploaded, so the bucket is never left without a file
+	if *conf.Delete {
+		if err = deleteOrphans(ctx, conf, sess, files); err != nil {
+			return err
+		}
+	}
+
+	if *conf.CloudFrontDistributionID != "" {
+		return invalidate(ctx, conf, sess)
+	}
+	return nil
+}
+
+// uploadResult is the result of the upload of a file by a worker of uploadFiles
+type uploadResult struct {
+	file string
+	done bool
+	err  error
+}
+
+// uploadFiles uploads the files with conf.UploadConcurrency workers and returns the number of uploaded
+// and skipped files, and the errors of the failed ones by file. The remaining files are not uploaded
+// once ctx is done. The files recorded in m, if not nil, are skipped and the uploaded ones are added to it
+func uploadFiles(ctx context.Context, conf config.AWSS3Config, sess *session.Session, files []string, m *manifest) (int, int, map[string]error) {
+	uploaded := 0
+	skipped := 0
+	failed := map[string]error{}
+
+	jobs := make(chan string)
+	results := make(chan uploadResult)
+	var wg sync.WaitGroup
+
+	for i := 0; i < *conf.UploadConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				log.With("file", file).Debug("aws_s3: file to upload")
+				done, err := uploadFile(conf, sess, file, m)
+				results <- uploadResult{file, done, err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, file := range files {
+			select {
+			case jobs <- file:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		if result.err != nil {
+			failed[result.file] = result.err
+			log.With("file", result.file).Error(fmt.Sprintf("aws_s3: error uploading a file: %s", result.err.Error()))
+		} else if result.done {
+			uploaded++
+			log.Info(fmt.Sprintf("aws_s3: file successfully uploaded %s", result.file))
+		} else {
+			skipped++
+			log.With("file", result.file).Debug("aws_s3: file unchanged, skipped")
+		}
+	}
+
+	return uploaded, skipped, failed
+}
 
+// deleteOrphans deletes the objects under the remote directory without local file
+func deleteOrphans(ctx context.Context, conf config.AWSS3Config, sess *session.Session, files []string) error {
+	remote, err := remoteObjects(conf, sess)
+	if err != nil {
+		return err
+	}
+	keys := orphans(conf, remote, files)
+
+	svc := s3.New(sess)
+	// DeleteObjects accepts at most 1000 keys
+	for start := 0; start < len(keys); start += 1000 {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		end := start + 1000
+		if end > len(keys) {
+			end = len(keys)
+		}
+		objects := make([]*s3.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+		}
+		output, err := svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(*conf.Bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		// in quiet mode, only the objects which failed to be deleted are returned
+		failed := map[string]string{}
+		for _, deleteErr := range output.Errors {
+			failed[aws.StringValue(deleteErr.Key)] = aws.StringValue(deleteErr.Message)
+		}
+		for _, key := range keys[start:end] {
+			if message, ok := failed[key]; ok {
+				return fmt.Errorf("aws_s3: deleting s3://%s/%s: %s", *conf.Bucket, key, message)
+			}
+			log.Info(fmt.Sprintf("aws_s3: object deleted s3://%s/%s", *conf.Bucket, key))
+		}
+	}
+	log.Info(fmt.Sprintf("aws_s3: %d orphaned object(s) deleted", len(keys)))
+	return nil
+}
+
+// setDefaults fills the unset fields of conf with their default value and expands the others
+func setDefaults(ctx context.Context, conf *config.AWSS3Config) {
 	if conf.AccessKeyID == nil {
-		v := os.Getenv("AWS_ACCESS_KEY_ID")
+		v := environ.Getenv(ctx, "AWS_ACCESS_KEY_ID")
 		conf.AccessKeyID = &v
 	} else {
-		v := config.ExpandEnv(*conf.AccessKeyID)
+		v := environ.ExpandEnv(ctx, *conf.AccessKeyID)
 		conf.AccessKeyID = &v
 	}
 
 	if conf.SecretAccessKey == nil {
-		v := os.Getenv("AWS_SECRET_ACCESS_KEY")
+		v := environ.Getenv(ctx, "AWS_SECRET_ACCESS_KEY")
 		conf.SecretAccessKey = &v
 	} else {
-		v := config.ExpandEnv(*conf.SecretAccessKey)
+		v := environ.ExpandEnv(ctx, *conf.SecretAccessKey)
 		conf.SecretAccessKey = &v
 	}
 
-	if conf.Region == nil {
-		v := os.Getenv("AWS_REGION")
-		conf.Region = &v
+	if conf.Profile == nil {
+		v := environ.Getenv(ctx, "AWS_PROFILE")
+		conf.Profile = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Profile)
+		conf.Profile = &v
+	}
+
+	if conf.RoleARN == nil {
+		v := ""
+		conf.RoleARN = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.RoleARN)
+		conf.RoleARN = &v
+	}
+
+	if conf.ExternalID == nil {
+		v := ""
+		conf.ExternalID = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.ExternalID)
+		conf.ExternalID = &v
+	}
+
+	region := config.AWSRegion(conf.Region, environ.Getter(ctx))
+	conf.Region = &region
+
+	if conf.Bucket == nil {
+		v := environ.Getenv(ctx, "AWS_S3_BUCKET")
+		conf.Bucket = &v
 	} else {
-		v := config.ExpandEnv(*conf.Region)
-		conf.Region = &v
+		v := environ.ExpandEnv(ctx, *conf.Bucket)
+		conf.Bucket = &v
 	}
 
 	if conf.LocalDirectory == nil {
@@ -52,8 +289,124 @@ func Deploy(conf config.AWSS3Config) error {
 		conf.RemoteDirectory = &v
 	}
 
+	if conf.Endpoint == nil {
+		v := environ.Getenv(ctx, "AWS_S3_ENDPOINT")
+		conf.Endpoint = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Endpoint)
+		conf.Endpoint = &v
+	}
+
+	if conf.ForcePathStyle == nil {
+		v := false
+		conf.ForcePathStyle = &v
+	}
+
+	if conf.GzipExtensions == nil {
+		conf.GzipExtensions = []string{}
+	}
+
+	if conf.CacheControl == nil {
+		v := ""
+		conf.CacheControl = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.CacheControl)
+		conf.CacheControl = &v
+	}
+
+	if conf.ACL == nil {
+		v := ""
+		conf.ACL = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.ACL)
+		conf.ACL = &v
+	}
+
+	if conf.ServerSideEncryption == nil {
+		v := ""
+		conf.ServerSideEncryption = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.ServerSideEncryption)
+		conf.ServerSideEncryption = &v
+	}
+
+	if conf.KMSKeyID == nil {
+		v := ""
+		conf.KMSKeyID = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.KMSKeyID)
+		conf.KMSKeyID = &v
+	}
+
+	if conf.SkipUnchanged == nil {
+		v := true
+		conf.SkipUnchanged = &v
+	}
+
+	if conf.Resume == nil {
+		v := false
+		conf.Resume = &v
+	}
+
+	if conf.Delete == nil {
+		v := false
+		conf.Delete = &v
+	}
+
+	if conf.UploadConcurrency == nil {
+		v := 8
+		conf.UploadConcurrency = &v
+	}
+
+	if conf.PartSize == nil {
+		v := ""
+		conf.PartSize = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.PartSize)
+		conf.PartSize = &v
+	}
+
+	if conf.MultipartThreshold == nil {
+		v := ""
+		conf.MultipartThreshold = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.MultipartThreshold)
+		conf.MultipartThreshold = &v
+	}
+
+	if conf.CloudFrontDistributionID == nil {
+		v := ""
+		conf.CloudFrontDistributionID = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.CloudFrontDistributionID)
+		conf.CloudFrontDistributionID = &v
+	}
+
+	if len(conf.InvalidationPaths) == 0 {
+		conf.InvalidationPaths = []string{"/*"}
+	}
+
+	if conf.WaitForInvalidation == nil {
+		v := false
+		conf.WaitForInvalidation = &v
+	}
+
+	// the rules are copied so the ones of the configuration are not modified
+	rules := make([]config.FileRule, len(conf.Rules))
+	for i, rule := range conf.Rules {
+		rule.CacheControl = environ.ExpandEnv(ctx, rule.CacheControl)
+		rule.ContentType = environ.ExpandEnv(ctx, rule.ContentType)
+		rules[i] = rule
+	}
+	conf.Rules = rules
+}
+
+// newSession returns an AWS session for conf, whose requests are cancelled when ctx is done
+func newSession(ctx context.Context, conf config.AWSS3Config) (*session.Session, error) {
 	var awsConf aws.Config
 
+	// without inline keys, the credentials are looked up by the default credential chain: the env
+	// variables, the shared credentials file (using the profile) and the EC2 or ECS role
 	if *conf.AccessKeyID != "" && *conf.SecretAccessKey != "" {
 		awsConf = aws.Config{
 			Credentials: credentials.NewStaticCredentials(*conf.AccessKeyID, *conf.SecretAccessKey, ""),
@@ -61,40 +414,367 @@ func Deploy(conf config.AWSS3Config) error {
 	} else {
 		awsConf = aws.Config{}
 	}
-	awsConf.Region = aws.String(*conf.Region)
-	sess := session.New(&awsConf)
+	// the region of the profile is used if none is set
+	if *conf.Region != "" {
+		awsConf.Region = aws.String(*conf.Region)
+	}
+	// S3 compatible services (DigitalOcean Spaces, Minio...)
+	if *conf.Endpoint != "" {
+		awsConf.Endpoint = aws.String(*conf.Endpoint)
+	}
+	awsConf.S3ForcePathStyle = aws.Bool(*conf.ForcePathStyle)
+	// the connections are bounded by the number of concurrent uploads
+	transport := &http.Transport{
+		Proxy: httpclient.Proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxConnsPerHost:       *conf.UploadConcurrency,
+		MaxIdleConnsPerHost:   *conf.UploadConcurrency,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	awsConf.HTTPClient = httpclient.WithContext(ctx, &http.Client{Transport: transport})
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            awsConf,
+		Profile:           *conf.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil || *conf.RoleARN == "" {
+		return sess, err
+	}
+	return assumeRole(sess, *conf.RoleARN, *conf.ExternalID), nil
+}
 
-	walker, _ := fswalk.NewWalker()
-	filesc, _ := walker.Walk(*conf.LocalDirectory)
+// assumeRole returns a copy of sess using the temporary credentials of the role, assumed with the
+// credentials of sess
+func assumeRole(sess *session.Session, roleARN, externalID string) *session.Session {
+	creds := stscreds.NewCredentials(sess, roleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = "rocket"
+		if externalID != "" {
+			p.ExternalID = aws.String(externalID)
+		}
+	})
+	return sess.Copy(&aws.Config{Credentials: creds})
+}
+
+// localFiles returns the files of the local directory to upload. It fails if the local directory
+// does not exist or can't be walked
+func localFiles(conf config.AWSS3Config) ([]string, error) {
+	info, err := os.Stat(*conf.LocalDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("aws_s3: %s", err.Error())
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("aws_s3: local_directory %s is not a directory", *conf.LocalDirectory)
+	}
+	walker, err := fswalk.NewWalker()
+	if err != nil {
+		return nil, err
+	}
+	filesc, err := walker.Walk(*conf.LocalDirectory)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
 	for file := range filesc {
 		if file.Path == "." || file.IsDir || file.IsSymLink {
 			continue
 		}
-		log.With("file", file.Path).Debug("aws_s3: file to upload")
-		err = UploadFileToS3(conf, sess, file.Path)
-		if err != nil {
-			log.With("file", file.Path).Error(fmt.Sprintf("aws_s3: error uploading a file: %s", err.Error()))
-		} else {
-			log.Info(fmt.Sprintf("aws_s3: file successfully uploaded %s", file.Path))
+		if !filter.Match(conf.Include, conf.Exclude, *conf.LocalDirectory, file.Path) {
+			log.With("file", file.Path).Debug("aws_s3: file excluded")
+			continue
 		}
+		files = append(files, file.Path)
 	}
-	return nil
+	return files, nil
 }
 
-func UploadFileToS3(conf config.AWSS3Config, s *session.Session, filePath string) error {
+// objectKey returns the key of the object for the given local file: its path relative to the local
+// directory, prefixed by the remote directory, so the files of the subdirectories keep their path
+func objectKey(conf config.AWSS3Config, filePath string) string {
+	rel, err := filepath.Rel(*conf.LocalDirectory, filePath)
+	if err != nil {
+		rel = filepath.Base(filePath)
+	}
+	key := path.Join(*conf.RemoteDirectory, filepath.ToSlash(rel))
+	return strings.TrimPrefix(key, "/")
+}
 
-	file, err := os.Open(filePath)
+// normalizeExtension returns the lower case extension, with its leading dot
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// shouldGzip returns true if the extension of the file is one of conf.GzipExtensions
+func shouldGzip(conf config.AWSS3Config, filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	for _, gzipExt := range conf.GzipExtensions {
+		if ext == normalizeExtension(gzipExt) {
+			return true
+		}
+	}
+	return false
+}
+
+// contentType returns the content type of the file: the one of the first matching rule if set, the one
+// of its extension in conf.ContentTypes if any, guessed from its extension otherwise
+func contentType(conf config.AWSS3Config, filePath string) string {
+	if rule, ok := filter.MatchRule(conf.Rules, *conf.LocalDirectory, filePath); ok && rule.ContentType != "" {
+		return rule.ContentType
+	}
+
+	ext := strings.ToLower(filepath.Ext(filePath))
+	for typeExt, contentType := range conf.ContentTypes {
+		if ext == normalizeExtension(typeExt) {
+			return contentType
+		}
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// cacheControl returns the Cache-Control header of the file: the one of the first matching rule if
+// set, conf.CacheControl otherwise
+func cacheControl(conf config.AWSS3Config, filePath string) string {
+	if rule, ok := filter.MatchRule(conf.Rules, *conf.LocalDirectory, filePath); ok && rule.CacheControl != "" {
+		return rule.CacheControl
+	}
+	return *conf.CacheControl
+}
+
+// UploadFileToS3 uploads the file to the bucket. If conf.SkipUnchanged is true and the remote object
+// is identical, the upload is skipped and false is returned
+func UploadFileToS3(conf config.AWSS3Config, s *session.Session, filePath string) (bool, error) {
+	return uploadFile(conf, s, filePath, nil)
+}
+
+// uploadFile is UploadFileToS3, skipping the file if it's recorded in m, and recording it once uploaded.
+// m may be nil
+func uploadFile(conf config.AWSS3Config, s *session.Session, filePath string, m *manifest) (bool, error) {
+	info, err := os.Stat(filePath)
 	if err != nil {
-		return err
+		return false, err
 	}
-	defer file.Close()
+
+	body, err := openBody(conf, filePath)
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
 
 	// Config settings: this is where you choose the bucket, filename, content-type etc.
 	// of the file you're uploading.
-	_, err = s3.New(s).PutObject(&s3.PutObjectInput{
-		Bucket: aws.String(*conf.Bucket),
-		Key:    aws.String(filepath.Join(*conf.RemoteDirectory, filepath.Base(filePath))),
-		Body:   file,
+	input := &s3manager.UploadInput{
+		Bucket:      aws.String(*conf.Bucket),
+		Key:         aws.String(objectKey(conf, filePath)),
+		ContentType: aws.String(contentType(conf, filePath)),
+		Body:        body.ReadSeeker,
+	}
+
+	if shouldGzip(conf, filePath) {
+		input.ContentEncoding = aws.String("gzip")
+		log.With("file", filePath).Debug("aws_s3: file gzipped")
+	}
+
+	if cacheControl := cacheControl(conf, filePath); cacheControl != "" {
+		input.CacheControl = aws.String(cacheControl)
+	}
+
+	// without ACL, the objects get the default permissions of the bucket
+	if *conf.ACL != "" {
+		input.ACL = aws.String(*conf.ACL)
+	}
+
+	// without encryption, the objects get the default encryption of the bucket. Without key, aws:kms
+	// uses the AWS managed key of S3
+	if *conf.ServerSideEncryption != "" {
+		input.ServerSideEncryption = aws.String(*conf.ServerSideEncryption)
+		if *conf.KMSKeyID != "" {
+			input.SSEKMSKeyId = aws.String(*conf.KMSKeyID)
+		}
+	}
+
+	key := *input.Key
+	uploadPrint := ""
+	if m != nil {
+		sum, err := body.MD5()
+		if err != nil {
+			return false, err
+		}
+		uploadPrint = fingerprint(sum, aws.StringValue(input.ContentType), aws.StringValue(input.ContentEncoding),
+			aws.StringValue(input.CacheControl), aws.StringValue(input.ACL), aws.StringValue(input.ServerSideEncryption))
+		if m.done(key, uploadPrint) {
+			return false, nil
+		}
+	}
+
+	svc := s3.New(s)
+	// with resume, the objects uploaded before the interruption of the previous run are also checked
+	if *conf.SkipUnchanged || m != nil {
+		// a missing object, or any other error, means that the file should be uploaded
+		head, err := svc.HeadObject(&s3.HeadObjectInput{
+			Bucket: input.Bucket,
+			Key:    input.Key,
+		})
+		if err == nil && unchanged(head.ETag, head.ContentLength, head.LastModified, body, info.ModTime()) {
+			if m != nil {
+				m.add(key, uploadPrint)
+			}
+			return false, nil
+		}
+	}
+
+	size, err := uploadPartSize(conf, body.Size)
+	if err != nil {
+		return false, err
+	}
+
+	// the uploader switches to a multipart upload for the files larger than its part size, uploading
+	// the parts of a file sequentially as the files are already uploaded concurrently
+	uploader := s3manager.NewUploader(s, func(u *s3manager.Uploader) {
+		u.Concurrency = 1
+		u.PartSize = size
 	})
-	return err
+	_, err = uploader.Upload(input)
+	if err != nil {
+		return false, err
+	}
+	if m != nil {
+		m.add(key, uploadPrint)
+	}
+	return true, nil
+}
+
+// uploadPartSize returns the part size of the uploader for an upload of size bytes: files smaller than
+// conf.MultipartThreshold are uploaded in a single part, the others in parts of conf.PartSize (by default
+// the smallest allowed), grown if the upload would have more parts than allowed
+func uploadPartSize(conf config.AWSS3Config, size int64) (int64, error) {
+	if *conf.MultipartThreshold != "" {
+		threshold, err := config.ParseByteSize(*conf.MultipartThreshold)
+		if err != nil {
+			return 0, err
+		}
+		// the uploader uses a single part for the bodies smaller than its part size
+		if size < threshold && size >= s3manager.MinUploadPartSize {
+			return size + 1, nil
+		}
+	}
+
+	ret := partSize(size)
+	if *conf.PartSize != "" {
+		configured, err := config.ParseByteSize(*conf.PartSize)
+		if err != nil {
+			return 0, err
+		}
+		if configured > ret {
+			ret = configured
+		}
+	}
+	return ret, nil
+}
+
+// partSize returns the size of the parts of a multipart upload of size bytes: the smallest allowed
+// size (5 MiB) unless the upload would have more parts than allowed (10000), limits shared by the
+// S3 compatible services like Backblaze B2
+func partSize(size int64) int64 {
+	ret := s3manager.MinUploadPartSize
+	if size/ret >= s3manager.MaxUploadParts {
+		ret = size/s3manager.MaxUploadParts + 1
+	}
+	return ret
+}
+
+// uploadBody is the content of a file as uploaded
+type uploadBody struct {
+	io.ReadSeeker
+	// Size is the size of the content, in bytes
+	Size int64
+	// file is the opened file if the content is streamed from it
+	file *os.File
+	// sum is the MD5 of the content, once computed
+	sum string
+}
+
+// openBody opens the content of the file as uploaded: streamed from the file, or gzipped in memory if its
+// extension is one of conf.GzipExtensions, so only the gzipped files are loaded in memory
+func openBody(conf config.AWSS3Config, filePath string) (*uploadBody, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if !shouldGzip(conf, filePath) {
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &uploadBody{ReadSeeker: file, Size: info.Size(), file: file}, nil
+	}
+	defer file.Close()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err = io.Copy(gw, file); err != nil {
+		return nil, err
+	}
+	if err = gw.Close(); err != nil {
+		return nil, err
+	}
+	return &uploadBody{ReadSeeker: bytes.NewReader(buf.Bytes()), Size: int64(buf.Len())}, nil
+}
+
+// Close closes the file the content is streamed from, if any
+func (body *uploadBody) Close() error {
+	if body.file == nil {
+		return nil
+	}
+	return body.file.Close()
+}
+
+// MD5 returns the hex encoded MD5 of the content, read from its start. The content is rewound afterward
+func (body *uploadBody) MD5() (string, error) {
+	if body.sum != "" {
+		return body.sum, nil
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	hash := md5.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return "", err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	body.sum = hex.EncodeToString(hash.Sum(nil))
+	return body.sum, nil
+}
+
+// unchanged returns true if the remote object, described by its ETag, size and last modification time,
+// has the same content as body.
+// The ETag of an object uploaded with a single PUT is the MD5 of its content, but not for multipart
+// uploads (the ETag then contains a '-'), in which case the size and last modification time are compared
+func unchanged(etag *string, size *int64, lastModified *time.Time, body *uploadBody, modTime time.Time) bool {
+	if etag == nil {
+		return false
+	}
+	sum := strings.Trim(*etag, `"`)
+	if !strings.Contains(sum, "-") {
+		// failing to read the file means that it should be uploaded, which fails with the same error
+		md5sum, err := body.MD5()
+		return err == nil && sum == md5sum
+	}
+	if size == nil || lastModified == nil {
+		return false
+	}
+	return *size == body.Size && !lastModified.Before(modTime)
 }
@@ -0,0 +1,193 @@
+package awss3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUploadFilesSameBaseName(t *testing.T) {
+	// the bucket records the content uploaded to each key
+	var mu sync.Mutex
+	objects := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		objects[strings.TrimPrefix(r.URL.Path, "/my-bucket/")] = string(data)
+		mu.Unlock()
+		w.Header().Set("ETag", `"etag"`)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "rocket_awss3_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	expected := map[string]string{
+		"index.html":           "home",
+		"blog/index.html":      "blog",
+		"blog/2019/index.html": "2019",
+	}
+	files := []string{}
+	for key, content := range expected {
+		file := filepath.Join(dir, filepath.FromSlash(key))
+		if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+
+	conf := s3Config(dir, "/")
+	conf.AccessKeyID = stringPtr("AKID")
+	conf.SecretAccessKey = stringPtr("secret")
+	conf.Region = stringPtr("us-east-1")
+	conf.Bucket = stringPtr("my-bucket")
+	conf.Endpoint = stringPtr(server.URL)
+	conf.ForcePathStyle = boolPtr(true)
+	conf.SkipUnchanged = boolPtr(false)
+	// the files are uploaded in parallel, two files with the same key would overwrite each other
+	concurrency := len(files)
+	conf.UploadConcurrency = &concurrency
+	// a custom CA bundle can't be loaded into the transport of the session
+	if caBundle, ok := os.LookupEnv("AWS_CA_BUNDLE"); ok {
+		os.Unsetenv("AWS_CA_BUNDLE")
+		defer os.Setenv("AWS_CA_BUNDLE", caBundle)
+	}
+	ctx := context.Background()
+	setDefaults(ctx, &conf)
+	sess, err := newSession(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploaded, _, failed := uploadFiles(ctx, conf, sess, files, nil)
+	if uploaded != len(files) || len(failed) != 0 {
+		t.Fatalf("%d file(s) uploaded, expected %d, errors: %v", uploaded, len(files), failed)
+	}
+	if !reflect.DeepEqual(objects, expected) {
+		t.Errorf("uploaded objects %v, expected %v", objects, expected)
+	}
+}
+
+func TestDeployMissingLocalDirectory(t *testing.T) {
+	// the bucket fails the test on any request, the deletion of the orphans included
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "rocket_awss3_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, localDirectory := range []string{filepath.Join(dir, "missing"), filepath.Join(dir, "file")} {
+		if err = ioutil.WriteFile(filepath.Join(dir, "file"), []byte("file"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		conf := s3Config(localDirectory, "/")
+		conf.AccessKeyID = stringPtr("AKID")
+		conf.SecretAccessKey = stringPtr("secret")
+		conf.Region = stringPtr("us-east-1")
+		conf.Bucket = stringPtr("my-bucket")
+		conf.Endpoint = stringPtr(server.URL)
+		conf.ForcePathStyle = boolPtr(true)
+		conf.Delete = boolPtr(true)
+
+		if err = DeployContext(context.Background(), conf, false); err == nil {
+			t.Errorf("%s: expected an error", localDirectory)
+		}
+	}
+	if requests != 0 {
+		t.Errorf("%d request(s) sent to the bucket", requests)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestOpenBody(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rocket_awss3_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := []byte(strings.Repeat("rocket ", 1000))
+	for _, name := range []string{"app.js", "app.css"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conf := s3Config(dir, "/")
+	conf.GzipExtensions = []string{"css"}
+
+	// the files which are not gzipped are streamed from the file
+	body, err := openBody(conf, filepath.Join(dir, "app.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	if _, ok := body.ReadSeeker.(*os.File); !ok {
+		t.Errorf("app.js is read from a %T, expected an *os.File", body.ReadSeeker)
+	}
+	sum := md5.Sum(content)
+	if got, err := body.MD5(); err != nil || got != hex.EncodeToString(sum[:]) {
+		t.Errorf("MD5() = %q, %v, expected %q", got, err, hex.EncodeToString(sum[:]))
+	}
+	// the body is rewound after the computation of its MD5
+	data, err := ioutil.ReadAll(body)
+	if err != nil || !bytes.Equal(data, content) || body.Size != int64(len(content)) {
+		t.Errorf("app.js: read %d bytes (size %d), expected %d", len(data), body.Size, len(content))
+	}
+
+	gzipped, err := openBody(conf, filepath.Join(dir, "app.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gzipped.Close()
+	data, err = ioutil.ReadAll(gzipped)
+	if err != nil || int64(len(data)) != gzipped.Size {
+		t.Fatalf("app.css: read %d bytes, expected %d", len(data), gzipped.Size)
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = ioutil.ReadAll(gr); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("app.css: the gzipped content differs from the file")
+	}
+}
@@ -0,0 +1,291 @@
+package azureblob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloom42/astroflow-go/log"
+	"github.com/z0mbie42/fswalk"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/filter"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/providers/upload"
+	"github.com/bloom42/rocket/version"
+)
+
+const apiVersion = "2018-03-28"
+
+// Client is an wrapper to perform various task against the Azure Blob Storage REST API
+type Client struct {
+	HTTP      *http.Client
+	UserAgent string
+	Config    config.AzureBlobConfig
+}
+
+func init() {
+	registry.Register("azure_blob", func(conf config.Config) registry.Provider {
+		if conf.AzureBlob == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.AzureBlob.Env, When: conf.AzureBlob.When, Timeout: conf.AzureBlob.Timeout}
+		return registry.New("azure_blob", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.AzureBlob, conf.DryRun)
+		})
+	})
+}
+
+// Deploy perform the Azure Blob Storage upload
+func Deploy(conf config.AzureBlobConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.AzureBlobConfig, dryRun bool) error {
+	var err error
+
+	if conf.AccountName == nil {
+		v := environ.Getenv(ctx, "AZURE_STORAGE_ACCOUNT")
+		conf.AccountName = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.AccountName)
+		conf.AccountName = &v
+	}
+
+	if conf.AccountKey == nil {
+		v := environ.Getenv(ctx, "AZURE_STORAGE_KEY")
+		conf.AccountKey = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.AccountKey)
+		conf.AccountKey = &v
+	}
+
+	if conf.SASToken == nil {
+		v := environ.Getenv(ctx, "AZURE_STORAGE_SAS_TOKEN")
+		conf.SASToken = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.SASToken)
+		conf.SASToken = &v
+	}
+
+	if conf.Container == nil {
+		v := environ.Getenv(ctx, "AZURE_STORAGE_CONTAINER")
+		conf.Container = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Container)
+		conf.Container = &v
+	}
+
+	if conf.LocalDirectory == nil {
+		v := "."
+		conf.LocalDirectory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.LocalDirectory)
+		conf.LocalDirectory = &v
+	}
+
+	if conf.RemoteDirectory == nil {
+		v := ""
+		conf.RemoteDirectory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.RemoteDirectory)
+		conf.RemoteDirectory = &v
+	}
+
+	client := NewClient(conf)
+	client.HTTP = httpclient.WithContext(ctx, client.HTTP)
+
+	// a missing local directory would otherwise upload no file and succeed
+	info, err := os.Stat(*conf.LocalDirectory)
+	if err != nil {
+		return fmt.Errorf("azure_blob: %s", err.Error())
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("azure_blob: local_directory %s is not a directory", *conf.LocalDirectory)
+	}
+	walker, err := fswalk.NewWalker()
+	if err != nil {
+		return err
+	}
+	filesc, err := walker.Walk(*conf.LocalDirectory)
+	if err != nil {
+		return err
+	}
+	files := []string{}
+	for file := range filesc {
+		if file.Path == "." || file.IsDir || file.IsSymLink {
+			continue
+		}
+		if !filter.Match(conf.Include, conf.Exclude, *conf.LocalDirectory, file.Path) {
+			log.With("file", file.Path).Debug("azure_blob: file excluded")
+			continue
+		}
+		files = append(files, file.Path)
+	}
+
+	if !dryRun {
+		log.Info(fmt.Sprintf("azure_blob: uploading %d files to container %s", len(files), *conf.Container))
+	}
+	failed := map[string]error{}
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.With("file", file).Debug("azure_blob: file to upload")
+		if dryRun {
+			log.Info(fmt.Sprintf("azure_blob: would upload %s to %s", file, client.blobURL(file)))
+			continue
+		}
+		err = client.UploadFile(file)
+		if err != nil {
+			failed[file] = err
+			log.With("file", file).Error(fmt.Sprintf("azure_blob: error uploading a file: %s", err.Error()))
+		} else {
+			log.Info(fmt.Sprintf("azure_blob: file successfully uploaded %s", file))
+		}
+	}
+	if len(failed) != 0 {
+		return upload.Error("azure_blob", failed)
+	}
+	return nil
+}
+
+// NewClient create a Client with the given configuration
+func NewClient(conf config.AzureBlobConfig) Client {
+	return Client{&http.Client{}, fmt.Sprintf("rocket/%s", version.Version), conf}
+}
+
+// blobName returns the name of the blob for the given local file: its path relative to
+// the local directory, prefixed by the remote directory
+func (c *Client) blobName(filePath string) string {
+	rel, err := filepath.Rel(*c.Config.LocalDirectory, filePath)
+	if err != nil {
+		rel = filepath.Base(filePath)
+	}
+	name := path.Join(*c.Config.RemoteDirectory, filepath.ToSlash(rel))
+	return strings.TrimPrefix(name, "/")
+}
+
+// blobURL returns the URL of the blob for the given local file, without authentication
+func (c *Client) blobURL(filePath string) string {
+	u := url.URL{
+		Scheme: "https",
+		Host:   fmt.Sprintf("%s.blob.core.windows.net", *c.Config.AccountName),
+		Path:   fmt.Sprintf("/%s/%s", *c.Config.Container, c.blobName(filePath)),
+	}
+	return u.String()
+}
+
+// UploadFile upload the given file as a block blob
+func (c *Client) UploadFile(filePath string) error {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(filePath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	blobURL := c.blobURL(filePath)
+	if *c.Config.AccountKey == "" && *c.Config.SASToken != "" {
+		blobURL += "?" + strings.TrimPrefix(*c.Config.SASToken, "?")
+	}
+
+	req, err := http.NewRequest("PUT", blobURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", c.UserAgent)
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", apiVersion)
+
+	if *c.Config.AccountKey != "" {
+		err = c.sign(req)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return nil
+}
+
+// sign set the Authorization header of the request using the Shared Key authorization scheme
+// https://docs.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func (c *Client) sign(req *http.Request) error {
+	key, err := base64.StdEncoding.DecodeString(*c.Config.AccountKey)
+	if err != nil {
+		return fmt.Errorf("azure_blob: account_key is not valid base64: %s", err.Error())
+	}
+
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	msHeaders := []string{}
+	for name := range req.Header {
+		lowerName := strings.ToLower(name)
+		if strings.HasPrefix(lowerName, "x-ms-") {
+			msHeaders = append(msHeaders, lowerName+":"+strings.TrimSpace(req.Header.Get(name)))
+		}
+	}
+	sort.Strings(msHeaders)
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, x-ms-date is used instead
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		strings.Join(msHeaders, "\n"),
+		fmt.Sprintf("/%s%s", *c.Config.AccountName, req.URL.EscapedPath()),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", *c.Config.AccountName, signature))
+	return nil
+}
@@ -0,0 +1,121 @@
+package cargo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/command"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/registry"
+)
+
+func init() {
+	registry.Register("cargo", func(conf config.Config) registry.Provider {
+		if conf.Cargo == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.Cargo.Env, When: conf.Cargo.When, Timeout: conf.Cargo.Timeout}
+		return registry.New("cargo", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.Cargo, conf.DryRun)
+		})
+	})
+}
+
+// Deploy publish the crate of the directory with cargo publish
+func Deploy(conf config.CargoConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.CargoConfig, dryRun bool) error {
+	if conf.Token == nil {
+		v := environ.Getenv(ctx, "CARGO_REGISTRY_TOKEN")
+		conf.Token = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Token)
+		conf.Token = &v
+	}
+
+	if conf.Directory == nil {
+		v := "."
+		conf.Directory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Directory)
+		conf.Directory = &v
+	}
+
+	if conf.DryRun == nil {
+		v := false
+		conf.DryRun = &v
+	}
+
+	if conf.AllowDirty == nil {
+		v := false
+		conf.AllowDirty = &v
+	}
+
+	if conf.Registry == nil {
+		v := ""
+		conf.Registry = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Registry)
+		conf.Registry = &v
+	}
+
+	args := []string{"publish"}
+	if *conf.DryRun {
+		args = append(args, "--dry-run")
+	}
+	if *conf.AllowDirty {
+		args = append(args, "--allow-dirty")
+	}
+
+	// the token is passed through the environment so it does not appear in the arguments of the process
+	env := environ.Environ(ctx)
+	switch {
+	case *conf.Registry == "":
+		env = append(env, "CARGO_REGISTRY_TOKEN="+*conf.Token)
+	case strings.Contains(*conf.Registry, "://"):
+		// an index URL, which has no name to pass the token through CARGO_REGISTRIES_<name>_TOKEN
+		args = append(args, "--index", *conf.Registry)
+		env = append(env, "CARGO_REGISTRY_TOKEN="+*conf.Token)
+	default:
+		args = append(args, "--registry", *conf.Registry)
+		name := strings.ToUpper(strings.Replace(*conf.Registry, "-", "_", -1))
+		env = append(env, fmt.Sprintf("CARGO_REGISTRIES_%s_TOKEN=%s", name, *conf.Token))
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("cargo: would execute cargo %s in %s", strings.Join(args, " "), *conf.Directory))
+		return nil
+	}
+
+	log.With("directory", *conf.Directory, "args", args).Debug("cargo: publishing")
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "cargo", args...)
+	cmd.Dir = *conf.Directory
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	err := cmd.Run()
+	if err != nil {
+		exitCode, _ := command.ExitCode(err)
+		return fmt.Errorf("cargo: publish failed with exit code %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	if *conf.DryRun {
+		log.Info(fmt.Sprintf("cargo: crate in %s successfully verified (dry run)", *conf.Directory))
+	} else {
+		log.Info(fmt.Sprintf("cargo: crate in %s successfully published", *conf.Directory))
+	}
+	return nil
+}
@@ -0,0 +1,374 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+	"github.com/z0mbie42/fswalk"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/filter"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/version"
+)
+
+const apiURL = "https://api.cloudflare.com/client/v4"
+
+// Client is an wrapper to perform various task against the Cloudflare API
+type Client struct {
+	Token     string
+	HTTP      *http.Client
+	UserAgent string
+	Config    config.CloudflareConfig
+}
+
+// File is a file of the deployment
+type File struct {
+	Path        string
+	Hash        string
+	ContentType string
+}
+
+// Response is the envelope of all the Cloudflare API responses
+type Response struct {
+	Success bool            `json:"success"`
+	Errors  []ResponseError `json:"errors"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// ResponseError is an error returned by the Cloudflare API
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// UploadPayload is an asset of the https://api.cloudflare.com/client/v4/pages/assets/upload API call
+type UploadPayload struct {
+	Key      string            `json:"key"`
+	Value    string            `json:"value"`
+	Metadata map[string]string `json:"metadata"`
+	Base64   bool              `json:"base64"`
+}
+
+// Deployment is the result of the
+// https://api.cloudflare.com/client/v4/accounts/{account_id}/pages/projects/{project_name}/deployments API call
+type Deployment struct {
+	ID          string `json:"id"`
+	URL         string `json:"url"`
+	Environment string `json:"environment"`
+}
+
+func init() {
+	registry.Register("cloudflare", func(conf config.Config) registry.Provider {
+		if conf.Cloudflare == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.Cloudflare.Env, When: conf.Cloudflare.When, Timeout: conf.Cloudflare.Timeout}
+		return registry.New("cloudflare", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.Cloudflare, conf.DryRun)
+		})
+	})
+}
+
+// Deploy perform the Cloudflare Pages deployment with the following steps:
+// upload the missing files of the directory
+// create a deployment with the manifest of all the files
+func Deploy(conf config.CloudflareConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.CloudflareConfig, dryRun bool) error {
+	if conf.APIToken == nil {
+		v := environ.Getenv(ctx, "CLOUDFLARE_API_TOKEN")
+		conf.APIToken = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.APIToken)
+		conf.APIToken = &v
+	}
+
+	if conf.AccountID == nil {
+		v := environ.Getenv(ctx, "CLOUDFLARE_ACCOUNT_ID")
+		conf.AccountID = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.AccountID)
+		conf.AccountID = &v
+	}
+
+	if conf.ProjectName == nil {
+		v := ""
+		conf.ProjectName = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.ProjectName)
+		conf.ProjectName = &v
+	}
+
+	if conf.Directory == nil {
+		v := "."
+		conf.Directory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Directory)
+		conf.Directory = &v
+	}
+
+	if conf.Branch == nil {
+		v := environ.Getenv(ctx, "ROCKET_BRANCH")
+		conf.Branch = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Branch)
+		conf.Branch = &v
+	}
+
+	if *conf.ProjectName == "" {
+		return fmt.Errorf("cloudflare: project_name is required")
+	}
+
+	client := NewClient(conf, *conf.APIToken)
+	client.HTTP = httpclient.WithContext(ctx, client.HTTP)
+
+	files := []File{}
+	walker, _ := fswalk.NewWalker()
+	filesc, _ := walker.Walk(*conf.Directory)
+	for file := range filesc {
+		if file.Path == "." || file.IsDir || file.IsSymLink {
+			continue
+		}
+		if !filter.Match(conf.Include, conf.Exclude, *conf.Directory, file.Path) {
+			log.With("file", file.Path).Debug("cloudflare: file excluded")
+			continue
+		}
+		f, err := hashFile(file.Path)
+		if err != nil {
+			return err
+		}
+		log.With("file", file.Path, "hash", f.Hash).Debug("cloudflare: file to deploy")
+		files = append(files, f)
+	}
+
+	if dryRun {
+		for _, file := range files {
+			log.Info(fmt.Sprintf("cloudflare: would upload %s", file.Path))
+		}
+		log.Info(fmt.Sprintf("cloudflare: would create a deployment of %s on branch %s", *conf.ProjectName, *conf.Branch))
+		return nil
+	}
+
+	jwt, err := client.GetUploadToken()
+	if err != nil {
+		return err
+	}
+
+	missing, err := client.CheckMissing(jwt, files)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if !missing[file.Hash] {
+			log.With("file", file.Path).Debug("cloudflare: file already uploaded")
+			continue
+		}
+		err = client.UploadFile(jwt, file)
+		if err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("cloudflare: file successfully uploaded %s", file.Path))
+	}
+
+	err = client.UpsertHashes(jwt, files)
+	if err != nil {
+		return err
+	}
+
+	deployment, err := client.CreateDeployment(files)
+	if err != nil {
+		return err
+	}
+
+	log.With("id", deployment.ID).Debug("cloudflare: deployment created")
+	log.Info(fmt.Sprintf("cloudflare: deployment successfully created %s", deployment.URL))
+	return nil
+}
+
+// NewClient create a Client with the given configuration
+func NewClient(conf config.CloudflareConfig, token string) Client {
+	return Client{token, &http.Client{}, fmt.Sprintf("rocket/%s", version.Version), conf}
+}
+
+// hashFile computes the content hash identifying the file in the project's assets
+func hashFile(path string) (File, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return File{}, err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	h := sha256.New()
+	h.Write(data)
+	h.Write([]byte(filepath.Ext(path)))
+	hash := fmt.Sprintf("%x", h.Sum(nil))[:32]
+
+	return File{Path: path, Hash: hash, ContentType: contentType}, nil
+}
+
+// manifestPath returns the path of the file in the deployment, relative to the directory
+func (c *Client) manifestPath(filePath string) string {
+	rel, err := filepath.Rel(*c.Config.Directory, filePath)
+	if err != nil {
+		rel = filePath
+	}
+	return "/" + filepath.ToSlash(rel)
+}
+
+func (c *Client) do(method, url, token, contentType string, payload io.Reader, result interface{}) error {
+	req, err := http.NewRequest(method, url, payload)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var response Response
+	if err = json.Unmarshal(body, &response); err != nil || !response.Success {
+		return &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	if result != nil {
+		return json.Unmarshal(response.Result, result)
+	}
+	return nil
+}
+
+func (c *Client) doJSON(method, url, token string, payload, result interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return c.do(method, url, token, "application/json", bytes.NewReader(data), result)
+}
+
+// GetUploadToken returns the JWT used to upload the project's assets
+func (c *Client) GetUploadToken() (string, error) {
+	var result struct {
+		JWT string `json:"jwt"`
+	}
+
+	url := fmt.Sprintf("%s/accounts/%s/pages/projects/%s/upload-token", apiURL, *c.Config.AccountID, *c.Config.ProjectName)
+	err := c.do("GET", url, c.Token, "", nil, &result)
+	return result.JWT, err
+}
+
+// CheckMissing returns the hashes of the files which are not already uploaded
+func (c *Client) CheckMissing(jwt string, files []File) (map[string]bool, error) {
+	hashes := make([]string, len(files))
+	for i, file := range files {
+		hashes[i] = file.Hash
+	}
+
+	var result []string
+	err := c.doJSON("POST", apiURL+"/pages/assets/check-missing", jwt, map[string][]string{"hashes": hashes}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]bool, len(result))
+	for _, hash := range result {
+		ret[hash] = true
+	}
+	return ret, nil
+}
+
+// UploadFile upload the given file to the project's assets
+func (c *Client) UploadFile(jwt string, file File) error {
+	data, err := ioutil.ReadFile(file.Path)
+	if err != nil {
+		return err
+	}
+
+	payload := []UploadPayload{{
+		Key:      file.Hash,
+		Value:    base64.StdEncoding.EncodeToString(data),
+		Metadata: map[string]string{"contentType": file.ContentType},
+		Base64:   true,
+	}}
+	return c.doJSON("POST", apiURL+"/pages/assets/upload", jwt, payload, nil)
+}
+
+// UpsertHashes mark the given files as used by the project
+func (c *Client) UpsertHashes(jwt string, files []File) error {
+	hashes := make([]string, len(files))
+	for i, file := range files {
+		hashes[i] = file.Hash
+	}
+
+	return c.doJSON("POST", apiURL+"/pages/assets/upsert-hashes", jwt, map[string][]string{"hashes": hashes}, nil)
+}
+
+// CreateDeployment create a deployment of the given files
+func (c *Client) CreateDeployment(files []File) (Deployment, error) {
+	var ret Deployment
+
+	manifest := make(map[string]string, len(files))
+	for _, file := range files {
+		manifest[c.manifestPath(file.Path)] = file.Hash
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return ret, err
+	}
+
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	if err = writer.WriteField("manifest", string(manifestJSON)); err != nil {
+		return ret, err
+	}
+	if *c.Config.Branch != "" {
+		if err = writer.WriteField("branch", strings.TrimSpace(*c.Config.Branch)); err != nil {
+			return ret, err
+		}
+	}
+	if commitHash := os.Getenv("ROCKET_COMMIT_HASH"); commitHash != "" {
+		if err = writer.WriteField("commit_hash", commitHash); err != nil {
+			return ret, err
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return ret, err
+	}
+
+	url := fmt.Sprintf("%s/accounts/%s/pages/projects/%s/deployments", apiURL, *c.Config.AccountID, *c.Config.ProjectName)
+	err = c.do("POST", url, c.Token, writer.FormDataContentType(), payload, &ret)
+	return ret, err
+}
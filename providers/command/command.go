@@ -0,0 +1,19 @@
+package command
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// ExitCode returns the exit code of the command which returned err from its Run or Wait method, and
+// whether the command ran and exited. The exit code is -1 if it's not known
+func ExitCode(err error) (int, bool) {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return -1, false
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+		return status.ExitStatus(), true
+	}
+	return -1, true
+}
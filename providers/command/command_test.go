@@ -0,0 +1,23 @@
+package command
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	err := exec.Command("sh", "-c", "exit 3").Run()
+	if code, ok := ExitCode(err); code != 3 || !ok {
+		t.Errorf("ExitCode() = %d, %t, expected 3, true", code, ok)
+	}
+
+	err = exec.Command("rocket-command-not-found").Run()
+	if code, ok := ExitCode(err); code != -1 || ok {
+		t.Errorf("ExitCode() = %d, %t, expected -1, false for a command which did not run", code, ok)
+	}
+
+	if code, ok := ExitCode(errors.New("error")); code != -1 || ok {
+		t.Errorf("ExitCode() = %d, %t, expected -1, false", code, ok)
+	}
+}
@@ -1,17 +1,25 @@
 package docker
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
 
 	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/registry"
 )
 
-func exe(script string) error {
-	script = config.ExpandEnv(script)
-	cmd := exec.Command("sh", "-c", script)
+func exe(ctx context.Context, script string) error {
+	script = environ.ExpandEnv(ctx, script)
+	cmd := exec.CommandContext(ctx, "sh", "-c", script)
+	cmd.Env = environ.Environ(ctx)
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -41,46 +49,235 @@ func exe(script string) error {
 
 }
 
-func Deploy(conf config.DockerConfig) error {
+func init() {
+	registry.Register("docker", func(conf config.Config) registry.Provider {
+		if conf.Docker == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.Docker.Env, When: conf.Docker.When, Timeout: conf.Docker.Timeout}
+		return registry.New("docker", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.Docker, conf.DryRun)
+		})
+	})
+}
+
+func Deploy(conf config.DockerConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.DockerConfig, dryRun bool) error {
 	var err error
 
 	if conf.Username == nil {
-		v := os.Getenv("DOCKER_USERNAME")
+		v := environ.Getenv(ctx, "DOCKER_USERNAME")
 		conf.Username = &v
 	} else {
-		v := config.ExpandEnv(*conf.Username)
+		v := environ.ExpandEnv(ctx, *conf.Username)
 		conf.Username = &v
 	}
 
 	if conf.Password == nil {
-		v := os.Getenv("DOCKER_PASSWORD")
+		v := environ.Getenv(ctx, "DOCKER_PASSWORD")
 		conf.Password = &v
 	} else {
-		v := config.ExpandEnv(*conf.Password)
+		v := environ.ExpandEnv(ctx, *conf.Password)
 		conf.Password = &v
 	}
 
+	// without login set, docker login is executed only with credentials, otherwise the ones of the docker
+	// config are used
 	if conf.Login == nil {
-		v := true
+		v := *conf.Username != "" && *conf.Password != ""
 		conf.Login = &v
 	}
 
+	if conf.RegistryType == nil {
+		v := "docker"
+		conf.RegistryType = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.RegistryType)
+		conf.RegistryType = &v
+	}
+
 	if conf.Images == nil {
 		conf.Images = []string{}
+	} else {
+		images := make([]string, len(conf.Images))
+		for i, image := range conf.Images {
+			images[i] = environ.ExpandEnv(ctx, image)
+		}
+		conf.Images = images
+	}
+
+	if conf.ExtraTags == nil {
+		conf.ExtraTags = []string{}
+	} else {
+		tags := make([]string, len(conf.ExtraTags))
+		for i, tag := range conf.ExtraTags {
+			tags[i] = environ.ExpandEnv(ctx, tag)
+		}
+		conf.ExtraTags = tags
+	}
+
+	if conf.Buildx == nil {
+		v := false
+		conf.Buildx = &v
+	}
+
+	if conf.Platforms == nil {
+		conf.Platforms = []string{}
+	}
+
+	if conf.Build == nil {
+		v := false
+		conf.Build = &v
+	}
+
+	if conf.Dockerfile != nil {
+		v := environ.ExpandEnv(ctx, *conf.Dockerfile)
+		conf.Dockerfile = &v
+	}
+
+	if conf.Context == nil {
+		v := "."
+		conf.Context = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Context)
+		conf.Context = &v
+	}
+
+	hosts := registryHosts(conf.Images)
+
+	if dryRun {
+		switch {
+		case *conf.RegistryType == "ecr" || *conf.RegistryType == "gcr":
+			log.Info(fmt.Sprintf("docker: would login to %s with a %s token", strings.Join(hosts, ", "), strings.ToUpper(*conf.RegistryType)))
+		case *conf.Login:
+			log.Info(fmt.Sprintf("docker: would login as %s", *conf.Username))
+		}
+		if *conf.Buildx {
+			log.Info(fmt.Sprintf("docker: would execute %s", buildxCommand(ctx, conf)))
+			return nil
+		}
+		if *conf.Build {
+			log.Info(fmt.Sprintf("docker: would execute %s", buildCommand(ctx, conf)))
+		}
+		for _, image := range conf.Images {
+			for _, tag := range extraTags(conf, image) {
+				log.Info(fmt.Sprintf("docker: would tag %s as %s", image, tag))
+			}
+			log.Info(fmt.Sprintf("docker: would push %s", image))
+		}
+		return nil
 	}
 
 	// actually deploy
-	if *conf.Login == true {
-		if err = exe(fmt.Sprintf("docker login -u %s -p %s", *conf.Username, *conf.Password)); err != nil {
+	switch {
+	case *conf.RegistryType == "ecr":
+		err = loginECR(ctx, hosts)
+	case *conf.RegistryType == "gcr":
+		err = loginGCR(ctx, hosts, *conf.Password)
+	case *conf.Login:
+		err = login(ctx, *conf.Username, *conf.Password, "")
+	default:
+		checkCredentials(ctx, hosts)
+	}
+	if err != nil {
+		return err
+	}
+
+	// buildx builds the images for all the platforms and pushes them with a multi-arch manifest
+	if *conf.Buildx {
+		return exe(ctx, buildxCommand(ctx, conf))
+	}
+
+	if *conf.Build {
+		if err = exe(ctx, buildCommand(ctx, conf)); err != nil {
 			return err
 		}
 	}
 
 	for _, image := range conf.Images {
-		if err = exe(fmt.Sprintf("docker push %s", config.ExpandEnv(image))); err != nil {
+		if err = exe(ctx, fmt.Sprintf("docker push %s", image)); err != nil {
 			return err
 		}
+		for _, tag := range extraTags(conf, image) {
+			if err = exe(ctx, fmt.Sprintf("docker tag %s %s", image, tag)); err != nil {
+				return err
+			}
+			if err = exe(ctx, fmt.Sprintf("docker push %s", tag)); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
+
+// extraTags returns the image names of conf.ExtraTags for the given image,
+// e.g: myorg/app:latest for the image myorg/app:v1.0.0 and the latest tag
+func extraTags(conf config.DockerConfig, image string) []string {
+	repository := image
+	// the last colon may be the port of the registry (e.g: localhost:5000/app)
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		repository = image[:i]
+	}
+	ret := make([]string, len(conf.ExtraTags))
+	for i, tag := range conf.ExtraTags {
+		ret[i] = repository + ":" + tag
+	}
+	return ret
+}
+
+// buildCommand returns the docker build command building conf.Context as each of conf.Images
+func buildCommand(ctx context.Context, conf config.DockerConfig) string {
+	args := append([]string{"docker", "build"}, buildArgs(ctx, conf)...)
+	for _, image := range conf.Images {
+		args = append(args, "--tag", image)
+	}
+	return strings.Join(append(args, quote(*conf.Context)), " ")
+}
+
+// buildArgs returns the --file and --build-arg flags of the build commands. The build args are
+// sorted so the command does not change between runs
+func buildArgs(ctx context.Context, conf config.DockerConfig) []string {
+	args := []string{}
+	if conf.Dockerfile != nil {
+		args = append(args, "--file", quote(*conf.Dockerfile))
+	}
+	keys := make([]string, 0, len(conf.BuildArgs))
+	for key := range conf.BuildArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--build-arg", quote(fmt.Sprintf("%s=%s", key, environ.ExpandEnv(ctx, conf.BuildArgs[key]))))
+	}
+	return args
+}
+
+// quote single quotes s for the shell, as build args may contain spaces or quotes
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
+
+// buildxCommand returns the docker buildx command building conf.Context for conf.Platforms
+// and pushing it as each of conf.Images
+func buildxCommand(ctx context.Context, conf config.DockerConfig) string {
+	args := append([]string{"docker", "buildx", "build", "--push"}, buildArgs(ctx, conf)...)
+	if len(conf.Platforms) != 0 {
+		platforms := make([]string, len(conf.Platforms))
+		for i, platform := range conf.Platforms {
+			platforms[i] = environ.ExpandEnv(ctx, platform)
+		}
+		args = append(args, "--platform", strings.Join(platforms, ","))
+	}
+	for _, image := range conf.Images {
+		args = append(args, "--tag", image)
+		for _, tag := range extraTags(conf, image) {
+			args = append(args, "--tag", tag)
+		}
+	}
+	return strings.Join(append(args, quote(*conf.Context)), " ")
+}
@@ -0,0 +1,201 @@
+package docker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/httpclient"
+)
+
+// dockerHubAuthKey is the key of the Docker Hub credentials in the auths of the docker config
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// ecrHost matches the ECR registries, e.g: 123456789012.dkr.ecr.eu-west-1.amazonaws.com
+var ecrHost = regexp.MustCompile(`^(\d+)\.dkr\.ecr\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// dockerConfig is the content of the docker config file (~/.docker/config.json) used to find the credentials
+// of a registry
+type dockerConfig struct {
+	Auths       map[string]json.RawMessage `json:"auths"`
+	CredsStore  string                     `json:"credsStore"`
+	CredHelpers map[string]string          `json:"credHelpers"`
+}
+
+// registryHost returns the registry of the image, docker.io for the images of Docker Hub
+func registryHost(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return "docker.io"
+}
+
+// registryHosts returns the sorted registries of the images
+func registryHosts(images []string) []string {
+	seen := map[string]bool{}
+	hosts := []string{}
+	for _, image := range images {
+		host := registryHost(image)
+		if !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// isGCRHost returns true if host is a Google Container Registry or Artifact Registry
+func isGCRHost(host string) bool {
+	return host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") || strings.HasSuffix(host, "-docker.pkg.dev")
+}
+
+// login executes docker login, with the password read from stdin so it's not visible in the processes
+func login(ctx context.Context, username, password, host string) error {
+	args := []string{"login", "--username", username, "--password-stdin"}
+	if host != "" {
+		args = append(args, host)
+	}
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Env = environ.Environ(ctx)
+	cmd.Stdin = strings.NewReader(password)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if host == "" {
+			return fmt.Errorf("docker: login failed: %s", err.Error())
+		}
+		return fmt.Errorf("docker: login to %s failed: %s", host, err.Error())
+	}
+	return nil
+}
+
+// loginECR exchanges the AWS credentials of the default credential chain (env variables, shared credentials
+// file, EC2 or ECS role) for an authorization token of each ECR registry of hosts, and logs in with it
+func loginECR(ctx context.Context, hosts []string) error {
+	registries := 0
+	for _, host := range hosts {
+		match := ecrHost.FindStringSubmatch(host)
+		if match == nil {
+			continue
+		}
+		registries++
+		sess, err := session.NewSessionWithOptions(session.Options{
+			Config: aws.Config{
+				Region:     aws.String(match[2]),
+				HTTPClient: httpclient.WithContext(ctx, &http.Client{}),
+			},
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if err != nil {
+			return err
+		}
+
+		out, err := ecr.New(sess).GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{
+			RegistryIds: []*string{aws.String(match[1])},
+		})
+		if err != nil {
+			return fmt.Errorf("docker: getting the ECR authorization token of %s: %s", host, err.Error())
+		}
+		if len(out.AuthorizationData) == 0 {
+			return fmt.Errorf("docker: no ECR authorization token returned for %s", host)
+		}
+		// the token is the base64 encoded AWS:password
+		token, err := base64.StdEncoding.DecodeString(aws.StringValue(out.AuthorizationData[0].AuthorizationToken))
+		if err != nil {
+			return fmt.Errorf("docker: decoding the ECR authorization token of %s: %s", host, err.Error())
+		}
+		parts := strings.SplitN(string(token), ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("docker: malformed ECR authorization token for %s", host)
+		}
+		if err = login(ctx, parts[0], parts[1], host); err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("docker: logged in to %s", host))
+	}
+	if registries == 0 {
+		return fmt.Errorf("docker: none of the images is in an ECR registry")
+	}
+	return nil
+}
+
+// loginGCR logs in to each Google registry of hosts with the JSON key of a service account, which is
+// password if set, or the content of the $GOOGLE_APPLICATION_CREDENTIALS file
+func loginGCR(ctx context.Context, hosts []string, password string) error {
+	if password == "" {
+		data, err := ioutil.ReadFile(environ.Getenv(ctx, "GOOGLE_APPLICATION_CREDENTIALS"))
+		if err != nil {
+			return fmt.Errorf("docker: reading the service account key of $GOOGLE_APPLICATION_CREDENTIALS: %s", err.Error())
+		}
+		password = string(data)
+	}
+	registries := 0
+	for _, host := range hosts {
+		if !isGCRHost(host) {
+			continue
+		}
+		registries++
+		if err := login(ctx, "_json_key", password, host); err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("docker: logged in to %s", host))
+	}
+	if registries == 0 {
+		return fmt.Errorf("docker: none of the images is in a GCR or Artifact Registry registry")
+	}
+	return nil
+}
+
+// checkCredentials warns about the registries of hosts without credentials, nor credential helper, in the
+// docker config file, as pushing to them will likely fail
+func checkCredentials(ctx context.Context, hosts []string) {
+	dir := environ.Getenv(ctx, "DOCKER_CONFIG")
+	if dir == "" {
+		dir = filepath.Join(environ.Getenv(ctx, "HOME"), ".docker")
+	}
+	path := filepath.Join(dir, "config.json")
+
+	var conf dockerConfig
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &conf)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Warn(fmt.Sprintf("docker: reading %s: %s", path, err.Error()))
+		return
+	}
+
+	for _, host := range hosts {
+		key := host
+		if host == "docker.io" {
+			key = dockerHubAuthKey
+		}
+		switch {
+		case conf.CredHelpers[host] != "":
+			log.With("registry", host).Debug(fmt.Sprintf("docker: using the credential helper %s", conf.CredHelpers[host]))
+		case conf.Auths[key] != nil && conf.CredsStore != "":
+			log.With("registry", host).Debug(fmt.Sprintf("docker: using the credentials store %s", conf.CredsStore))
+		case conf.Auths[key] != nil:
+			log.With("registry", host).Debug(fmt.Sprintf("docker: using the credentials of %s", path))
+		default:
+			log.Warn(fmt.Sprintf("docker: no credentials for %s in %s, run docker login before rocket or set docker.login", host, path))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Package environ holds the env of a provider in its context, layered on top of the process environment,
+// so the providers with their own env don't modify the environment of rocket and can run concurrently
+package environ
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bloom42/rocket/config"
+)
+
+type contextKey struct{}
+
+// With returns a copy of ctx with env layered on top of the environment of ctx. Values are expanded,
+// so they can reference the environment and the other variables of env
+func With(ctx context.Context, env map[string]string) (context.Context, error) {
+	if len(env) == 0 {
+		return ctx, nil
+	}
+
+	// the variables are expanded after the ones they reference
+	keys, err := config.SortEnv(env)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for key, value := range env {
+		values[strings.ToUpper(key)] = value
+	}
+
+	vars := map[string]string{}
+	for key, value := range variables(ctx) {
+		vars[key] = value
+	}
+	ret := context.WithValue(ctx, contextKey{}, vars)
+	for _, key := range keys {
+		vars[key] = ExpandEnv(ret, values[key])
+	}
+	return ret, nil
+}
+
+// Getenv is os.Getenv with the variables of ctx
+func Getenv(ctx context.Context, key string) string {
+	if value, ok := variables(ctx)[key]; ok {
+		return value
+	}
+	return os.Getenv(key)
+}
+
+// Getter returns Getenv with the variables of ctx, e.g. for config.AWSRegion
+func Getter(ctx context.Context) func(string) string {
+	return func(key string) string {
+		return Getenv(ctx, key)
+	}
+}
+
+// ExpandEnv is config.ExpandEnv with the variables of ctx
+func ExpandEnv(ctx context.Context, s string) string {
+	return config.Expand(s, Getter(ctx))
+}
+
+// Environ is os.Environ with the variables of ctx, to be used as the Env of the commands executed
+// by a provider
+func Environ(ctx context.Context) []string {
+	vars := variables(ctx)
+	ret := []string{}
+	for _, kv := range os.Environ() {
+		if _, ok := vars[strings.SplitN(kv, "=", 2)[0]]; !ok {
+			ret = append(ret, kv)
+		}
+	}
+
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		ret = append(ret, key+"="+vars[key])
+	}
+	return ret
+}
+
+// variables returns the variables of ctx, which should not be modified
+func variables(ctx context.Context) map[string]string {
+	vars, _ := ctx.Value(contextKey{}).(map[string]string)
+	return vars
+}
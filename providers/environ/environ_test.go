@@ -0,0 +1,97 @@
+package environ
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWith(t *testing.T) {
+	os.Setenv("ROCKET_TEST_DOMAIN", "example.com")
+	os.Setenv("ROCKET_TEST_REGION", "us-east-1")
+	defer os.Unsetenv("ROCKET_TEST_DOMAIN")
+	defer os.Unsetenv("ROCKET_TEST_REGION")
+
+	ctx, err := With(context.Background(), map[string]string{
+		"rocket_test_url":    "https://$ROCKET_TEST_DOMAIN/$ROCKET_TEST_PATH",
+		"ROCKET_TEST_PATH":   "deploy",
+		"ROCKET_TEST_REGION": "eu-west-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"ROCKET_TEST_URL":    "https://example.com/deploy",
+		"ROCKET_TEST_PATH":   "deploy",
+		"ROCKET_TEST_REGION": "eu-west-1",
+		"ROCKET_TEST_DOMAIN": "example.com",
+	}
+	for key, value := range expected {
+		if v := Getenv(ctx, key); v != value {
+			t.Errorf("Getenv(%s) = %q, expected %q", key, v, value)
+		}
+	}
+	if v := ExpandEnv(ctx, "${ROCKET_TEST_REGION}-$ROCKET_TEST_PATH"); v != "eu-west-1-deploy" {
+		t.Errorf("ExpandEnv() = %q, expected %q", v, "eu-west-1-deploy")
+	}
+
+	// the process environment is not modified
+	if v := os.Getenv("ROCKET_TEST_REGION"); v != "us-east-1" {
+		t.Errorf("os.Getenv(ROCKET_TEST_REGION) = %q, expected %q", v, "us-east-1")
+	}
+	if _, ok := os.LookupEnv("ROCKET_TEST_URL"); ok {
+		t.Error("ROCKET_TEST_URL is set in the process environment")
+	}
+}
+
+func TestWithLayers(t *testing.T) {
+	base, err := With(context.Background(), map[string]string{"ROCKET_TEST_A": "base", "ROCKET_TEST_B": "base"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := With(base, map[string]string{"ROCKET_TEST_B": "$ROCKET_TEST_B-override"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := Getenv(ctx, "ROCKET_TEST_A"); v != "base" {
+		t.Errorf("Getenv(ROCKET_TEST_A) = %q, expected %q", v, "base")
+	}
+	if v := Getenv(ctx, "ROCKET_TEST_B"); v != "base-override" {
+		t.Errorf("Getenv(ROCKET_TEST_B) = %q, expected %q", v, "base-override")
+	}
+	if v := Getenv(base, "ROCKET_TEST_B"); v != "base" {
+		t.Errorf("Getenv(ROCKET_TEST_B) of the base context = %q, expected %q", v, "base")
+	}
+}
+
+func TestWithCircularReference(t *testing.T) {
+	_, err := With(context.Background(), map[string]string{"A": "$B", "B": "$A"})
+	if err == nil {
+		t.Error("expected an error for a circular reference")
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	os.Setenv("ROCKET_TEST_REGION", "us-east-1")
+	defer os.Unsetenv("ROCKET_TEST_REGION")
+
+	ctx, err := With(context.Background(), map[string]string{"ROCKET_TEST_REGION": "eu-west-1", "ROCKET_TEST_BUCKET": "my-bucket"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, kv := range Environ(ctx) {
+		if strings.HasPrefix(kv, "ROCKET_TEST_") {
+			got = append(got, kv)
+		}
+	}
+	expected := []string{"ROCKET_TEST_BUCKET=my-bucket", "ROCKET_TEST_REGION=eu-west-1"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Environ() = %v, expected %v", got, expected)
+	}
+}
@@ -0,0 +1,141 @@
+package execplugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/command"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/registry"
+)
+
+// ProtocolVersion is the version of the stdin/stdout contract between rocket and the plugins
+const ProtocolVersion = 1
+
+// Input is the JSON document written to the stdin of the plugin
+type Input struct {
+	Version int `json:"version"`
+	// Config is the config of the plugin, expanded
+	Config map[string]string `json:"config"`
+}
+
+// Output is the JSON document the plugin should write to its stdout before exiting
+type Output struct {
+	// Status is success or failure
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func init() {
+	registry.Register("exec_plugin", func(conf config.Config) registry.Provider {
+		if conf.ExecPlugin == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.ExecPlugin.Env, When: conf.ExecPlugin.When, Timeout: conf.ExecPlugin.Timeout}
+		return registry.New("exec_plugin", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.ExecPlugin, conf.DryRun)
+		})
+	})
+}
+
+// Deploy runs the plugin binary with its config as JSON on its stdin, then reads the status of the
+// deployment from its stdout. The logs of the plugin should be written to its stderr
+func Deploy(conf config.ExecPluginConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.ExecPluginConfig, dryRun bool) error {
+	if conf.Command == nil {
+		v := ""
+		conf.Command = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Command)
+		conf.Command = &v
+	}
+
+	args := make([]string, len(conf.Args))
+	for i, arg := range conf.Args {
+		args[i] = environ.ExpandEnv(ctx, arg)
+	}
+
+	if conf.Directory == nil {
+		v := "."
+		conf.Directory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Directory)
+		conf.Directory = &v
+	}
+
+	input := Input{Version: ProtocolVersion, Config: map[string]string{}}
+	for key, value := range conf.Config {
+		input.Config[key] = environ.ExpandEnv(ctx, value)
+	}
+
+	commandLine := strings.TrimSpace(*conf.Command + " " + strings.Join(args, " "))
+	if dryRun {
+		log.Info(fmt.Sprintf("exec_plugin: would execute %s in %s", commandLine, *conf.Directory))
+		return nil
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	log.With("directory", *conf.Directory, "command", commandLine).Debug("exec_plugin: executing plugin")
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, *conf.Command, args...)
+	cmd.Env = environ.Environ(ctx)
+	cmd.Dir = *conf.Directory
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	err = cmd.Run()
+	output, outputErr := parseOutput(stdout.Bytes())
+	if err != nil {
+		exitCode, ok := command.ExitCode(err)
+		if !ok {
+			return fmt.Errorf("exec_plugin: %s", err.Error())
+		}
+		message := strings.TrimSpace(stderr.String())
+		if outputErr == nil && output.Message != "" {
+			message = output.Message
+		}
+		return fmt.Errorf("exec_plugin: %s failed with exit code %d: %s", *conf.Command, exitCode, message)
+	}
+	if outputErr != nil {
+		return fmt.Errorf("exec_plugin: %s: invalid output: %s", *conf.Command, outputErr.Error())
+	}
+	if output.Status != "success" {
+		return fmt.Errorf("exec_plugin: %s failed: %s", *conf.Command, output.Message)
+	}
+
+	if output.Message != "" {
+		log.Info(fmt.Sprintf("exec_plugin: %s", output.Message))
+	}
+	log.Info(fmt.Sprintf("exec_plugin: %s successfully executed", *conf.Command))
+	return nil
+}
+
+// parseOutput decodes the output of the plugin, whose status should be success or failure
+func parseOutput(data []byte) (Output, error) {
+	var output Output
+	if err := json.Unmarshal(bytes.TrimSpace(data), &output); err != nil {
+		return output, err
+	}
+	if output.Status != "success" && output.Status != "failure" {
+		return output, fmt.Errorf("unknown status '%s'", output.Status)
+	}
+	return output, nil
+}
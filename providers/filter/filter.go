@@ -0,0 +1,58 @@
+package filter
+
+import (
+	"path/filepath"
+
+	"github.com/bloom42/rocket/config"
+)
+
+// Match returns true if the file, found by walking dir, should be deployed: if it matches one of the
+// include glob patterns (or if there is none) and none of the exclude ones.
+// The patterns are matched against the path of the file relative to dir and against its base name,
+// so "*.map" matches the source maps of all the sub-directories
+func Match(include, exclude []string, dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		rel = path
+	}
+
+	for _, pattern := range exclude {
+		if matchPattern(pattern, rel) {
+			return false
+		}
+	}
+
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if matchPattern(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchRule returns the first rule whose pattern matches the file, found by walking dir, like the
+// include patterns of Match. ok is false if none matches
+func MatchRule(rules []config.FileRule, dir, path string) (rule config.FileRule, ok bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		rel = path
+	}
+
+	for _, rule := range rules {
+		if matchPattern(config.ExpandEnv(rule.Match), rel) {
+			return rule, true
+		}
+	}
+	return config.FileRule{}, false
+}
+
+func matchPattern(pattern, rel string) bool {
+	if ok, _ := filepath.Match(pattern, rel); ok {
+		return true
+	}
+	ok, _ := filepath.Match(pattern, filepath.Base(rel))
+	return ok
+}
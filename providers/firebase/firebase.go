@@ -0,0 +1,129 @@
+package firebase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/command"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/registry"
+)
+
+var urlRegexp = regexp.MustCompile(`https://[^\s\]]+`)
+
+func init() {
+	registry.Register("firebase", func(conf config.Config) registry.Provider {
+		if conf.Firebase == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.Firebase.Env, When: conf.Firebase.When, Timeout: conf.Firebase.Timeout}
+		return registry.New("firebase", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.Firebase, conf.DryRun)
+		})
+	})
+}
+
+// Deploy perform the Firebase Hosting deployment with the firebase CLI, to the live channel or
+// to a preview channel if conf.Channel is set.
+// The directory should contain the firebase.json file of the project
+func Deploy(conf config.FirebaseConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.FirebaseConfig, dryRun bool) error {
+	if conf.Token == nil {
+		v := environ.Getenv(ctx, "FIREBASE_TOKEN")
+		conf.Token = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Token)
+		conf.Token = &v
+	}
+
+	if conf.ProjectID == nil {
+		v := environ.Getenv(ctx, "FIREBASE_PROJECT_ID")
+		conf.ProjectID = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.ProjectID)
+		conf.ProjectID = &v
+	}
+
+	if conf.Directory == nil {
+		v := "."
+		conf.Directory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Directory)
+		conf.Directory = &v
+	}
+
+	if conf.Channel == nil {
+		v := ""
+		conf.Channel = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Channel)
+		conf.Channel = &v
+	}
+
+	var args []string
+	if *conf.Channel != "" {
+		args = []string{"hosting:channel:deploy", *conf.Channel}
+	} else {
+		args = []string{"deploy", "--only", "hosting"}
+	}
+	args = append(args, "--project", *conf.ProjectID, "--non-interactive")
+
+	if dryRun {
+		if *conf.Channel != "" {
+			log.Info(fmt.Sprintf("firebase: would deploy %s to the preview channel %s of project %s", *conf.Directory, *conf.Channel, *conf.ProjectID))
+		} else {
+			log.Info(fmt.Sprintf("firebase: would deploy %s to project %s", *conf.Directory, *conf.ProjectID))
+		}
+		return nil
+	}
+
+	log.With("directory", *conf.Directory, "args", args).Debug("firebase: deploying")
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "firebase", args...)
+	cmd.Dir = *conf.Directory
+	// the token is passed in the environment of the CLI, not on its command line where other users could read it
+	cmd.Env = append(environ.Environ(ctx), "FIREBASE_TOKEN="+*conf.Token)
+	cmd.Stdout = io.MultiWriter(os.Stdout, &stdout)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	err := cmd.Run()
+	if err != nil {
+		exitCode, _ := command.ExitCode(err)
+		return fmt.Errorf("firebase: %s failed with exit code %d: %s", args[0], exitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	hostingURL := hostingURL(stdout.String())
+	if hostingURL == "" {
+		log.Info(fmt.Sprintf("firebase: %s successfully deployed to project %s", *conf.Directory, *conf.ProjectID))
+	} else if *conf.Channel != "" {
+		log.Info(fmt.Sprintf("firebase: preview channel %s available at %s", *conf.Channel, hostingURL))
+	} else {
+		log.Info(fmt.Sprintf("firebase: deployment available at %s", hostingURL))
+	}
+	return nil
+}
+
+// hostingURL returns the URL of the deployment from the output of the CLI:
+// "Hosting URL: https://..." for deploy and "Channel URL (site): https://... [expires ...]"
+// for hosting:channel:deploy
+func hostingURL(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, "Hosting URL") || strings.Contains(line, "Channel URL") {
+			return urlRegexp.FindString(line)
+		}
+	}
+	return ""
+}
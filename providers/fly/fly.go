@@ -0,0 +1,120 @@
+package fly
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/command"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/registry"
+)
+
+func init() {
+	registry.Register("fly", func(conf config.Config) registry.Provider {
+		if conf.Fly == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.Fly.Env, When: conf.Fly.When, Timeout: conf.Fly.Timeout}
+		return registry.New("fly", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.Fly, conf.DryRun)
+		})
+	})
+}
+
+// Deploy perform the Fly.io deployment of the app with flyctl deploy, the output of flyctl
+// being logged as the deployment progresses
+func Deploy(conf config.FlyConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.FlyConfig, dryRun bool) error {
+	if conf.Token == nil {
+		v := environ.Getenv(ctx, "FLY_API_TOKEN")
+		conf.Token = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Token)
+		conf.Token = &v
+	}
+
+	if conf.App == nil {
+		v := environ.Getenv(ctx, "FLY_APP")
+		conf.App = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.App)
+		conf.App = &v
+	}
+
+	if conf.ConfigPath == nil {
+		v := "fly.toml"
+		conf.ConfigPath = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.ConfigPath)
+		conf.ConfigPath = &v
+	}
+
+	if conf.Directory == nil {
+		v := "."
+		conf.Directory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Directory)
+		conf.Directory = &v
+	}
+
+	if conf.Strategy == nil {
+		v := ""
+		conf.Strategy = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Strategy)
+		conf.Strategy = &v
+	}
+
+	args := []string{"deploy", "--app", *conf.App, "--config", *conf.ConfigPath, "--remote-only"}
+	if *conf.Strategy != "" {
+		args = append(args, "--strategy", *conf.Strategy)
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("fly: would execute flyctl %s in %s", strings.Join(args, " "), *conf.Directory))
+		return nil
+	}
+
+	log.With("directory", *conf.Directory, "args", args).Debug("fly: deploying")
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "flyctl", args...)
+	cmd.Dir = *conf.Directory
+	cmd.Env = append(environ.Environ(ctx), "FLY_API_TOKEN="+*conf.Token)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			log.Info(fmt.Sprintf("fly: %s", line))
+		}
+	}
+
+	err = cmd.Wait()
+	if err != nil {
+		exitCode, _ := command.ExitCode(err)
+		return fmt.Errorf("fly: deploy failed with exit code %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	log.Info(fmt.Sprintf("fly: app %s successfully deployed", *conf.App))
+	return nil
+}
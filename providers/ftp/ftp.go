@@ -0,0 +1,391 @@
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloom42/astroflow-go/log"
+	"github.com/z0mbie42/fswalk"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/filter"
+	"github.com/bloom42/rocket/providers/registry"
+)
+
+const timeout = 30 * time.Second
+
+// Client is a minimal FTP client, supporting explicit FTPS (AUTH TLS) and passive mode.
+// DirMode, if set, is applied to the directories created by MakeDirAll
+type Client struct {
+	Host      string
+	TLSConfig *tls.Config
+	DirMode   *os.FileMode
+	conn      net.Conn
+	text      *textproto.Conn
+	dirs      map[string]bool
+}
+
+func init() {
+	registry.Register("ftp", func(conf config.Config) registry.Provider {
+		if conf.FTP == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.FTP.Env, When: conf.FTP.When, Timeout: conf.FTP.Timeout}
+		return registry.New("ftp", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.FTP, conf.DryRun)
+		})
+	})
+}
+
+// Deploy perform the FTP upload of the local directory to the remote directory
+func Deploy(conf config.FTPConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.FTPConfig, dryRun bool) error {
+	if conf.Host == nil {
+		v := environ.Getenv(ctx, "FTP_HOST")
+		conf.Host = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Host)
+		conf.Host = &v
+	}
+
+	if conf.Port == nil {
+		v := 21
+		conf.Port = &v
+	}
+
+	if conf.Username == nil {
+		v := environ.Getenv(ctx, "FTP_USERNAME")
+		conf.Username = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Username)
+		conf.Username = &v
+	}
+
+	if conf.Password == nil {
+		v := environ.Getenv(ctx, "FTP_PASSWORD")
+		conf.Password = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Password)
+		conf.Password = &v
+	}
+
+	if conf.LocalDirectory == nil {
+		v := "."
+		conf.LocalDirectory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.LocalDirectory)
+		conf.LocalDirectory = &v
+	}
+
+	if conf.RemoteDirectory == nil {
+		v := "/"
+		conf.RemoteDirectory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.RemoteDirectory)
+		conf.RemoteDirectory = &v
+	}
+
+	if conf.TLS == nil {
+		v := false
+		conf.TLS = &v
+	}
+
+	if *conf.Username == "" {
+		v := "anonymous"
+		conf.Username = &v
+	}
+
+	fileMode, err := parseMode(ctx, conf.FileMode)
+	if err != nil {
+		return fmt.Errorf("ftp: file_mode: %s", err.Error())
+	}
+	dirMode, err := parseMode(ctx, conf.DirMode)
+	if err != nil {
+		return fmt.Errorf("ftp: dir_mode: %s", err.Error())
+	}
+
+	address := net.JoinHostPort(*conf.Host, strconv.Itoa(*conf.Port))
+
+	files := []string{}
+	walker, _ := fswalk.NewWalker()
+	filesc, _ := walker.Walk(*conf.LocalDirectory)
+	for file := range filesc {
+		if file.Path == "." || file.IsDir || file.IsSymLink {
+			continue
+		}
+		if !filter.Match(conf.Include, conf.Exclude, *conf.LocalDirectory, file.Path) {
+			log.With("file", file.Path).Debug("ftp: file excluded")
+			continue
+		}
+		files = append(files, file.Path)
+	}
+
+	if dryRun {
+		for _, file := range files {
+			log.Info(fmt.Sprintf("ftp: would upload %s to ftp://%s%s", file, address, remotePath(conf, file)))
+		}
+		return nil
+	}
+
+	log.With("address", address, "tls", *conf.TLS).Debug("ftp: connecting")
+	client, err := Dial(address, *conf.TLS)
+	if err != nil {
+		return err
+	}
+	defer client.Quit()
+	client.DirMode = dirMode
+
+	// closing the control connection interrupts the current command
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.conn.Close()
+		case <-done:
+		}
+	}()
+
+	err = client.Login(*conf.Username, *conf.Password)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		remote := remotePath(conf, file)
+		log.With("file", file, "remote", remote).Debug("ftp: uploading file")
+		err = client.MakeDirAll(path.Dir(remote))
+		if err != nil {
+			return err
+		}
+		err = client.UploadFile(file, remote)
+		if err != nil {
+			return err
+		}
+		if fileMode != nil {
+			if err = client.Chmod(remote, *fileMode); err != nil {
+				return err
+			}
+		}
+		log.Info(fmt.Sprintf("ftp: file successfully uploaded %s", file))
+	}
+
+	return nil
+}
+
+// remotePath returns the remote path of the given local file: its path relative to the
+// local directory, prefixed by the remote directory
+func remotePath(conf config.FTPConfig, filePath string) string {
+	rel, err := filepath.Rel(*conf.LocalDirectory, filePath)
+	if err != nil {
+		rel = filepath.Base(filePath)
+	}
+	return path.Join("/", *conf.RemoteDirectory, filepath.ToSlash(rel))
+}
+
+// parseMode parses the octal file mode, if set
+func parseMode(ctx context.Context, value *string) (*os.FileMode, error) {
+	if value == nil {
+		return nil, nil
+	}
+	mode, err := config.ParseFileMode(environ.ExpandEnv(ctx, *value))
+	if err != nil {
+		return nil, err
+	}
+	return &mode, nil
+}
+
+// Dial connects to the FTP server at address and, if useTLS is true, upgrades the control
+// connection with AUTH TLS
+func Dial(address string, useTLS bool) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	host, _, _ := net.SplitHostPort(address)
+	client := &Client{Host: host, conn: conn, text: textproto.NewConn(conn), dirs: map[string]bool{}}
+
+	if _, _, err = client.text.ReadResponse(220); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ftp: connecting: %s", err.Error())
+	}
+
+	if useTLS {
+		if _, err = client.cmd(234, "AUTH TLS"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		client.TLSConfig = &tls.Config{ServerName: host, ClientSessionCache: tls.NewLRUClientSessionCache(0)}
+		client.conn = tls.Client(conn, client.TLSConfig)
+		client.text = textproto.NewConn(client.conn)
+	}
+
+	return client, nil
+}
+
+// cmd sends a command and reads the response, which should have the expected code
+func (c *Client) cmd(expectCode int, format string, args ...interface{}) (string, error) {
+	if _, err := c.text.Cmd(format, args...); err != nil {
+		return "", err
+	}
+	_, message, err := c.text.ReadResponse(expectCode)
+	if err != nil {
+		command := strings.Fields(format)[0]
+		return message, fmt.Errorf("ftp: %s: %s", command, err.Error())
+	}
+	return message, nil
+}
+
+// Login authenticates the client and set the transfer type to binary
+func (c *Client) Login(username, password string) error {
+	if _, err := c.text.Cmd("USER %s", username); err != nil {
+		return err
+	}
+	code, message, err := c.text.ReadResponse(0)
+	if err != nil {
+		return err
+	}
+	switch code {
+	case 230:
+	case 331:
+		if _, err = c.cmd(230, "PASS %s", password); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("ftp: USER: %d %s", code, message)
+	}
+
+	if c.TLSConfig != nil {
+		if _, err = c.cmd(200, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, err = c.cmd(200, "PROT P"); err != nil {
+			return err
+		}
+	}
+
+	_, err = c.cmd(200, "TYPE I")
+	return err
+}
+
+// MakeDirAll creates the remote directory dir and its parents, ignoring the ones which already exist
+func (c *Client) MakeDirAll(dir string) error {
+	if dir == "/" || dir == "." || c.dirs[dir] {
+		return nil
+	}
+	if err := c.MakeDirAll(path.Dir(dir)); err != nil {
+		return err
+	}
+
+	if _, err := c.text.Cmd("MKD %s", dir); err != nil {
+		return err
+	}
+	code, message, err := c.text.ReadResponse(0)
+	// 550 is returned when the directory already exists
+	if err != nil || (code != 257 && code != 550) {
+		return fmt.Errorf("ftp: MKD %s: %d %s", dir, code, message)
+	}
+	if code == 257 && c.DirMode != nil {
+		if err = c.Chmod(dir, *c.DirMode); err != nil {
+			return err
+		}
+	}
+	c.dirs[dir] = true
+	return nil
+}
+
+// Chmod set the permissions of the remote path with SITE CHMOD, which is not part of the FTP
+// standard but supported by most servers
+func (c *Client) Chmod(remote string, mode os.FileMode) error {
+	_, err := c.cmd(200, "SITE CHMOD %o %s", mode.Perm(), remote)
+	return err
+}
+
+// pasv opens a passive mode data connection
+func (c *Client) pasv() (net.Conn, error) {
+	message, err := c.cmd(227, "PASV")
+	if err != nil {
+		return nil, err
+	}
+
+	// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+	start, end := strings.Index(message, "("), strings.Index(message, ")")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("ftp: PASV: invalid response %s", message)
+	}
+	parts := strings.Split(message[start+1:end], ",")
+	if len(parts) != 6 {
+		return nil, fmt.Errorf("ftp: PASV: invalid response %s", message)
+	}
+	p1, err1 := strconv.Atoi(parts[4])
+	p2, err2 := strconv.Atoi(parts[5])
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("ftp: PASV: invalid response %s", message)
+	}
+
+	// the host of the response is ignored as it is often wrong behind a NAT
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.Host, strconv.Itoa(p1*256+p2)), timeout)
+	if err != nil {
+		return nil, err
+	}
+	if c.TLSConfig != nil {
+		return tls.Client(conn, c.TLSConfig), nil
+	}
+	return conn, nil
+}
+
+// UploadFile uploads the local file to the remote path
+func (c *Client) UploadFile(filePath, remote string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, err := c.pasv()
+	if err != nil {
+		return err
+	}
+
+	if _, err = c.cmd(1, "STOR %s", remote); err != nil {
+		data.Close()
+		return err
+	}
+
+	_, err = io.Copy(data, file)
+	data.Close()
+	if err != nil {
+		return err
+	}
+
+	_, _, err = c.text.ReadResponse(2)
+	if err != nil {
+		return fmt.Errorf("ftp: STOR %s: %s", remote, err.Error())
+	}
+	return nil
+}
+
+// Quit closes the connection
+func (c *Client) Quit() error {
+	c.cmd(221, "QUIT")
+	return c.text.Close()
+}
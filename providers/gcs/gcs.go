@@ -0,0 +1,311 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+	"github.com/z0mbie42/fswalk"
+	"golang.org/x/oauth2/jwt"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/filter"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/providers/upload"
+	"github.com/bloom42/rocket/version"
+)
+
+const storageScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// Credentials is the content of a Google service account JSON key file
+type Credentials struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// Client is an wrapper to perform various task against the Google Cloud Storage JSON API
+type Client struct {
+	HTTP      *http.Client
+	UserAgent string
+	Config    config.GCSConfig
+}
+
+func init() {
+	registry.Register("gcs", func(conf config.Config) registry.Provider {
+		if conf.GCS == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.GCS.Env, When: conf.GCS.When, Timeout: conf.GCS.Timeout}
+		return registry.New("gcs", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.GCS, conf.DryRun)
+		})
+	})
+}
+
+// Deploy perform the GCS upload
+func Deploy(conf config.GCSConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.GCSConfig, dryRun bool) error {
+	var err error
+
+	if conf.Bucket == nil {
+		v := environ.Getenv(ctx, "GCS_BUCKET")
+		conf.Bucket = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Bucket)
+		conf.Bucket = &v
+	}
+
+	if conf.CredentialsJSON == nil {
+		v := ""
+		credentialsFile := environ.Getenv(ctx, "GOOGLE_APPLICATION_CREDENTIALS")
+		if credentialsFile != "" {
+			data, err := ioutil.ReadFile(credentialsFile)
+			if err != nil {
+				return err
+			}
+			v = string(data)
+		}
+		conf.CredentialsJSON = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.CredentialsJSON)
+		conf.CredentialsJSON = &v
+	}
+
+	if conf.LocalDirectory == nil {
+		v := "."
+		conf.LocalDirectory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.LocalDirectory)
+		conf.LocalDirectory = &v
+	}
+
+	if conf.RemoteDirectory == nil {
+		v := ""
+		conf.RemoteDirectory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.RemoteDirectory)
+		conf.RemoteDirectory = &v
+	}
+
+	// the rules are copied so the ones of the configuration are not modified
+	rules := make([]config.FileRule, len(conf.Rules))
+	for i, rule := range conf.Rules {
+		rule.CacheControl = environ.ExpandEnv(ctx, rule.CacheControl)
+		rule.ContentType = environ.ExpandEnv(ctx, rule.ContentType)
+		rules[i] = rule
+	}
+	conf.Rules = rules
+
+	// a missing local directory would otherwise upload no file and succeed
+	info, err := os.Stat(*conf.LocalDirectory)
+	if err != nil {
+		return fmt.Errorf("gcs: %s", err.Error())
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("gcs: local_directory %s is not a directory", *conf.LocalDirectory)
+	}
+
+	var credentials Credentials
+	err = json.Unmarshal([]byte(*conf.CredentialsJSON), &credentials)
+	if err != nil {
+		return fmt.Errorf("gcs: parsing credentials: %s", err.Error())
+	}
+
+	if conf.ProjectID == nil {
+		v := credentials.ProjectID
+		conf.ProjectID = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.ProjectID)
+		conf.ProjectID = &v
+	}
+
+	client, err := NewClient(conf, credentials)
+	if err != nil {
+		return err
+	}
+	client.HTTP = httpclient.WithContext(ctx, client.HTTP)
+
+	log.With("project", *conf.ProjectID, "bucket", *conf.Bucket).Debug("gcs: uploading files")
+	walker, err := fswalk.NewWalker()
+	if err != nil {
+		return err
+	}
+	filesc, err := walker.Walk(*conf.LocalDirectory)
+	if err != nil {
+		return err
+	}
+	files := []string{}
+	for file := range filesc {
+		if file.Path == "." || file.IsDir || file.IsSymLink {
+			continue
+		}
+		if !filter.Match(conf.Include, conf.Exclude, *conf.LocalDirectory, file.Path) {
+			log.With("file", file.Path).Debug("gcs: file excluded")
+			continue
+		}
+		files = append(files, file.Path)
+	}
+
+	if !dryRun {
+		log.Info(fmt.Sprintf("gcs: uploading %d files to gs://%s", len(files), *conf.Bucket))
+	}
+	failed := map[string]error{}
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.With("file", file).Debug("gcs: file to upload")
+		if dryRun {
+			log.Info(fmt.Sprintf("gcs: would upload %s to gs://%s/%s", file, *conf.Bucket, client.objectName(file)))
+			continue
+		}
+		err = client.UploadFile(file)
+		if err != nil {
+			failed[file] = err
+			log.With("file", file).Error(fmt.Sprintf("gcs: error uploading a file: %s", err.Error()))
+		} else {
+			log.Info(fmt.Sprintf("gcs: file successfully uploaded %s", file))
+		}
+	}
+	if len(failed) != 0 {
+		return upload.Error("gcs", failed)
+	}
+	return nil
+}
+
+// NewClient create a Client authenticated with the given service account credentials
+func NewClient(conf config.GCSConfig, credentials Credentials) (Client, error) {
+	if credentials.ClientEmail == "" || credentials.PrivateKey == "" {
+		return Client{}, errors.New("gcs: credentials should contain a client_email and a private_key")
+	}
+
+	tokenURL := credentials.TokenURI
+	if tokenURL == "" {
+		tokenURL = "https://oauth2.googleapis.com/token"
+	}
+
+	jwtConf := &jwt.Config{
+		Email:        credentials.ClientEmail,
+		PrivateKey:   []byte(credentials.PrivateKey),
+		PrivateKeyID: credentials.PrivateKeyID,
+		Scopes:       []string{storageScope},
+		TokenURL:     tokenURL,
+	}
+
+	return Client{jwtConf.Client(context.Background()), fmt.Sprintf("rocket/%s", version.Version), conf}, nil
+}
+
+// objectName returns the name of the object for the given local file: its path relative to
+// the local directory, prefixed by the remote directory
+func (c *Client) objectName(filePath string) string {
+	rel, err := filepath.Rel(*c.Config.LocalDirectory, filePath)
+	if err != nil {
+		rel = filepath.Base(filePath)
+	}
+	name := path.Join(*c.Config.RemoteDirectory, filepath.ToSlash(rel))
+	return strings.TrimPrefix(name, "/")
+}
+
+// UploadFile upload the given file to the bucket with a simple media upload
+func (c *Client) UploadFile(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rule, _ := filter.MatchRule(c.Config.Rules, *c.Config.LocalDirectory, filePath)
+	contentType := rule.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filePath))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	uploadURL := fmt.Sprintf(
+		"https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		url.PathEscape(*c.Config.Bucket),
+		url.QueryEscape(c.objectName(filePath)),
+	)
+	req, err := http.NewRequest("POST", uploadURL, file)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	// a media upload can't set the other metadata of the object
+	if rule.CacheControl != "" {
+		return c.setCacheControl(c.objectName(filePath), rule.CacheControl)
+	}
+	return nil
+}
+
+// setCacheControl sets the Cache-Control metadata of the object
+func (c *Client) setCacheControl(name, cacheControl string) error {
+	data, err := json.Marshal(map[string]string{"cacheControl": cacheControl})
+	if err != nil {
+		return err
+	}
+
+	objectURL := fmt.Sprintf(
+		"https://storage.googleapis.com/storage/v1/b/%s/o/%s",
+		url.PathEscape(*c.Config.Bucket),
+		url.PathEscape(name),
+	)
+	req, err := http.NewRequest("PATCH", objectURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return nil
+}
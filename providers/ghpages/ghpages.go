@@ -0,0 +1,264 @@
+package ghpages
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/command"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/providers/tempfile"
+)
+
+func init() {
+	registry.Register("github_pages", func(conf config.Config) registry.Provider {
+		if conf.GitHubPages == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.GitHubPages.Env, When: conf.GitHubPages.When, Timeout: conf.GitHubPages.Timeout}
+		return registry.New("github_pages", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.GitHubPages, conf.DryRun)
+		})
+	})
+}
+
+// Deploy push the content of the directory to the GitHub Pages branch of the repository, following the below steps:
+// clone the branch, or init a new repository if clean is true or the branch does not exist
+// replace its content by the content of the directory
+// commit and push it, with --force if clean is true
+func Deploy(conf config.GitHubPagesConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.GitHubPagesConfig, dryRun bool) error {
+	var err error
+
+	if conf.Repo == nil {
+		v := environ.Getenv(ctx, "ROCKET_GIT_REPO")
+		conf.Repo = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Repo)
+		conf.Repo = &v
+	}
+
+	if conf.APIKey == nil {
+		v := environ.Getenv(ctx, "GITHUB_API_KEY")
+		conf.APIKey = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.APIKey)
+		conf.APIKey = &v
+	}
+
+	if conf.Branch == nil {
+		v := "gh-pages"
+		conf.Branch = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Branch)
+		conf.Branch = &v
+	}
+
+	if conf.Directory == nil {
+		v := "."
+		conf.Directory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Directory)
+		conf.Directory = &v
+	}
+
+	if conf.CommitMessage == nil {
+		v := fmt.Sprintf("Deploy %s", environ.Getenv(ctx, "ROCKET_COMMIT_SHORT"))
+		conf.CommitMessage = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.CommitMessage)
+		conf.CommitMessage = &v
+	}
+
+	if conf.Clean == nil {
+		v := false
+		conf.Clean = &v
+	}
+
+	if dryRun {
+		if *conf.Clean {
+			log.Info(fmt.Sprintf("github_pages: would force push %s to the branch %s of %s", *conf.Directory, *conf.Branch, *conf.Repo))
+		} else {
+			log.Info(fmt.Sprintf("github_pages: would commit %s to the branch %s of %s", *conf.Directory, *conf.Branch, *conf.Repo))
+		}
+		return nil
+	}
+
+	// the token is sent in a header rather than in the URL, so it is not written to .git/config or displayed
+	// in the errors of git
+	auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + *conf.APIKey))
+	g := git{
+		args: []string{"-c", fmt.Sprintf("http.https://github.com/.extraheader=AUTHORIZATION: basic %s", auth)},
+		ctx:  ctx,
+	}
+	remote := fmt.Sprintf("https://github.com/%s.git", *conf.Repo)
+
+	// the commits are made by rocket if the git identity is not configured, as on most CI
+	if _, err = g.run("", "config", "user.email"); err != nil {
+		g.args = append(g.args, "-c", "user.name=rocket", "-c", "user.email=rocket@users.noreply.github.com")
+	}
+
+	dir, err := tempfile.Dir("", "rocket_github_pages")
+	if err != nil {
+		return err
+	}
+	defer tempfile.Remove(dir)
+
+	exists := false
+	if !*conf.Clean {
+		heads, err := g.run("", "ls-remote", "--heads", remote, *conf.Branch)
+		if err != nil {
+			return err
+		}
+		exists = strings.TrimSpace(heads) != ""
+	}
+
+	if exists {
+		if _, err = g.run(dir, "clone", "--quiet", "--depth", "1", "--branch", *conf.Branch, "--single-branch", remote, "."); err != nil {
+			return err
+		}
+	} else {
+		if _, err = g.run(dir, "init", "--quiet"); err != nil {
+			return err
+		}
+		if _, err = g.run(dir, "checkout", "--quiet", "--orphan", *conf.Branch); err != nil {
+			return err
+		}
+	}
+
+	// the files deleted from the directory are deleted from the branch too
+	if err = clearDir(dir); err != nil {
+		return err
+	}
+	if err = copyDir(*conf.Directory, dir); err != nil {
+		return err
+	}
+
+	if _, err = g.run(dir, "add", "--all"); err != nil {
+		return err
+	}
+	status, err := g.run(dir, "status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if exists && strings.TrimSpace(status) == "" {
+		log.Info(fmt.Sprintf("github_pages: the branch %s of %s is up to date", *conf.Branch, *conf.Repo))
+		return nil
+	}
+	if _, err = g.run(dir, "commit", "--quiet", "--allow-empty", "--message", *conf.CommitMessage); err != nil {
+		return err
+	}
+
+	pushArgs := []string{"push", "--quiet", remote, "HEAD:refs/heads/" + *conf.Branch}
+	if *conf.Clean {
+		pushArgs = append(pushArgs, "--force")
+	}
+	if _, err = g.run(dir, pushArgs...); err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("github_pages: %s successfully pushed to the branch %s of %s", *conf.Directory, *conf.Branch, *conf.Repo))
+	return nil
+}
+
+// git executes the git CLI with args before the ones of each command
+type git struct {
+	args []string
+	ctx  context.Context
+}
+
+// run execute the git command in dir and returns its standard output. The returned error contains
+// the exit code and the stderr output of the command if it fails
+func (g git) run(dir string, args ...string) (string, error) {
+	log.With("directory", dir).Debug(fmt.Sprintf("github_pages: executing git %s", args[0]))
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(g.ctx, "git", append(append([]string{}, g.args...), args...)...)
+	cmd.Env = environ.Environ(g.ctx)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	err := cmd.Run()
+	if err != nil {
+		exitCode, _ := command.ExitCode(err)
+		return "", fmt.Errorf("github_pages: git %s failed with exit code %d: %s", args[0], exitCode, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// clearDir removes the content of the repository dir, except .git
+func clearDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == ".git" {
+			continue
+		}
+		if err = os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyDir copies the content of src to dst, keeping the file modes. The .git directories are skipped
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case !info.Mode().IsRegular():
+			return nil
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
@@ -0,0 +1,83 @@
+package ghreleases
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// readBodyFile returns the content of the body file. If the file is a CHANGELOG.md, only the section
+// of the tag is returned
+func readBodyFile(path, tag string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("github: reading the body file: %s", err.Error())
+	}
+
+	if !strings.EqualFold(filepath.Base(path), "CHANGELOG.md") {
+		return string(data), nil
+	}
+
+	section, ok := changelogSection(string(data), tag)
+	if !ok {
+		return "", fmt.Errorf("github: no section for tag %s found in %s", tag, path)
+	}
+	return section, nil
+}
+
+// changelogSection extracts the content of the section of the Markdown changelog whose heading contains
+// the version, with or without its v prefix (e.g. "## [1.2.0] - 2019-01-01" for the tag v1.2.0). The section
+// ends at the next heading of the same or a higher level
+func changelogSection(changelog, tag string) (string, bool) {
+	version := strings.TrimPrefix(strings.TrimSpace(tag), "v")
+	if version == "" {
+		return "", false
+	}
+
+	lines := strings.Split(changelog, "\n")
+	start, level := -1, 0
+	for i, line := range lines {
+		lineLevel := headingLevel(line)
+		if lineLevel == 0 {
+			continue
+		}
+		if start != -1 && lineLevel <= level {
+			return strings.TrimSpace(strings.Join(lines[start:i], "\n")), true
+		}
+		if start == -1 && containsVersion(line, version) {
+			start, level = i+1, lineLevel
+		}
+	}
+
+	if start == -1 {
+		return "", false
+	}
+	return strings.TrimSpace(strings.Join(lines[start:], "\n")), true
+}
+
+// headingLevel returns the level of the Markdown heading, or 0 if line is not a heading
+func headingLevel(line string) int {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level == len(line) || line[level] != ' ' {
+		return 0
+	}
+	return level
+}
+
+// containsVersion returns true if the heading contains version as a whole word, so 1.2.0 does not
+// match the heading of 1.2.0-beta or 11.2.0
+func containsVersion(heading, version string) bool {
+	words := strings.FieldsFunc(heading, func(r rune) bool {
+		return r == ' ' || r == '[' || r == ']' || r == '(' || r == ')' || r == '#'
+	})
+	for _, word := range words {
+		if strings.TrimPrefix(word, "v") == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package ghreleases
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checksumsFileName returns the name of the checksums file for the given algorithm, e.g: SHA256SUMS
+func checksumsFileName(algorithm string) string {
+	return strings.ToUpper(algorithm) + "SUMS"
+}
+
+// writeChecksums writes in dir a checksums file, in the format of sha256sum, with the digest of each
+// file computed with the given algorithm (sha256 or sha512), and returns its path
+func writeChecksums(algorithm string, files []string, dir string) (string, error) {
+	var newHash func() hash.Hash
+	switch algorithm {
+	case "sha256":
+		newHash = sha256.New
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return "", fmt.Errorf("github: unsupported checksums algorithm %s", algorithm)
+	}
+
+	lines := make([]string, 0, len(files))
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+		h := newHash()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s\n", hex.EncodeToString(h.Sum(nil)), filepath.Base(file)))
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i][strings.Index(lines[i], " "):] < lines[j][strings.Index(lines[j], " "):]
+	})
+
+	path := filepath.Join(dir, checksumsFileName(algorithm))
+	err := ioutil.WriteFile(path, []byte(strings.Join(lines, "")), 0644)
+	return path, err
+}
@@ -0,0 +1,46 @@
+package ghreleases
+
+import (
+	"context"
+
+	"github.com/google/go-github/github"
+)
+
+// CreateDeployment create a deployment of ref to the given environment and returns its ID.
+// The commit statuses are not checked and the default branch is not merged into ref, as the
+// deployment only tracks the one performed by rocket
+func (c *GitHubClient) CreateDeployment(ctx context.Context, repo GitHubRepo, ref, environment string) (int64, error) {
+	deployment, _, err := c.client.Repositories.CreateDeployment(
+		ctx,
+		repo.Owner,
+		repo.Name,
+		&github.DeploymentRequest{
+			Ref:              github.String(ref),
+			Environment:      github.String(environment),
+			AutoMerge:        github.Bool(false),
+			RequiredContexts: &[]string{},
+			Description:      github.String("Deployed by rocket"),
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return deployment.GetID(), nil
+}
+
+// SetDeploymentStatus create a status with the given state (success, failure...) for the deployment.
+// If autoInactive is true, the previous successful deployments to the same environment are marked
+// as inactive
+func (c *GitHubClient) SetDeploymentStatus(ctx context.Context, repo GitHubRepo, deploymentID int64, state string, autoInactive bool) error {
+	_, _, err := c.client.Repositories.CreateDeploymentStatus(
+		ctx,
+		repo.Owner,
+		repo.Name,
+		deploymentID,
+		&github.DeploymentStatusRequest{
+			State:        github.String(state),
+			AutoInactive: github.Bool(autoInactive),
+		},
+	)
+	return err
+}
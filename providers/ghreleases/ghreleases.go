@@ -4,14 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/bloom42/rocket/config"
 	"github.com/bloom42/astroflow-go/log"
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/providers/tempfile"
 )
 
 // GitHubClient represent an authenticated GitHub client to perform the API operations
@@ -24,16 +29,33 @@ type GitHubRepo struct {
 	Name  string
 }
 
+func init() {
+	registry.Register("github_releases", func(conf config.Config) registry.Provider {
+		if conf.GitHubReleases == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.GitHubReleases.Env, When: conf.GitHubReleases.When, Timeout: conf.GitHubReleases.Timeout}
+		return registry.New("github_releases", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.GitHubReleases, conf.DryRun)
+		})
+	})
+}
+
 // Deploy perform the github release with the following steps:
 // Create the release as draft
 // upload assets
 // publish the release (draft = false)
-func Deploy(conf config.GitHubReleasesConfig) error {
+func Deploy(conf config.GitHubReleasesConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.GitHubReleasesConfig, dryRun bool) error {
 	if conf.Name == nil {
-		v := os.Getenv("ROCKET_LAST_TAG")
+		v := environ.Getenv(ctx, "ROCKET_LAST_TAG")
 		conf.Name = &v
 	} else {
-		v := config.ExpandEnv(*conf.Name)
+		v := environ.ExpandEnv(ctx, *conf.Name)
 		conf.Name = &v
 	}
 
@@ -41,7 +63,7 @@ func Deploy(conf config.GitHubReleasesConfig) error {
 		v := ""
 		conf.Body = &v
 	} else {
-		v := config.ExpandEnv(*conf.Body)
+		v := environ.ExpandEnv(ctx, *conf.Body)
 		conf.Body = &v
 	}
 
@@ -51,26 +73,26 @@ func Deploy(conf config.GitHubReleasesConfig) error {
 	}
 
 	if conf.Repo == nil {
-		v := os.Getenv("ROCKET_GIT_REPO")
+		v := environ.Getenv(ctx, "ROCKET_GIT_REPO")
 		conf.Repo = &v
 	} else {
-		v := config.ExpandEnv(*conf.Repo)
+		v := environ.ExpandEnv(ctx, *conf.Repo)
 		conf.Repo = &v
 	}
 
 	if conf.APIKey == nil {
-		v := os.Getenv("GITHUB_API_KEY")
+		v := environ.Getenv(ctx, "GITHUB_API_KEY")
 		conf.APIKey = &v
 	} else {
-		v := config.ExpandEnv(*conf.APIKey)
+		v := environ.ExpandEnv(ctx, *conf.APIKey)
 		conf.APIKey = &v
 	}
 
 	if conf.Tag == nil {
-		v := os.Getenv("ROCKET_LAST_TAG")
+		v := environ.Getenv(ctx, "ROCKET_LAST_TAG")
 		conf.Tag = &v
 	} else {
-		v := config.ExpandEnv(*conf.Tag)
+		v := environ.ExpandEnv(ctx, *conf.Tag)
 		conf.Tag = &v
 	}
 
@@ -79,40 +101,136 @@ func Deploy(conf config.GitHubReleasesConfig) error {
 	}
 
 	if conf.BaseURL == nil {
-		v := os.Getenv("GITHUB_BASE_URL")
+		v := environ.Getenv(ctx, "GITHUB_BASE_URL")
 		conf.BaseURL = &v
 	} else {
-		v := config.ExpandEnv(*conf.BaseURL)
+		v := environ.ExpandEnv(ctx, *conf.BaseURL)
 		conf.BaseURL = &v
 	}
 
 	if conf.UploadURL == nil {
-		v := os.Getenv("GITHUB_UPLOAD_URL")
+		v := environ.Getenv(ctx, "GITHUB_UPLOAD_URL")
 		conf.UploadURL = &v
 	} else {
 		conf.UploadURL = conf.BaseURL
 	}
 
+	if conf.Sign == nil {
+		v := false
+		conf.Sign = &v
+	}
+
+	if conf.GPGKey == nil {
+		v := environ.Getenv(ctx, "GPG_PRIVATE_KEY")
+		conf.GPGKey = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.GPGKey)
+		conf.GPGKey = &v
+	}
+
+	if conf.Checksums == nil {
+		v := ""
+		conf.Checksums = &v
+	} else {
+		v := strings.ToLower(environ.ExpandEnv(ctx, *conf.Checksums))
+		conf.Checksums = &v
+	}
+
+	if conf.BodyFile != nil {
+		body, err := readBodyFile(environ.ExpandEnv(ctx, *conf.BodyFile), *conf.Tag)
+		if err != nil {
+			return err
+		}
+		conf.Body = &body
+	}
+
+	if conf.Overwrite == nil {
+		v := false
+		conf.Overwrite = &v
+	}
+
+	if conf.RateLimitRetries == nil {
+		v := 5
+		conf.RateLimitRetries = &v
+	}
+
 	if *conf.UploadURL != "" && *conf.BaseURL == "" {
 		return errors.New("github: base_url should not be empty when upload_url is set")
 	}
 
-	repo, _ := parseRepo(*conf.Repo)
-	client, err := NewClient(*conf.APIKey, *conf.BaseURL, *conf.UploadURL)
+	repo, _ := ParseRepo(*conf.Repo)
+	client, err := NewClient(*conf.APIKey, *conf.BaseURL, *conf.UploadURL, *conf.RateLimitRetries)
+	if err != nil {
+		return err
+	}
+	files, err := expandAssets(ctx, conf.Assets)
 	if err != nil {
 		return err
 	}
-	files := []string{}
 
-	for _, pattern := range conf.Assets {
-		matches, err := filepath.Glob(pattern)
+	if dryRun {
+		log.Info(fmt.Sprintf("github: would create release %s for tag %s on %s", *conf.Name, strings.TrimSpace(*conf.Tag), *conf.Repo))
+		if *conf.Checksums != "" {
+			files = append(files, checksumsFileName(*conf.Checksums))
+		}
+		for _, file := range files {
+			log.Info(fmt.Sprintf("github: would upload asset %s", file))
+			if *conf.Sign {
+				log.Info(fmt.Sprintf("github: would upload signature %s.asc", filepath.Base(file)))
+			}
+		}
+		return nil
+	}
+
+	// the generated assets (checksums and signatures) are written to a temporary directory
+	dir, err := tempfile.Dir("", "rocket_github_releases")
+	if err != nil {
+		return err
+	}
+	defer tempfile.Remove(dir)
+
+	if *conf.Checksums != "" {
+		checksums, err := writeChecksums(*conf.Checksums, files, dir)
+		if err != nil {
+			return err
+		}
+		files = append(files, checksums)
+	}
+
+	// the assets are signed before the release is created, so it's never published with unsigned assets
+	if *conf.Sign {
+		signatures, err := signAssets(ctx, *conf.GPGKey, environ.Getenv(ctx, "GPG_PASSPHRASE"), files, dir)
+		if err != nil {
+			return err
+		}
+		files = append(files, signatures...)
+	}
+
+	// an existing release is updated, unless it's overwritten: deleted then recreated by CreateDraftRelease
+	existing, err := client.GetReleaseByTag(ctx, repo, strings.TrimSpace(*conf.Tag))
+	if err != nil {
+		return err
+	}
+	if existing != nil && !*conf.Overwrite {
+		log.Info(fmt.Sprintf("github: release for tag %s already exists, updating its assets", strings.TrimSpace(*conf.Tag)))
+		err = client.UpdateAssets(ctx, repo, existing.GetID(), files)
 		if err != nil {
 			return err
 		}
-		files = append(files, matches...)
+		// the release of a previous failed deployment may still be a draft
+		if existing.GetDraft() {
+			log.Debug("github: publishing release")
+			existing, err = client.PublishRelease(ctx, repo, existing.GetID())
+			if err != nil {
+				return err
+			}
+		}
+		log.Info(fmt.Sprintf("github: release updated %s", existing.GetHTMLURL()))
+		return nil
 	}
 
 	releaseID, err := client.CreateDraftRelease(
+		ctx,
 		repo,
 		*conf.Name,
 		strings.TrimSpace(*conf.Tag),
@@ -124,13 +242,13 @@ func Deploy(conf config.GitHubReleasesConfig) error {
 	}
 
 	log.With("files", files).Debug("github: uploading assets")
-	err = client.UploadAssets(repo, releaseID, files)
+	err = client.UploadAssets(ctx, repo, releaseID, files)
 	if err != nil {
 		return err
 	}
 
 	log.Debug("github: publishing release")
-	release, err := client.PublishRelease(repo, releaseID)
+	release, err := client.PublishRelease(ctx, repo, releaseID)
 	if err != nil {
 		return err
 	}
@@ -139,8 +257,35 @@ func Deploy(conf config.GitHubReleasesConfig) error {
 	return nil
 }
 
-// NewClient create a GitHubClient instance with the given authentication information
-func NewClient(token, baseURL, uploadURL string) (GitHubClient, error) {
+// expandAssets returns the files matched by the glob patterns of the assets, in order and without
+// duplicates. A literal path is a pattern matching only itself. An error is returned if a pattern matches no file
+func expandAssets(ctx context.Context, patterns []string) ([]string, error) {
+	files := []string{}
+	seen := map[string]bool{}
+
+	for _, pattern := range patterns {
+		pattern = environ.ExpandEnv(ctx, pattern)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("github: invalid asset pattern %s: %s", pattern, err.Error())
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("github: asset %s matches no file", pattern)
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// NewClient create a GitHubClient instance with the given authentication information.
+// The requests rejected by the rate limits are retried up to rateLimitRetries times
+func NewClient(token, baseURL, uploadURL string, rateLimitRetries int) (GitHubClient, error) {
 	var err error
 	var client *github.Client
 
@@ -148,6 +293,11 @@ func NewClient(token, baseURL, uploadURL string) (GitHubClient, error) {
 		&oauth2.Token{AccessToken: token},
 	)
 	oauthClient := oauth2.NewClient(context.Background(), ts)
+	base := oauthClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	oauthClient.Transport = rateLimitTransport{base, rateLimitRetries}
 
 	if baseURL == "" {
 		client = github.NewClient(oauthClient)
@@ -159,9 +309,8 @@ func NewClient(token, baseURL, uploadURL string) (GitHubClient, error) {
 }
 
 // CreateDraftRelease create a draft release with the given information
-func (c *GitHubClient) CreateDraftRelease(repo GitHubRepo, name, tag, body string, prerelease bool) (int64, error) {
+func (c *GitHubClient) CreateDraftRelease(ctx context.Context, repo GitHubRepo, name, tag, body string, prerelease bool) (int64, error) {
 	var release *github.RepositoryRelease
-	ctx := context.Background()
 	var err error
 	var data = &github.RepositoryRelease{
 		Name:       github.String(name),
@@ -204,8 +353,70 @@ func (c *GitHubClient) CreateDraftRelease(repo GitHubRepo, name, tag, body strin
 	return release.GetID(), nil
 }
 
+// GetReleaseByTag returns the release of the given tag, or nil if there is none
+func (c *GitHubClient) GetReleaseByTag(ctx context.Context, repo GitHubRepo, tag string) (*github.RepositoryRelease, error) {
+	release, res, err := c.client.Repositories.GetReleaseByTag(
+		ctx,
+		repo.Owner,
+		repo.Name,
+		tag,
+	)
+	if err != nil {
+		if res != nil && res.Response != nil && res.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return release, nil
+}
+
+// UpdateAssets uploads the given assets to the given release. The assets already uploaded with the same
+// size are skipped, and the ones with a different size are replaced
+func (c *GitHubClient) UpdateAssets(ctx context.Context, repo GitHubRepo, releaseID int64, files []string) error {
+	existing := map[string]*github.ReleaseAsset{}
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		assets, res, err := c.client.Repositories.ListReleaseAssets(ctx, repo.Owner, repo.Name, releaseID, opt)
+		if err != nil {
+			return err
+		}
+		for _, asset := range assets {
+			existing[asset.GetName()] = asset
+		}
+		if res == nil || res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+
+	toUpload := []string{}
+	for _, file := range files {
+		asset, ok := existing[filepath.Base(file)]
+		if !ok {
+			toUpload = append(toUpload, file)
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if int64(asset.GetSize()) == info.Size() {
+			log.With("file", file).Debug("github: asset already uploaded, skipped")
+			continue
+		}
+		log.Info(fmt.Sprintf("github: replacing asset %s", asset.GetName()))
+		_, err = c.client.Repositories.DeleteReleaseAsset(ctx, repo.Owner, repo.Name, asset.GetID())
+		if err != nil {
+			return err
+		}
+		toUpload = append(toUpload, file)
+	}
+
+	return c.UploadAssets(ctx, repo, releaseID, toUpload)
+}
+
 // UploadAssets upload the given assets to the given release
-func (c *GitHubClient) UploadAssets(repo GitHubRepo, releaseID int64, files []string) error {
+func (c *GitHubClient) UploadAssets(ctx context.Context, repo GitHubRepo, releaseID int64, files []string) error {
 	for _, file := range files {
 		fileName := filepath.Base(file)
 		f, err := os.Open(file)
@@ -213,7 +424,7 @@ func (c *GitHubClient) UploadAssets(repo GitHubRepo, releaseID int64, files []st
 			return err
 		}
 		_, _, err = c.client.Repositories.UploadReleaseAsset(
-			context.Background(),
+			ctx,
 			repo.Owner,
 			repo.Name,
 			releaseID,
@@ -233,13 +444,13 @@ func (c *GitHubClient) UploadAssets(repo GitHubRepo, releaseID int64, files []st
 }
 
 // PublishRelease publish the given release (set draft as false)
-func (c *GitHubClient) PublishRelease(repo GitHubRepo, releaseID int64) (*github.RepositoryRelease, error) {
+func (c *GitHubClient) PublishRelease(ctx context.Context, repo GitHubRepo, releaseID int64) (*github.RepositoryRelease, error) {
 	var data = &github.RepositoryRelease{
 		Draft: github.Bool(false),
 	}
 
 	release, _, err := c.client.Repositories.EditRelease(
-		context.Background(),
+		ctx,
 		repo.Owner,
 		repo.Name,
 		releaseID,
@@ -248,8 +459,8 @@ func (c *GitHubClient) PublishRelease(repo GitHubRepo, releaseID int64) (*github
 	return release, err
 }
 
-// parseRepo take as input a string in the forme "owner/repo" et return a GitHubRepo struct
-func parseRepo(repo string) (GitHubRepo, error) {
+// ParseRepo take as input a string in the forme "owner/repo" et return a GitHubRepo struct
+func ParseRepo(repo string) (GitHubRepo, error) {
 	parts := strings.Split(repo, "/")
 	if len(parts) != 2 {
 		return GitHubRepo{}, errors.New("malformed GitHub repo")
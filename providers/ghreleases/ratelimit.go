@@ -0,0 +1,120 @@
+package ghreleases
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bloom42/astroflow-go/log"
+)
+
+// rateLimitBackoff is the first wait after a rate limited response without a hint of when to retry.
+// GitHub advises to wait at least a minute after hitting a secondary rate limit
+const rateLimitBackoff = time.Minute
+
+// rateLimitTransport retries the requests rejected by the GitHub rate limits (403 or 429 responses),
+// waiting the time given by their Retry-After or X-RateLimit-Reset header, or an exponential backoff,
+// plus a random jitter so the concurrent deployments don't retry at the same time
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	retries int
+}
+
+func (t rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the assets are uploaded from files, which are rewound instead of being closed between the attempts
+	body, seeker := req.Body.(io.ReadSeeker)
+	if seeker {
+		defer req.Body.Close()
+	}
+
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 {
+			var err error
+			if attemptReq, err = rewind(req, body, seeker); err != nil {
+				return nil, err
+			}
+		} else if seeker {
+			clone := *req
+			clone.Body = ioutil.NopCloser(body)
+			attemptReq = &clone
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+		if err != nil || attempt >= t.retries || !canRewind(req, seeker) {
+			return resp, err
+		}
+		wait, limited := rateLimitWait(resp, attempt)
+		if !limited {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		log.Info(fmt.Sprintf("github: rate limited, retrying in %s", wait.Round(time.Second)))
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// canRewind returns true if the body of req can be sent again
+func canRewind(req *http.Request, seeker bool) bool {
+	return req.Body == nil || req.Body == http.NoBody || seeker || req.GetBody != nil
+}
+
+// rewind returns a copy of req whose body is read again from the start
+func rewind(req *http.Request, body io.ReadSeeker, seeker bool) (*http.Request, error) {
+	clone := *req
+	switch {
+	case seeker:
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		clone.Body = ioutil.NopCloser(body)
+	case req.GetBody != nil:
+		b, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		clone.Body = b
+	}
+	return &clone, nil
+}
+
+// rateLimitWait returns how long to wait before retrying the request of resp, and false if resp is not
+// a rate limited response. A 403 is only a rate limit if it has a rate limit header, otherwise it's
+// a permission error
+func rateLimitWait(resp *http.Response, attempt int) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	var wait time.Duration
+	retryAfter := resp.Header.Get("Retry-After")
+	reset := resp.Header.Get("X-RateLimit-Reset")
+	switch {
+	case retryAfter != "":
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		} else if date, err := http.ParseTime(retryAfter); err == nil {
+			wait = time.Until(date)
+		}
+	case reset != "" && resp.Header.Get("X-RateLimit-Remaining") == "0":
+		if epoch, err := strconv.ParseInt(reset, 10, 64); err == nil {
+			wait = time.Until(time.Unix(epoch, 0))
+		}
+	case resp.StatusCode == http.StatusForbidden:
+		return 0, false
+	}
+
+	if wait <= 0 {
+		wait = rateLimitBackoff << uint(attempt)
+	}
+	return wait + time.Duration(rand.Int63n(int64(wait)/4+1)), true
+}
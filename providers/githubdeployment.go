@@ -0,0 +1,112 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/ghreleases"
+)
+
+// githubDeployment is a GitHub deployment created before the providers run, whose status is set
+// once the deployment finished
+type githubDeployment struct {
+	client       ghreleases.GitHubClient
+	repo         ghreleases.GitHubRepo
+	id           int64
+	environment  string
+	autoInactive bool
+	dryRun       bool
+}
+
+// createGitHubDeployment create the GitHub deployment of conf, so the deployment appears in the
+// environments of the repository while the providers run
+func createGitHubDeployment(conf config.GitHubDeploymentConfig, dryRun bool) (*githubDeployment, error) {
+	if conf.Repo == nil {
+		v := os.Getenv("ROCKET_GIT_REPO")
+		conf.Repo = &v
+	} else {
+		v := config.ExpandEnv(*conf.Repo)
+		conf.Repo = &v
+	}
+
+	if conf.APIKey == nil {
+		v := os.Getenv("GITHUB_API_KEY")
+		conf.APIKey = &v
+	} else {
+		v := config.ExpandEnv(*conf.APIKey)
+		conf.APIKey = &v
+	}
+
+	if conf.Environment == nil {
+		v := "production"
+		conf.Environment = &v
+	} else {
+		v := config.ExpandEnv(*conf.Environment)
+		conf.Environment = &v
+	}
+
+	if conf.Ref == nil {
+		v := os.Getenv("ROCKET_COMMIT_HASH")
+		conf.Ref = &v
+	} else {
+		v := config.ExpandEnv(*conf.Ref)
+		conf.Ref = &v
+	}
+
+	if conf.AutoInactive == nil {
+		v := true
+		conf.AutoInactive = &v
+	}
+
+	repo, err := ghreleases.ParseRepo(*conf.Repo)
+	if err != nil {
+		return nil, fmt.Errorf("github_deployment: %s", err.Error())
+	}
+
+	deployment := &githubDeployment{
+		repo:         repo,
+		environment:  *conf.Environment,
+		autoInactive: *conf.AutoInactive,
+		dryRun:       dryRun,
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("github_deployment: would create a deployment of %s to %s in %s", *conf.Ref, *conf.Environment, *conf.Repo))
+		return deployment, nil
+	}
+
+	deployment.client, err = ghreleases.NewClient(*conf.APIKey, "", "", 5)
+	if err != nil {
+		return nil, fmt.Errorf("github_deployment: %s", err.Error())
+	}
+	deployment.id, err = deployment.client.CreateDeployment(context.Background(), repo, *conf.Ref, *conf.Environment)
+	if err != nil {
+		return nil, fmt.Errorf("github_deployment: creating the deployment: %s", err.Error())
+	}
+	log.With("id", deployment.id).Info(fmt.Sprintf("github_deployment: deployment of %s to %s created", *conf.Ref, *conf.Environment))
+	return deployment, nil
+}
+
+// finish set the status of the deployment to success if err is nil, to failure otherwise. The
+// result of the deployment is already known, so a failure to update the status is only logged
+func (d *githubDeployment) finish(err error) {
+	state := "success"
+	if err != nil {
+		state = "failure"
+	}
+
+	if d.dryRun {
+		log.Info(fmt.Sprintf("github_deployment: would set the status of the deployment to %s", state))
+		return
+	}
+
+	if err := d.client.SetDeploymentStatus(context.Background(), d.repo, d.id, state, d.autoInactive); err != nil {
+		log.Warn(fmt.Sprintf("github_deployment: setting the status of the deployment: %s", err.Error()))
+		return
+	}
+	log.With("id", d.id).Info(fmt.Sprintf("github_deployment: deployment to %s marked as %s", d.environment, state))
+}
@@ -0,0 +1,322 @@
+package glreleases
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/version"
+)
+
+// Client is an wrapper to perform various task against the GitLab API
+type Client struct {
+	Token     string
+	BaseURL   string
+	HTTP      *http.Client
+	UserAgent string
+}
+
+// Project is the response to the https://gitlab.com/api/v4/projects/:id API call
+type Project struct {
+	ID     int64  `json:"id"`
+	WebURL string `json:"web_url"`
+}
+
+// Upload is the response to the https://gitlab.com/api/v4/projects/:id/uploads API call
+type Upload struct {
+	Alt      string `json:"alt"`
+	URL      string `json:"url"`
+	Markdown string `json:"markdown"`
+}
+
+// ReleaseLink is an asset link of a release
+type ReleaseLink struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// CreateReleaseReq is the payload of the https://gitlab.com/api/v4/projects/:id/releases API call
+type CreateReleaseReq struct {
+	Name        string `json:"name"`
+	TagName     string `json:"tag_name"`
+	Description string `json:"description"`
+	Assets      struct {
+		Links []ReleaseLink `json:"links"`
+	} `json:"assets"`
+}
+
+// Release is the response to the https://gitlab.com/api/v4/projects/:id/releases API call
+type Release struct {
+	Name    string `json:"name"`
+	TagName string `json:"tag_name"`
+}
+
+func init() {
+	registry.Register("gitlab_releases", func(conf config.Config) registry.Provider {
+		if conf.GitLabReleases == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.GitLabReleases.Env, When: conf.GitLabReleases.When, Timeout: conf.GitLabReleases.Timeout}
+		return registry.New("gitlab_releases", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.GitLabReleases, conf.DryRun)
+		})
+	})
+}
+
+// Deploy perform the gitlab release with the following steps:
+// upload assets
+// delete the existing release for the tag if any
+// create the release with links to the uploaded assets
+func Deploy(conf config.GitLabReleasesConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.GitLabReleasesConfig, dryRun bool) error {
+	if conf.Name == nil {
+		v := environ.Getenv(ctx, "ROCKET_LAST_TAG")
+		conf.Name = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Name)
+		conf.Name = &v
+	}
+
+	if conf.Body == nil {
+		v := ""
+		conf.Body = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Body)
+		conf.Body = &v
+	}
+
+	if conf.ProjectID == nil {
+		v := environ.Getenv(ctx, "ROCKET_GIT_REPO")
+		conf.ProjectID = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.ProjectID)
+		conf.ProjectID = &v
+	}
+
+	if conf.APIKey == nil {
+		v := environ.Getenv(ctx, "GITLAB_API_KEY")
+		conf.APIKey = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.APIKey)
+		conf.APIKey = &v
+	}
+
+	if conf.Tag == nil {
+		v := environ.Getenv(ctx, "ROCKET_LAST_TAG")
+		conf.Tag = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Tag)
+		conf.Tag = &v
+	}
+
+	if conf.Assets == nil {
+		conf.Assets = []string{}
+	}
+
+	if conf.BaseURL == nil {
+		v := environ.Getenv(ctx, "GITLAB_BASE_URL")
+		if v == "" {
+			v = "https://gitlab.com/api/v4"
+		}
+		conf.BaseURL = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.BaseURL)
+		conf.BaseURL = &v
+	}
+
+	client := NewClient(*conf.APIKey, *conf.BaseURL)
+	client.HTTP = httpclient.WithContext(ctx, client.HTTP)
+	projectID := strings.TrimSpace(*conf.ProjectID)
+	tag := strings.TrimSpace(*conf.Tag)
+
+	files := []string{}
+	for _, pattern := range conf.Assets {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		files = append(files, matches...)
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("gitlab: would create release %s for tag %s on %s", *conf.Name, tag, projectID))
+		for _, file := range files {
+			log.Info(fmt.Sprintf("gitlab: would upload asset %s", file))
+		}
+		return nil
+	}
+
+	project, err := client.GetProject(projectID)
+	if err != nil {
+		return err
+	}
+
+	release := CreateReleaseReq{
+		Name:        *conf.Name,
+		TagName:     tag,
+		Description: *conf.Body,
+	}
+	release.Assets.Links = []ReleaseLink{}
+
+	log.With("files", files).Debug("gitlab: uploading assets")
+	for _, file := range files {
+		upload, err := client.UploadFile(projectID, file)
+		if err != nil {
+			return err
+		}
+		release.Assets.Links = append(release.Assets.Links, ReleaseLink{
+			Name: filepath.Base(file),
+			URL:  strings.TrimSuffix(project.WebURL, "/") + upload.URL,
+		})
+		log.Info(fmt.Sprintf("gitlab: asset %s uploaded", file))
+	}
+
+	deleted, err := client.DeleteRelease(projectID, tag)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		log.Info(fmt.Sprintf("gitlab: existing release %s deleted", tag))
+	}
+
+	_, err = client.CreateRelease(projectID, release)
+	if err != nil {
+		return err
+	}
+
+	log.Info(fmt.Sprintf("gitlab: release published %s/-/releases", strings.TrimSuffix(project.WebURL, "/")))
+	return nil
+}
+
+// NewClient create a Client instance with the given authentication information
+func NewClient(token, baseURL string) Client {
+	return Client{token, strings.TrimSuffix(baseURL, "/"), &http.Client{}, fmt.Sprintf("rocket/%s", version.Version)}
+}
+
+func (c *Client) do(method, path, contentType string, payload io.Reader) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, c.BaseURL+path, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("PRIVATE-TOKEN", c.Token)
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	return resp, body, err
+}
+
+// GetProject fetch the given project
+func (c *Client) GetProject(projectID string) (Project, error) {
+	var ret Project
+
+	resp, body, err := c.do("GET", fmt.Sprintf("/projects/%s", url.PathEscape(projectID)), "", nil)
+	if err != nil {
+		return ret, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ret, &httpclient.StatusError{StatusCode: resp.StatusCode, Body: fmt.Sprintf("gitlab: getting project %s: %s", projectID, string(body))}
+	}
+
+	err = json.Unmarshal(body, &ret)
+	return ret, err
+}
+
+// UploadFile upload the given file to the project's uploads
+func (c *Client) UploadFile(projectID, file string) (Upload, error) {
+	var ret Upload
+
+	f, err := os.Open(file)
+	if err != nil {
+		return ret, err
+	}
+	defer f.Close()
+
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	part, err := writer.CreateFormFile("file", filepath.Base(file))
+	if err != nil {
+		return ret, err
+	}
+	if _, err = io.Copy(part, f); err != nil {
+		return ret, err
+	}
+	if err = writer.Close(); err != nil {
+		return ret, err
+	}
+
+	resp, body, err := c.do("POST", fmt.Sprintf("/projects/%s/uploads", url.PathEscape(projectID)), writer.FormDataContentType(), payload)
+	if err != nil {
+		return ret, err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return ret, &httpclient.StatusError{StatusCode: resp.StatusCode, Body: fmt.Sprintf("gitlab: uploading %s: %s", file, string(body))}
+	}
+
+	err = json.Unmarshal(body, &ret)
+	return ret, err
+}
+
+// DeleteRelease delete the release of the given tag. It returns false if the release does not exist
+func (c *Client) DeleteRelease(projectID, tag string) (bool, error) {
+	resp, body, err := c.do("DELETE", fmt.Sprintf("/projects/%s/releases/%s", url.PathEscape(projectID), url.PathEscape(tag)), "", nil)
+	if err != nil {
+		return false, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, &httpclient.StatusError{StatusCode: resp.StatusCode, Body: fmt.Sprintf("gitlab: deleting release %s: %s", tag, string(body))}
+	}
+}
+
+// CreateRelease create a release with the given information
+func (c *Client) CreateRelease(projectID string, payload CreateReleaseReq) (Release, error) {
+	var ret Release
+
+	data, err := json.Marshal(&payload)
+	if err != nil {
+		return ret, err
+	}
+
+	resp, body, err := c.do("POST", fmt.Sprintf("/projects/%s/releases", url.PathEscape(projectID)), "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return ret, err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return ret, &httpclient.StatusError{StatusCode: resp.StatusCode, Body: fmt.Sprintf("gitlab: creating release: %s", string(body))}
+	}
+
+	err = json.Unmarshal(body, &ret)
+	return ret, err
+}
@@ -0,0 +1,85 @@
+package providers
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/version"
+)
+
+// checkHealth polls the URL of the health check until it responds with the expected status, or
+// returns an error once the retries are exhausted
+func checkHealth(conf config.HealthCheckConfig, dryRun bool) error {
+	url := config.ExpandEnv(*conf.URL)
+
+	expectStatus := http.StatusOK
+	if conf.ExpectStatus != nil {
+		expectStatus = *conf.ExpectStatus
+	}
+
+	retries := 10
+	if conf.Retries != nil {
+		retries = *conf.Retries
+	}
+
+	timeout := 10 * time.Second
+	interval := 5 * time.Second
+	var err error
+	if conf.Timeout != nil {
+		if timeout, err = time.ParseDuration(config.ExpandEnv(*conf.Timeout)); err != nil {
+			return err
+		}
+	}
+	if conf.Interval != nil {
+		if interval, err = time.ParseDuration(config.ExpandEnv(*conf.Interval)); err != nil {
+			return err
+		}
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("health_check: would check that %s responds with %d", url, expectStatus))
+		return nil
+	}
+
+	client := &http.Client{Timeout: timeout}
+	for attempt := 0; ; attempt++ {
+		log.Debug(fmt.Sprintf("health_check: checking %s", url))
+		status, err := healthStatus(client, url)
+		if err == nil && status == expectStatus {
+			log.Info(fmt.Sprintf("health_check: %s is healthy", url))
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("unexpected status code %d", status)
+		}
+		if attempt >= retries {
+			return fmt.Errorf("health_check: %s is not healthy after %d attempts: %s", url, attempt+1, err.Error())
+		}
+		log.Info(fmt.Sprintf("health_check: %s is not healthy yet (%s), retrying in %s", url, err.Error(), interval))
+		time.Sleep(interval)
+	}
+}
+
+// healthStatus returns the status code of a GET request to url
+func healthStatus(client *http.Client, url string) (int, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("rocket/%s", version.Version))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// the body is drained so the connection is reused by the next attempt
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,143 @@
+package heroku
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/command"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/httpclient"
+)
+
+// registryHost is the host of the Heroku container registry
+const registryHost = "registry.heroku.com"
+
+// FormationUpdate is the image of a process type released by the
+// https://api.heroku.com/apps/{app}/formation API call
+type FormationUpdate struct {
+	Type        string `json:"type"`
+	DockerImage string `json:"docker_image"`
+}
+
+// deployContainer pushes the images of the process types to the Heroku container registry, then
+// releases them. Without conf.Image, the images should already be tagged registry.heroku.com/<app>/<process type>
+func deployContainer(ctx context.Context, conf config.HerokuConfig, dryRun bool) error {
+	processTypes := conf.ProcessTypes
+	if len(processTypes) == 0 {
+		processTypes = []string{"web"}
+	}
+
+	image := ""
+	if conf.Image != nil {
+		image = environ.ExpandEnv(ctx, *conf.Image)
+	}
+
+	targets := make([]string, len(processTypes))
+	for i, processType := range processTypes {
+		targets[i] = fmt.Sprintf("%s/%s/%s", registryHost, *conf.App, environ.ExpandEnv(ctx, processType))
+	}
+
+	if dryRun {
+		for _, target := range targets {
+			if image != "" {
+				log.Info(fmt.Sprintf("heroku: would tag %s as %s", image, target))
+			}
+			log.Info(fmt.Sprintf("heroku: would push %s", target))
+		}
+		log.Info(fmt.Sprintf("heroku: would release %s of app %s", strings.Join(processTypes, ", "), *conf.App))
+		return nil
+	}
+
+	// the API key is the password of the registry, read from stdin so it's not visible in the processes
+	_, err := docker(ctx, strings.NewReader(*conf.APIKey), "login", "--username", "_", "--password-stdin", registryHost)
+	if err != nil {
+		return err
+	}
+
+	updates := make([]FormationUpdate, len(targets))
+	for i, target := range targets {
+		if image != "" {
+			if _, err = docker(ctx, nil, "tag", image, target); err != nil {
+				return err
+			}
+		}
+		log.Info(fmt.Sprintf("heroku: pushing %s", target))
+		if _, err = docker(ctx, nil, "push", target); err != nil {
+			return err
+		}
+		id, err := docker(ctx, nil, "inspect", "--format", "{{.Id}}", target)
+		if err != nil {
+			return err
+		}
+		updates[i] = FormationUpdate{Type: environ.ExpandEnv(ctx, processTypes[i]), DockerImage: strings.TrimSpace(id)}
+	}
+
+	client := NewClient(*conf.APIKey, *conf.App)
+	client.HTTP = httpclient.WithContext(ctx, client.HTTP)
+	if err = client.ReleaseContainers(updates); err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("heroku: %s of app %s released", strings.Join(processTypes, ", "), *conf.App))
+	return nil
+}
+
+// docker executes the docker CLI with the given stdin, and returns its standard output. The returned
+// error contains the exit code and the stderr output of the command if it fails
+func docker(ctx context.Context, stdin io.Reader, args ...string) (string, error) {
+	log.Debug(fmt.Sprintf("heroku: executing docker %s", args[0]))
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Env = environ.Environ(ctx)
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	err := cmd.Run()
+	if err != nil {
+		exitCode, _ := command.ExitCode(err)
+		return "", fmt.Errorf("heroku: docker %s failed with exit code %d: %s", args[0], exitCode, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// ReleaseContainers releases the images pushed to the container registry for their process types
+func (c *Client) ReleaseContainers(updates []FormationUpdate) error {
+	data, err := json.Marshal(map[string][]FormationUpdate{"updates": updates})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PATCH", fmt.Sprintf("https://api.heroku.com/apps/%s/formation", c.App), bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.heroku+json; version=3.docker-releases")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+	req.Header.Set("User-Agent", c.UserAgent)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return nil
+}
@@ -4,19 +4,25 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
-	"github.com/bloom42/rocket/config"
-	"github.com/bloom42/rocket/version"
 	"github.com/bloom42/astroflow-go/log"
 	"github.com/z0mbie42/fswalk"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/providers/tempfile"
+	"github.com/bloom42/rocket/version"
 )
 
 // CreateSourceResp is the response to the https://api.heroku.com/apps/{app}/builds API call
@@ -57,6 +63,15 @@ type CreateBuildResp struct {
 	} `json:"user"`
 }
 
+// Release is an element of the response to the https://api.heroku.com/apps/{app}/releases API call
+type Release struct {
+	ID          string `json:"id"`
+	Version     int    `json:"version"`
+	Status      string `json:"status"`
+	Current     bool   `json:"current"`
+	Description string `json:"description"`
+}
+
 type CreateBuildReq struct {
 	SourceBlob CreateBuildSourceBlob `json:"source_blob"`
 }
@@ -74,23 +89,46 @@ type Client struct {
 	UserAgent string
 }
 
+func init() {
+	registry.Register("heroku", func(conf config.Config) registry.Provider {
+		if conf.Heroku == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.Heroku.Env, When: conf.Heroku.When, Timeout: conf.Heroku.Timeout}
+		return registry.New("heroku", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.Heroku, conf.DryRun)
+		})
+	})
+}
+
 // Deploy deploy the script part of the configuration
 // create an archive then release using the API
 // https://devcenter.heroku.com/articles/build-and-release-using-the-api
-func Deploy(conf config.HerokuConfig) error {
+// or, if conf.Container is true, push the images to the container registry then release them
+// https://devcenter.heroku.com/articles/container-registry-and-runtime
+func Deploy(conf config.HerokuConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.HerokuConfig, dryRun bool) error {
+	if conf.Rollback != nil && *conf.Rollback {
+		return rollback(ctx, conf, dryRun)
+	}
+
 	if conf.App == nil {
-		v := os.Getenv("HEROKU_APP")
+		v := environ.Getenv(ctx, "HEROKU_APP")
 		conf.App = &v
 	} else {
-		v := config.ExpandEnv(*conf.App)
+		v := environ.ExpandEnv(ctx, *conf.App)
 		conf.App = &v
 	}
 
 	if conf.APIKey == nil {
-		v := os.Getenv("HEROKU_API_KEY")
+		v := environ.Getenv(ctx, "HEROKU_API_KEY")
 		conf.APIKey = &v
 	} else {
-		v := config.ExpandEnv(*conf.APIKey)
+		v := environ.ExpandEnv(ctx, *conf.APIKey)
 		conf.APIKey = &v
 	}
 
@@ -98,24 +136,41 @@ func Deploy(conf config.HerokuConfig) error {
 		v := "."
 		conf.Directory = &v
 	} else {
-		v := config.ExpandEnv(*conf.Directory)
+		v := environ.ExpandEnv(ctx, *conf.Directory)
 		conf.Directory = &v
 	}
 
 	if conf.Version == nil {
-		v := os.Getenv("ROCKET_COMMIT_HASH")
+		v := environ.Getenv(ctx, "ROCKET_COMMIT_HASH")
 		conf.Version = &v
 	} else {
-		v := config.ExpandEnv(*conf.Version)
+		v := environ.ExpandEnv(ctx, *conf.Version)
 		conf.Version = &v
 	}
 
+	if conf.Container != nil && *conf.Container {
+		return deployContainer(ctx, conf, dryRun)
+	}
+
+	if dryRun {
+		walker, _ := fswalk.NewWalker()
+		filesc, _ := walker.Walk(*conf.Directory)
+		for file := range filesc {
+			if file.Path == "." || file.IsDir || file.IsSymLink {
+				continue
+			}
+			log.With("file", file.Path).Debug("heroku: would add file to final archive")
+		}
+		log.Info(fmt.Sprintf("heroku: would build and release version %s of app %s", *conf.Version, *conf.App))
+		return nil
+	}
+
 	// create the archive
-	tmpFile, err := ioutil.TempFile("", "rocket.*.tar.gz")
+	tmpFile, err := tempfile.File("", "rocket.*.tar.gz")
 	if err != nil {
 		return err
 	}
-	defer os.Remove(tmpFile.Name())
+	defer tempfile.Remove(tmpFile.Name())
 	// set up the gzip writer
 	gw := gzip.NewWriter(tmpFile)
 	tw := tar.NewWriter(gw)
@@ -145,6 +200,7 @@ func Deploy(conf config.HerokuConfig) error {
 
 	// upload it
 	client := NewClient(*conf.APIKey, *conf.App)
+	client.HTTP = httpclient.WithContext(ctx, client.HTTP)
 	sourceRep, err := client.CreateSource()
 	log.With("response", sourceRep).Debug("heroku: create source response")
 	log.Info("heroku: source created")
@@ -168,6 +224,91 @@ func Deploy(conf config.HerokuConfig) error {
 	return nil
 }
 
+// RollbackHeroku rolls the app back to conf.RollbackTo (a release version or ID) or, if not set,
+// to the release preceding the current one
+func RollbackHeroku(conf config.HerokuConfig) error {
+	return rollback(context.Background(), conf, false)
+}
+
+func rollback(ctx context.Context, conf config.HerokuConfig, dryRun bool) error {
+	if conf.App == nil {
+		v := environ.Getenv(ctx, "HEROKU_APP")
+		conf.App = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.App)
+		conf.App = &v
+	}
+
+	if conf.APIKey == nil {
+		v := environ.Getenv(ctx, "HEROKU_API_KEY")
+		conf.APIKey = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.APIKey)
+		conf.APIKey = &v
+	}
+
+	if conf.RollbackTo == nil {
+		v := ""
+		conf.RollbackTo = &v
+	} else {
+		v := strings.TrimPrefix(environ.ExpandEnv(ctx, *conf.RollbackTo), "v")
+		conf.RollbackTo = &v
+	}
+
+	if dryRun {
+		if *conf.RollbackTo != "" {
+			log.Info(fmt.Sprintf("heroku: would roll app %s back to release %s", *conf.App, *conf.RollbackTo))
+		} else {
+			log.Info(fmt.Sprintf("heroku: would roll app %s back to the previous release", *conf.App))
+		}
+		return nil
+	}
+
+	client := NewClient(*conf.APIKey, *conf.App)
+	client.HTTP = httpclient.WithContext(ctx, client.HTTP)
+	target := *conf.RollbackTo
+	if target == "" {
+		releases, err := client.ListReleases()
+		if err != nil {
+			return err
+		}
+		previous, err := previousRelease(releases)
+		if err != nil {
+			return err
+		}
+		target = previous.ID
+		log.With("release", previous.Version).Debug("heroku: previous release found")
+	}
+
+	release, err := client.CreateRollback(target)
+	if err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("heroku: app %s rolled back, new release v%d", *conf.App, release.Version))
+	return nil
+}
+
+// previousRelease returns the latest succeeded release older than the current one.
+// releases should be sorted by descending version
+func previousRelease(releases []Release) (Release, error) {
+	current := -1
+	for i, release := range releases {
+		if release.Current {
+			current = i
+			break
+		}
+	}
+	if current == -1 {
+		return Release{}, fmt.Errorf("heroku: current release not found")
+	}
+	for _, release := range releases[current+1:] {
+		if release.Status == "succeeded" {
+			return release, nil
+		}
+	}
+	return Release{}, fmt.Errorf("heroku: no release to roll back to before v%d", releases[current].Version)
+}
+
 func NewClient(apiKey, app string) Client {
 	return Client{apiKey, app, &http.Client{}, fmt.Sprintf("rocket/%s", version.Version)}
 }
@@ -218,6 +359,9 @@ func (c *Client) CreateSource() (CreateSourceResp, error) {
 	if err != nil {
 		return ret, err
 	}
+	if resp.StatusCode >= 300 {
+		return ret, &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
 	err = json.Unmarshal(body, &ret)
 	return ret, err
 }
@@ -242,8 +386,8 @@ func (c *Client) UploadRelease(file, putURL string) error {
 		return err
 	}
 
-	if len(body) != 0 {
-		return errors.New(string(body))
+	if resp.StatusCode >= 300 || len(body) != 0 {
+		return &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 	return nil
 }
@@ -262,8 +406,35 @@ func (c *Client) CreateBuild(payload CreateBuildReq) (CreateBuildResp, error) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
 	req.Header.Set("User-Agent", c.UserAgent)
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return ret, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return ret, err
+	}
+	if resp.StatusCode >= 300 {
+		return ret, &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	err = json.Unmarshal(body, &ret)
+	return ret, err
+}
+
+// ListReleases returns the latest releases of the app, by descending version
+func (c *Client) ListReleases() ([]Release, error) {
+	var ret []Release
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://api.heroku.com/apps/%s/releases", c.App), nil)
+	if err != nil {
+		return ret, err
+	}
+	req.Header.Set("Accept", "application/vnd.heroku+json; version=3")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+	req.Header.Set("User-Agent", c.UserAgent)
+	req.Header.Set("Range", "version ..; order=desc, max=20")
+	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return ret, err
 	}
@@ -272,6 +443,43 @@ func (c *Client) CreateBuild(payload CreateBuildReq) (CreateBuildResp, error) {
 	if err != nil {
 		return ret, err
 	}
+	if resp.StatusCode >= 300 {
+		return ret, &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	err = json.Unmarshal(body, &ret)
+	return ret, err
+}
+
+// CreateRollback creates a new release of the app with the code and config of the given release
+// (version or ID)
+func (c *Client) CreateRollback(release string) (Release, error) {
+	var ret Release
+
+	data, err := json.Marshal(map[string]string{"release": release})
+	if err != nil {
+		return ret, err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("https://api.heroku.com/apps/%s/releases", c.App), bytes.NewBuffer(data))
+	if err != nil {
+		return ret, err
+	}
+	req.Header.Set("Accept", "application/vnd.heroku+json; version=3")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+	req.Header.Set("User-Agent", c.UserAgent)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return ret, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return ret, err
+	}
+	if resp.StatusCode >= 300 {
+		return ret, &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
 	err = json.Unmarshal(body, &ret)
 	return ret, err
 }
@@ -0,0 +1,42 @@
+package providers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/command"
+)
+
+// runHooks sequentially execute the given shell commands, and stops at the first failing one.
+// The returned error contains the exit code and the stderr output of the failing command
+func runHooks(kind string, hooks []string, dryRun bool) error {
+	for _, hook := range hooks {
+		hook = config.ExpandEnv(hook)
+		if dryRun {
+			log.Info(fmt.Sprintf("%s: would execute %s", kind, hook))
+			continue
+		}
+
+		log.Debug(fmt.Sprintf("%s: executing %s", kind, hook))
+		var stderr bytes.Buffer
+		cmd := exec.Command("sh", "-c", hook)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+		err := cmd.Run()
+		if err != nil {
+			exitCode, _ := command.ExitCode(err)
+			return fmt.Errorf("%s: %s failed with exit code %d: %s", kind, hook, exitCode, strings.TrimSpace(stderr.String()))
+		}
+		log.Info(fmt.Sprintf("%s: %s successfully executed", kind, hook))
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// StatusError is returned by the providers when an API responds with an unexpected status code
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (err *StatusError) Error() string {
+	if err.Body == "" {
+		return fmt.Sprintf("unexpected status code %d", err.StatusCode)
+	}
+	return err.Body
+}
+
+// Temporary returns true if the request may succeed if retried (server errors and rate limiting)
+func (err *StatusError) Temporary() bool {
+	return err.StatusCode >= 500 || err.StatusCode == 429
+}
+
+// WithContext returns a copy of client whose requests are cancelled when ctx is done
+func WithContext(ctx context.Context, client *http.Client) *http.Client {
+	ret := *client
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ret.Transport = contextTransport{ctx, base}
+	return &ret
+}
+
+// contextTransport sets the context of the requests it sends
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
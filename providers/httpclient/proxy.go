@@ -0,0 +1,69 @@
+package httpclient
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// proxyURL is the proxy set with SetProxy, nil to use the proxy of the environment
+var proxyURL *url.URL
+
+// SetProxy sets the proxy returned by Proxy, overriding the HTTP_PROXY and HTTPS_PROXY env variables.
+// It is also set as the proxy of http.DefaultTransport, used by the clients without transport
+func SetProxy(rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid proxy URL %s", rawurl)
+	}
+	proxyURL = u
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport.Proxy = Proxy
+	}
+	return nil
+}
+
+// Proxy returns the proxy of req, to be used as the Proxy of an http.Transport: the one set with SetProxy,
+// or the one of the HTTP_PROXY and HTTPS_PROXY env variables. The hosts of NO_PROXY are requested directly
+func Proxy(req *http.Request) (*url.URL, error) {
+	if proxyURL == nil {
+		return http.ProxyFromEnvironment(req)
+	}
+	if noProxy(req.URL.Hostname()) {
+		return nil, nil
+	}
+	return proxyURL, nil
+}
+
+// noProxy returns true if host should not be requested through the proxy: localhost, the loopback
+// addresses, and the hosts matching NO_PROXY (e.g: "example.com" matches example.com and its subdomains)
+func noProxy(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+
+	value := os.Getenv("NO_PROXY")
+	if value == "" {
+		value = os.Getenv("no_proxy")
+	}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "*" {
+			return true
+		}
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if entry != "" && (host == entry || strings.HasSuffix(host, "."+entry)) {
+			return true
+		}
+	}
+	return false
+}
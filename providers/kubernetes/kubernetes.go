@@ -0,0 +1,195 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/command"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/providers/tempfile"
+)
+
+func init() {
+	registry.Register("kubernetes", func(conf config.Config) registry.Provider {
+		if conf.Kubernetes == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.Kubernetes.Env, When: conf.Kubernetes.When, Timeout: conf.Kubernetes.Timeout}
+		return registry.New("kubernetes", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.Kubernetes, conf.DryRun)
+		})
+	})
+}
+
+// Deploy applies the manifests to the cluster with kubectl apply, following the below steps:
+// expand the environment variables of the manifests
+// apply them (pruning the resources matching the selector if enabled)
+// wait for the rollout of the applied deployments, statefulsets and daemonsets
+func Deploy(conf config.KubernetesConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.KubernetesConfig, dryRun bool) error {
+	var err error
+
+	if conf.Kubeconfig == nil {
+		v := environ.Getenv(ctx, "KUBECONFIG")
+		conf.Kubeconfig = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Kubeconfig)
+		conf.Kubeconfig = &v
+	}
+
+	if conf.Context == nil {
+		v := ""
+		conf.Context = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Context)
+		conf.Context = &v
+	}
+
+	if conf.Namespace == nil {
+		v := ""
+		conf.Namespace = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Namespace)
+		conf.Namespace = &v
+	}
+
+	if conf.Manifests == nil {
+		conf.Manifests = []string{}
+	}
+
+	if conf.Prune == nil {
+		v := false
+		conf.Prune = &v
+	}
+
+	if conf.Selector == nil {
+		v := ""
+		conf.Selector = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Selector)
+		conf.Selector = &v
+	}
+
+	files := []string{}
+	for _, pattern := range conf.Manifests {
+		matches, err := filepath.Glob(environ.ExpandEnv(ctx, pattern))
+		if err != nil {
+			return err
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("kubernetes: no manifest found")
+	}
+
+	manifests := []string{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		manifests = append(manifests, environ.ExpandEnv(ctx, string(data)))
+	}
+
+	if dryRun {
+		for _, file := range files {
+			log.Info(fmt.Sprintf("kubernetes: would apply %s", file))
+		}
+		if *conf.Prune {
+			log.Info(fmt.Sprintf("kubernetes: would prune the resources matching %s", *conf.Selector))
+		}
+		return nil
+	}
+
+	// an inline kubeconfig is written to a temporary file as kubectl only reads it from files
+	kubeconfig := *conf.Kubeconfig
+	if strings.Contains(kubeconfig, "\n") {
+		file, err := tempfile.File("", "rocket_kubeconfig")
+		if err != nil {
+			return err
+		}
+		defer tempfile.Remove(file.Name())
+		if _, err = file.WriteString(kubeconfig); err != nil {
+			file.Close()
+			return err
+		}
+		if err = file.Close(); err != nil {
+			return err
+		}
+		kubeconfig = file.Name()
+	}
+
+	globalArgs := []string{}
+	if kubeconfig != "" {
+		globalArgs = append(globalArgs, "--kubeconfig", kubeconfig)
+	}
+	if *conf.Context != "" {
+		globalArgs = append(globalArgs, "--context", *conf.Context)
+	}
+	if *conf.Namespace != "" {
+		globalArgs = append(globalArgs, "--namespace", *conf.Namespace)
+	}
+
+	applyArgs := []string{"apply", "--filename", "-", "--output", "name"}
+	if *conf.Prune {
+		applyArgs = append(applyArgs, "--prune", "--selector", *conf.Selector)
+	}
+	output, err := kubectl(ctx, strings.Join(manifests, "\n---\n"), append(applyArgs, globalArgs...)...)
+	if err != nil {
+		return err
+	}
+
+	resources := strings.Fields(output)
+	log.Info(fmt.Sprintf("kubernetes: %d resource(s) applied", len(resources)))
+
+	for _, resource := range resources {
+		kind := strings.SplitN(resource, "/", 2)[0]
+		kind = strings.SplitN(kind, ".", 2)[0]
+		if kind != "deployment" && kind != "statefulset" && kind != "daemonset" {
+			continue
+		}
+		log.Info(fmt.Sprintf("kubernetes: waiting for the rollout of %s", resource))
+		_, err = kubectl(ctx, "", append([]string{"rollout", "status", resource}, globalArgs...)...)
+		if err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("kubernetes: %s successfully rolled out", resource))
+	}
+
+	return nil
+}
+
+// kubectl executes kubectl with stdin as standard input and returns its standard output. The returned
+// error contains the exit code and the stderr output of the command if it fails
+func kubectl(ctx context.Context, stdin string, args ...string) (string, error) {
+	log.With("args", args).Debug(fmt.Sprintf("kubernetes: executing kubectl %s", args[0]))
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "kubectl", args...)
+	cmd.Env = environ.Environ(ctx)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	err := cmd.Run()
+	if err != nil {
+		exitCode, _ := command.ExitCode(err)
+		return "", fmt.Errorf("kubernetes: kubectl %s failed with exit code %d: %s", args[0], exitCode, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,278 @@
+package maven
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/command"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/version"
+)
+
+// extensions are the extensions of the uploaded artifacts
+var extensions = []string{".jar", ".war", ".aar", ".pom"}
+
+// pom is the project's coordinates of a pom.xml file
+type pom struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+	Parent     struct {
+		GroupID string `xml:"groupId"`
+		Version string `xml:"version"`
+	} `xml:"parent"`
+}
+
+func init() {
+	registry.Register("maven", func(conf config.Config) registry.Provider {
+		if conf.Maven == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.Maven.Env, When: conf.Maven.When, Timeout: conf.Maven.Timeout}
+		return registry.New("maven", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.Maven, conf.DryRun)
+		})
+	})
+}
+
+// Deploy publishes the artifacts of the directory to the Maven repository, following the below steps:
+// read the coordinates of the project from its pom
+// upload each artifact (jar, war, aar and pom) and its checksums with HTTP PUT requests
+// If GradlePublishTask is set, the gradle task is executed instead
+func Deploy(conf config.MavenConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.MavenConfig, dryRun bool) error {
+	if conf.RepositoryURL == nil {
+		v := environ.Getenv(ctx, "MAVEN_REPOSITORY_URL")
+		conf.RepositoryURL = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.RepositoryURL)
+		conf.RepositoryURL = &v
+	}
+
+	if conf.Username == nil {
+		v := environ.Getenv(ctx, "MAVEN_USERNAME")
+		conf.Username = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Username)
+		conf.Username = &v
+	}
+
+	if conf.Password == nil {
+		v := environ.Getenv(ctx, "MAVEN_PASSWORD")
+		conf.Password = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Password)
+		conf.Password = &v
+	}
+
+	if conf.Directory == nil {
+		v := "."
+		conf.Directory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Directory)
+		conf.Directory = &v
+	}
+
+	if conf.GradlePublishTask == nil {
+		v := ""
+		conf.GradlePublishTask = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.GradlePublishTask)
+		conf.GradlePublishTask = &v
+	}
+
+	if *conf.GradlePublishTask != "" {
+		return gradlePublish(ctx, conf, dryRun)
+	}
+
+	project, err := readPom(*conf.Directory)
+	if err != nil {
+		return err
+	}
+	artifacts, err := findArtifacts(*conf.Directory, project)
+	if err != nil {
+		return err
+	}
+
+	baseURL := fmt.Sprintf("%s/%s/%s/%s", strings.TrimRight(*conf.RepositoryURL, "/"),
+		strings.Replace(project.GroupID, ".", "/", -1), project.ArtifactID, project.Version)
+
+	if dryRun {
+		for file, name := range artifacts {
+			log.Info(fmt.Sprintf("maven: would upload %s to %s/%s", file, baseURL, name))
+		}
+		return nil
+	}
+
+	client := httpclient.WithContext(ctx, &http.Client{Timeout: 10 * time.Minute})
+	for file, name := range artifacts {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		sha1sum := sha1.Sum(data)
+		md5sum := md5.Sum(data)
+
+		url := baseURL + "/" + name
+		log.With("file", file, "url", url).Debug("maven: uploading artifact")
+		if err = upload(client, conf, url, data); err != nil {
+			return err
+		}
+		if err = upload(client, conf, url+".sha1", []byte(hex.EncodeToString(sha1sum[:]))); err != nil {
+			return err
+		}
+		if err = upload(client, conf, url+".md5", []byte(hex.EncodeToString(md5sum[:]))); err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("maven: artifact successfully uploaded %s", name))
+	}
+
+	log.Info(fmt.Sprintf("maven: %s:%s:%s successfully published", project.GroupID, project.ArtifactID, project.Version))
+	return nil
+}
+
+// readPom reads the coordinates of the project from the .pom file of the directory, or its pom.xml
+func readPom(dir string) (pom, error) {
+	var ret pom
+
+	path := filepath.Join(dir, "pom.xml")
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.pom"))
+	if len(matches) != 0 {
+		path = matches[0]
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ret, fmt.Errorf("maven: reading the pom of %s: %s", dir, err.Error())
+	}
+	if err = xml.Unmarshal(data, &ret); err != nil {
+		return ret, fmt.Errorf("maven: parsing %s: %s", path, err.Error())
+	}
+
+	// the groupId and version may be inherited from the parent
+	if ret.GroupID == "" {
+		ret.GroupID = ret.Parent.GroupID
+	}
+	if ret.Version == "" {
+		ret.Version = ret.Parent.Version
+	}
+	if ret.GroupID == "" || ret.ArtifactID == "" || ret.Version == "" {
+		return ret, fmt.Errorf("maven: %s: groupId, artifactId and version are required", path)
+	}
+	return ret, nil
+}
+
+// findArtifacts returns the artifacts of the project in dir, by file, with their name in the repository.
+// If there is no .pom file, the pom.xml is uploaded as the pom of the project
+func findArtifacts(dir string, project pom) (map[string]string, error) {
+	ret := map[string]string{}
+	prefix := project.ArtifactID + "-" + project.Version
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	hasPom := false
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), prefix) {
+			continue
+		}
+		ext := filepath.Ext(file.Name())
+		for _, artifactExt := range extensions {
+			if ext == artifactExt {
+				ret[filepath.Join(dir, file.Name())] = file.Name()
+				hasPom = hasPom || ext == ".pom"
+			}
+		}
+	}
+
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("maven: no artifact %s found in %s", prefix, dir)
+	}
+	if !hasPom {
+		ret[filepath.Join(dir, "pom.xml")] = prefix + ".pom"
+	}
+	return ret, nil
+}
+
+// upload uploads data to url with a PUT request, authenticated with the username and password
+func upload(client *http.Client, conf config.MavenConfig, url string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("rocket/%s", version.Version))
+	if *conf.Username != "" || *conf.Password != "" {
+		req.SetBasicAuth(*conf.Username, *conf.Password)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return &httpclient.StatusError{StatusCode: res.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	return nil
+}
+
+// gradlePublish executes the gradle publish task in the directory, using the gradle wrapper if any.
+// The repository URL and credentials are passed as the mavenRepositoryUrl, mavenUsername and
+// mavenPassword project properties
+func gradlePublish(ctx context.Context, conf config.MavenConfig, dryRun bool) error {
+	gradle := "gradle"
+	if _, err := os.Stat(filepath.Join(*conf.Directory, "gradlew")); err == nil {
+		gradle = "./gradlew"
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("maven: would execute %s %s in %s", gradle, *conf.GradlePublishTask, *conf.Directory))
+		return nil
+	}
+
+	log.With("directory", *conf.Directory, "task", *conf.GradlePublishTask).Debug("maven: executing gradle")
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, gradle, *conf.GradlePublishTask)
+	cmd.Dir = *conf.Directory
+	cmd.Env = append(environ.Environ(ctx),
+		"ORG_GRADLE_PROJECT_mavenRepositoryUrl="+*conf.RepositoryURL,
+		"ORG_GRADLE_PROJECT_mavenUsername="+*conf.Username,
+		"ORG_GRADLE_PROJECT_mavenPassword="+*conf.Password,
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	err := cmd.Run()
+	if err != nil {
+		exitCode, _ := command.ExitCode(err)
+		return fmt.Errorf("maven: gradle %s failed with exit code %d: %s", *conf.GradlePublishTask, exitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	log.Info(fmt.Sprintf("maven: gradle %s succeeded", *conf.GradlePublishTask))
+	return nil
+}
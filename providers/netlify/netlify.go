@@ -0,0 +1,256 @@
+package netlify
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/bloom42/astroflow-go/log"
+	"github.com/z0mbie42/fswalk"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/filter"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/providers/tempfile"
+	"github.com/bloom42/rocket/version"
+)
+
+// Client is an wrapper to perform various task against the Netlify API
+type Client struct {
+	Token     string
+	SiteID    string
+	HTTP      *http.Client
+	UserAgent string
+}
+
+// SiteDeploy is the response to the https://api.netlify.com/api/v1/sites/:site_id/deploys API call
+type SiteDeploy struct {
+	ID           string `json:"id"`
+	State        string `json:"state"`
+	URL          string `json:"url"`
+	SSLURL       string `json:"ssl_url"`
+	DeployURL    string `json:"deploy_url"`
+	DeploySSLURL string `json:"deploy_ssl_url"`
+	AdminURL     string `json:"admin_url"`
+}
+
+func init() {
+	registry.Register("netlify", func(conf config.Config) registry.Provider {
+		if conf.Netlify == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.Netlify.Env, When: conf.Netlify.When, Timeout: conf.Netlify.Timeout}
+		return registry.New("netlify", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.Netlify, conf.DryRun)
+		})
+	})
+}
+
+// Deploy perform the Netlify deployment with the following steps:
+// zip the directory
+// upload the archive as a new deploy of the site
+func Deploy(conf config.NetlifyConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.NetlifyConfig, dryRun bool) error {
+	if conf.AccessToken == nil {
+		v := environ.Getenv(ctx, "NETLIFY_AUTH_TOKEN")
+		conf.AccessToken = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.AccessToken)
+		conf.AccessToken = &v
+	}
+
+	if conf.SiteID == nil {
+		v := environ.Getenv(ctx, "NETLIFY_SITE_ID")
+		conf.SiteID = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.SiteID)
+		conf.SiteID = &v
+	}
+
+	if conf.Directory == nil {
+		v := "."
+		conf.Directory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Directory)
+		conf.Directory = &v
+	}
+
+	if conf.Draft == nil {
+		v := false
+		conf.Draft = &v
+	}
+
+	if conf.Message == nil {
+		v := environ.Getenv(ctx, "ROCKET_COMMIT_MESSAGE")
+		conf.Message = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Message)
+		conf.Message = &v
+	}
+
+	if dryRun {
+		walker, _ := fswalk.NewWalker()
+		filesc, _ := walker.Walk(*conf.Directory)
+		for file := range filesc {
+			if file.Path == "." || file.IsDir || file.IsSymLink {
+				continue
+			}
+			if !filter.Match(conf.Include, conf.Exclude, *conf.Directory, file.Path) {
+				log.With("file", file.Path).Debug("netlify: file excluded")
+				continue
+			}
+			log.With("file", file.Path).Debug("netlify: would add file to archive")
+		}
+		log.Info(fmt.Sprintf("netlify: would deploy %s to site %s (draft: %t)", *conf.Directory, *conf.SiteID, *conf.Draft))
+		return nil
+	}
+
+	// create the archive
+	tmpFile, err := tempfile.File("", "rocket.*.zip")
+	if err != nil {
+		return err
+	}
+	defer tempfile.Remove(tmpFile.Name())
+	zw := zip.NewWriter(tmpFile)
+
+	walker, _ := fswalk.NewWalker()
+	filesc, _ := walker.Walk(*conf.Directory)
+	for file := range filesc {
+		if file.Path == "." || file.IsDir || file.IsSymLink {
+			continue
+		}
+		if !filter.Match(conf.Include, conf.Exclude, *conf.Directory, file.Path) {
+			log.With("file", file.Path).Debug("netlify: file excluded")
+			continue
+		}
+		log.With("archive", tmpFile.Name(), "file", file.Path).Debug("netlify: adding file to archive")
+		err = addFile(zw, *conf.Directory, file.Path)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = tmpFile.Close(); err != nil {
+		return err
+	}
+
+	// upload it
+	client := NewClient(*conf.AccessToken, *conf.SiteID)
+	client.HTTP = httpclient.WithContext(ctx, client.HTTP)
+	deploy, err := client.CreateDeploy(tmpFile.Name(), *conf.Draft, *conf.Message)
+	if err != nil {
+		return err
+	}
+	log.With("deploy_id", deploy.ID, "state", deploy.State).Info("netlify: deploy created")
+
+	if *conf.Draft {
+		log.Info(fmt.Sprintf("netlify: draft deploy available at %s", deploy.DeploySSLURL))
+	} else {
+		log.Info(fmt.Sprintf("netlify: site deployed at %s", deploy.SSLURL))
+	}
+	return nil
+}
+
+// NewClient create a Client instance with the given authentication information
+func NewClient(token, siteID string) Client {
+	return Client{token, siteID, &http.Client{}, fmt.Sprintf("rocket/%s", version.Version)}
+}
+
+// addFile add the file to the archive, with a path relative to the deployed directory
+func addFile(zw *zip.Writer, directory, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	name, err := filepath.Rel(directory, path)
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(stat)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(name)
+	header.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// CreateDeploy upload the zip archive as a new deploy of the site
+func (c *Client) CreateDeploy(archive string, draft bool, title string) (SiteDeploy, error) {
+	var ret SiteDeploy
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return ret, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return ret, err
+	}
+
+	query := url.Values{}
+	if draft {
+		query.Set("draft", "true")
+	}
+	if title != "" {
+		query.Set("title", title)
+	}
+	deployURL := fmt.Sprintf("https://api.netlify.com/api/v1/sites/%s/deploys?%s", url.PathEscape(c.SiteID), query.Encode())
+
+	req, err := http.NewRequest("POST", deployURL, file)
+	if err != nil {
+		return ret, err
+	}
+	req.ContentLength = stat.Size()
+	req.Header.Set("Content-Type", "application/zip")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.Token))
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return ret, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return ret, err
+	}
+	if resp.StatusCode >= 300 {
+		return ret, &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	err = json.Unmarshal(body, &ret)
+	return ret, err
+}
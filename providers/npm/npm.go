@@ -0,0 +1,147 @@
+package npm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/command"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/providers/tempfile"
+)
+
+func init() {
+	registry.Register("npm", func(conf config.Config) registry.Provider {
+		if conf.NPM == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.NPM.Env, When: conf.NPM.When, Timeout: conf.NPM.Timeout}
+		return registry.New("npm", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.NPM, conf.DryRun)
+		})
+	})
+}
+
+// Deploy publish the package of the directory with npm publish, authenticated by a temporary .npmrc
+func Deploy(conf config.NPMConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.NPMConfig, dryRun bool) error {
+	var err error
+
+	if conf.Token == nil {
+		v := environ.Getenv(ctx, "NPM_TOKEN")
+		conf.Token = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Token)
+		conf.Token = &v
+	}
+
+	if conf.Directory == nil {
+		v := "."
+		conf.Directory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Directory)
+		conf.Directory = &v
+	}
+
+	if conf.Access == nil {
+		v := ""
+		conf.Access = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Access)
+		conf.Access = &v
+	}
+
+	if conf.Tag == nil {
+		v := ""
+		conf.Tag = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Tag)
+		conf.Tag = &v
+	}
+
+	if conf.Registry == nil {
+		v := "https://registry.npmjs.org/"
+		conf.Registry = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Registry)
+		conf.Registry = &v
+	}
+
+	args := []string{"publish"}
+	if *conf.Access != "" {
+		args = append(args, "--access", *conf.Access)
+	}
+	if *conf.Tag != "" {
+		args = append(args, "--tag", *conf.Tag)
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("npm: would execute npm %s in %s to %s", strings.Join(args, " "), *conf.Directory, *conf.Registry))
+		return nil
+	}
+
+	npmrc, err := writeNpmrc(*conf.Registry, *conf.Token)
+	if err != nil {
+		return err
+	}
+	defer tempfile.Remove(npmrc)
+
+	log.With("directory", *conf.Directory, "args", args).Debug("npm: publishing")
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "npm", args...)
+	cmd.Dir = *conf.Directory
+	cmd.Env = append(environ.Environ(ctx), "NPM_CONFIG_USERCONFIG="+npmrc)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	err = cmd.Run()
+	if err != nil {
+		exitCode, _ := command.ExitCode(err)
+		return fmt.Errorf("npm: publish failed with exit code %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	log.Info(fmt.Sprintf("npm: package in %s successfully published", *conf.Directory))
+	return nil
+}
+
+// writeNpmrc writes a temporary .npmrc file with the registry and its auth token, and returns its path
+func writeNpmrc(registry, token string) (string, error) {
+	u, err := url.Parse(registry)
+	if err != nil {
+		return "", fmt.Errorf("npm: invalid registry %s: %s", registry, err.Error())
+	}
+	path := u.Path
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+
+	content := fmt.Sprintf("registry=%s\n//%s%s:_authToken=%s\n", registry, u.Host, path, token)
+
+	file, err := tempfile.File("", "rocket.npmrc")
+	if err != nil {
+		return "", err
+	}
+	if _, err = file.WriteString(content); err != nil {
+		file.Close()
+		tempfile.Remove(file.Name())
+		return "", err
+	}
+	if err = file.Close(); err != nil {
+		tempfile.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
@@ -0,0 +1,424 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/bloom42/astroflow-go/log"
+	"github.com/google/go-github/github"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/notify"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/providers/tempfile"
+
+	// the providers register themselves
+	_ "github.com/bloom42/rocket/providers/ansible"
+	_ "github.com/bloom42/rocket/providers/awseb"
+	_ "github.com/bloom42/rocket/providers/awss3"
+	_ "github.com/bloom42/rocket/providers/azureblob"
+	_ "github.com/bloom42/rocket/providers/cargo"
+	_ "github.com/bloom42/rocket/providers/cloudflare"
+	_ "github.com/bloom42/rocket/providers/docker"
+	_ "github.com/bloom42/rocket/providers/execplugin"
+	_ "github.com/bloom42/rocket/providers/firebase"
+	_ "github.com/bloom42/rocket/providers/fly"
+	_ "github.com/bloom42/rocket/providers/ftp"
+	_ "github.com/bloom42/rocket/providers/gcs"
+	_ "github.com/bloom42/rocket/providers/ghpages"
+	_ "github.com/bloom42/rocket/providers/ghreleases"
+	_ "github.com/bloom42/rocket/providers/glreleases"
+	_ "github.com/bloom42/rocket/providers/heroku"
+	_ "github.com/bloom42/rocket/providers/kubernetes"
+	_ "github.com/bloom42/rocket/providers/maven"
+	_ "github.com/bloom42/rocket/providers/netlify"
+	_ "github.com/bloom42/rocket/providers/npm"
+	_ "github.com/bloom42/rocket/providers/pypi"
+	_ "github.com/bloom42/rocket/providers/render"
+	_ "github.com/bloom42/rocket/providers/script"
+	_ "github.com/bloom42/rocket/providers/sentry"
+	_ "github.com/bloom42/rocket/providers/ssh"
+	_ "github.com/bloom42/rocket/providers/vercel"
+	_ "github.com/bloom42/rocket/providers/webhook"
+	_ "github.com/bloom42/rocket/providers/zeitnow"
+)
+
+// Errors aggregates the errors of all the failed providers, which are *ProviderError
+type Errors []error
+
+func (errs Errors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// provider is an enabled provider, ready to be deployed
+type provider struct {
+	name     string
+	env      map[string]string
+	when     *string
+	timeout  *string
+	validate func() error
+	deploy   func(ctx context.Context) error
+}
+
+// ProviderError is the error of a failed provider
+type ProviderError struct {
+	// Provider is the name of the provider, e.g: aws_s3 or aws_s3[1] for an additional instance
+	Provider string
+	Err      error
+	// Retryable is true if the error is a network or server error, which may not happen again
+	Retryable bool
+}
+
+func (err *ProviderError) Error() string {
+	// the timeouts already name their provider
+	if _, ok := err.Err.(*TimeoutError); ok {
+		return err.Err.Error()
+	}
+	return fmt.Sprintf("%s: %v", err.Provider, err.Err)
+}
+
+// Unwrap returns the underlying error
+func (err *ProviderError) Unwrap() error {
+	return err.Err
+}
+
+// newProviderError returns the ProviderError of the provider p failing with err
+func newProviderError(p provider, err error) *ProviderError {
+	return &ProviderError{Provider: p.name, Err: err, Retryable: isRetryable(err)}
+}
+
+// TimeoutError is returned when a provider did not finish before its timeout
+type TimeoutError struct {
+	Provider string
+	Timeout  time.Duration
+}
+
+func (err *TimeoutError) Error() string {
+	return fmt.Sprintf("%s: timed out after %s", err.Provider, err.Timeout)
+}
+
+// enabled returns the providers set in the configuration, from the registry
+func enabled(conf config.Config) []provider {
+	ret := []provider{}
+
+	for _, p := range registry.Enabled(conf) {
+		options := registry.OptionsOf(p)
+		ret = append(ret, provider{p.Name(), options.Env, options.When, options.Timeout, p.Validate, p.Run})
+	}
+
+	// the additional instances are named after their index, e.g: aws_s3[1]
+	for i, instance := range conf.Instances {
+		instance.DryRun = conf.DryRun
+		for _, p := range enabled(instance) {
+			p.name = fmt.Sprintf("%s[%d]", p.name, i+1)
+			ret = append(ret, p)
+		}
+	}
+
+	return ret
+}
+
+// Deploy runs all the providers set in the configuration, with at most conf.Concurrency
+// providers running at once (by default all of them).
+// If conf.DryRun is true, the providers only log the actions they would perform.
+// Providers failing because of a network or server error are retried conf.Retries times.
+// conf.BeforeHooks are executed before the providers, and a failing hook aborts the deployment.
+// Once all the providers succeeded, conf.HealthCheck is polled until the deployment is healthy.
+// conf.AfterHooks are executed only if all the providers succeeded, and the health check passed
+// The hooks and providers are executed in conf.WorkingDirectory if set, so the relative paths of
+// the providers are resolved against it
+// Providers whose when condition is false, or not selected by conf.Only and conf.Skip, are skipped.
+// The providers listed in conf.Order run first, one after the other, then the others run concurrently.
+// A failing provider of conf.Order stops the next ones, including the ones not listed
+// The env of a provider is layered on top of the process env only while the provider runs
+// Otherwise a failing provider does not stop the others: all the errors are returned as Errors of *ProviderError
+// With conf.Proxy, the requests of the providers and the commands they execute go through the proxy
+// With conf.GitHubDeployment, a GitHub deployment is created before and its status set to the result
+// A panicking provider fails with an error, and the temporary files of the providers are always removed
+// Once finished, the notifications of conf.Notify are sent with the result of the deployment
+func Deploy(conf config.Config) error {
+	_, err := DeployWithReport(conf)
+	return err
+}
+
+// DeployWithReport is Deploy, also returning the Report of the deployment: the status, duration and error
+// of each provider, and the overall result
+func DeployWithReport(conf config.Config) (Report, error) {
+	start := time.Now()
+	rec := &recorder{}
+	// the temporary files left by the providers, e.g. after a panic, are removed once finished
+	defer tempfile.Cleanup()
+	var err error
+	var deployment *githubDeployment
+	if conf.Proxy != nil {
+		err = setProxy(config.ExpandEnv(*conf.Proxy))
+	}
+	if err == nil && conf.GitHubDeployment != nil {
+		deployment, err = createGitHubDeployment(*conf.GitHubDeployment, conf.DryRun)
+	}
+	if err == nil {
+		err = deploy(conf, rec)
+		if deployment != nil {
+			deployment.finish(err)
+		}
+	}
+	if conf.Notify != nil {
+		notify.Send(*conf.Notify, err, conf.DryRun)
+	}
+	return rec.report(start, conf.DryRun, err), err
+}
+
+func deploy(conf config.Config, rec *recorder) error {
+	if conf.WorkingDirectory != nil {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		dir := config.ExpandEnv(*conf.WorkingDirectory)
+		log.Debug(fmt.Sprintf("changing working directory to %s", dir))
+		if err = os.Chdir(dir); err != nil {
+			return err
+		}
+		defer os.Chdir(wd)
+	}
+
+	log.Info(fmt.Sprintf("running: %s", strings.Join(conf.Providers(), ", ")))
+
+	providers := []provider{}
+	for _, p := range enabled(conf) {
+		if !conf.Selected(p.name) {
+			log.Info(fmt.Sprintf("%s: skipped, not selected", p.name))
+			rec.skip(p.name)
+			continue
+		}
+		if p.when != nil {
+			ok, err := config.EvalCondition(*p.when)
+			if err != nil {
+				err = newProviderError(p, err)
+				rec.record(p.name, time.Now(), err)
+				return err
+			}
+			if !ok {
+				log.Info(fmt.Sprintf("%s: skipped, when condition is false: %s", p.name, *p.when))
+				rec.skip(p.name)
+				continue
+			}
+		}
+		providers = append(providers, p)
+	}
+
+	concurrency := len(providers)
+	if conf.Concurrency != nil {
+		concurrency = *conf.Concurrency
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	retries := 0
+	if conf.Retries != nil {
+		retries = *conf.Retries
+	}
+
+	backoff := time.Second
+	if conf.RetryBackoff != nil {
+		var err error
+		backoff, err = time.ParseDuration(*conf.RetryBackoff)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the providers are validated before the deployment starts, as they may not come from a validated configuration
+	invalid := Errors{}
+	for _, p := range providers {
+		if err := p.validate(); err != nil {
+			err = newProviderError(p, err)
+			rec.record(p.name, time.Now(), err)
+			invalid = append(invalid, err)
+		}
+	}
+	if len(invalid) != 0 {
+		return invalid
+	}
+
+	err := runHooks("before", conf.BeforeHooks, conf.DryRun)
+	if err != nil {
+		return err
+	}
+
+	if errs := runProviders(providers, conf.Order, concurrency, retries, backoff, rec); len(errs) != 0 {
+		return errs
+	}
+
+	if conf.HealthCheck != nil {
+		if err = checkHealth(*conf.HealthCheck, conf.DryRun); err != nil {
+			return err
+		}
+	}
+
+	return runHooks("after", conf.AfterHooks, conf.DryRun)
+}
+
+// runProviders runs the providers listed in order first, one after the other, then the others with at
+// most concurrency of them running at once. As the others may depend on the output of the ordered ones,
+// a failing ordered provider stops all the next providers, which are recorded as skipped
+func runProviders(providers []provider, order []string, concurrency, retries int, backoff time.Duration, rec *recorder) Errors {
+	errs := Errors{}
+
+	ordered, others := orderProviders(providers, order)
+	for i, p := range ordered {
+		if err := runProvider(p, retries, backoff, rec); err != nil {
+			errs = append(errs, err)
+			skipped := append(append([]provider{}, ordered[i+1:]...), others...)
+			for _, next := range skipped {
+				log.Info(fmt.Sprintf("%s: skipped, %s failed", next.name, p.name))
+				rec.skip(next.name)
+			}
+			return errs
+		}
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	results := make([]error, len(others))
+
+	for i, p := range others {
+		wg.Add(1)
+		go func(i int, p provider) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = runProvider(p, retries, backoff, rec)
+		}(i, p)
+	}
+	wg.Wait()
+
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// orderProviders splits providers between the ones listed in order, sorted like it, and the others,
+// which keep their default order
+func orderProviders(providers []provider, order []string) (ordered, others []provider) {
+	byName := map[string]provider{}
+	for _, p := range providers {
+		byName[p.name] = p
+	}
+	listed := map[string]bool{}
+	for _, name := range order {
+		listed[name] = true
+		// a provider skipped because of its when condition is not there
+		if p, ok := byName[name]; ok {
+			ordered = append(ordered, p)
+		}
+	}
+	for _, p := range providers {
+		if !listed[p.name] {
+			others = append(others, p)
+		}
+	}
+	return ordered, others
+}
+
+// runProvider deploys the provider with its env, returning a *ProviderError if it fails.
+// Its result is recorded in rec
+func runProvider(p provider, retries int, backoff time.Duration, rec *recorder) error {
+	log.Debug(fmt.Sprintf("%s: starting provider", p.name))
+	start := time.Now()
+	err := func() (err error) {
+		// a panicking provider fails like the others, instead of stopping the deployment without cleanup
+		defer func() {
+			if r := recover(); r != nil {
+				log.Debug(string(debug.Stack()))
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		// the env of the provider is passed in its context, the environment of rocket is not modified
+		ctx, err := environ.With(context.Background(), p.env)
+		if err != nil {
+			return err
+		}
+		return deployWithTimeout(ctx, p, retries, backoff)
+	}()
+	if err != nil {
+		err = newProviderError(p, err)
+	}
+	rec.record(p.name, start, err)
+	return err
+}
+
+// deployWithTimeout deploy the provider with its retries, cancelling it and returning a *TimeoutError
+// if it does not finish before its timeout (if any)
+func deployWithTimeout(ctx context.Context, p provider, retries int, backoff time.Duration) error {
+	if p.timeout == nil {
+		return deployWithRetries(ctx, p, retries, backoff)
+	}
+
+	timeout, err := time.ParseDuration(environ.ExpandEnv(ctx, *p.timeout))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err = deployWithRetries(ctx, p, retries, backoff)
+	if ctx.Err() == context.DeadlineExceeded {
+		return &TimeoutError{p.name, timeout}
+	}
+	return err
+}
+
+// deployWithRetries deploy the provider, and retry up to retries times with an exponential backoff
+// if the error is retryable
+func deployWithRetries(ctx context.Context, p provider, retries int, backoff time.Duration) error {
+	err := p.deploy(ctx)
+	for attempt := 0; err != nil && attempt < retries && isRetryable(err); attempt++ {
+		wait := backoff << uint(attempt)
+		log.Info(fmt.Sprintf("%s: retrying in %s after error: %v", p.name, wait, err))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		err = p.deploy(ctx)
+	}
+	return err
+}
+
+// isRetryable returns true for the network errors and the server (5xx) errors.
+// Client errors (4xx, like authentication failures) are not retried
+func isRetryable(err error) bool {
+	switch e := err.(type) {
+	case *httpclient.StatusError:
+		return e.Temporary()
+	case *github.ErrorResponse:
+		return e.Response != nil && e.Response.StatusCode >= 500
+	case awserr.RequestFailure:
+		return e.StatusCode() >= 500
+	case awserr.Error:
+		// the requests which failed to be sent, e.g. because of a network error
+		return e.Code() == "RequestError"
+	case net.Error:
+		return true
+	}
+	return false
+}
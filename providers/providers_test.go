@@ -0,0 +1,217 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/providers/tempfile"
+)
+
+// testRuns are the deployments of the test providers registered below, which are enabled only if set
+var testRuns = map[string]func(ctx context.Context) error{}
+
+func init() {
+	for _, name := range []string{"test_failing", "test_panicking"} {
+		name := name
+		registry.Register(name, func(conf config.Config) registry.Provider {
+			run, ok := testRuns[name]
+			if !ok {
+				return nil
+			}
+			return registry.New(name, registry.Options{}, conf, run)
+		})
+	}
+}
+
+// fakeProvider returns a provider failing with err, recording its runs in ran
+func fakeProvider(name string, err error, ran *sync.Map) provider {
+	return provider{
+		name:     name,
+		validate: func() error { return nil },
+		deploy: func(ctx context.Context) error {
+			ran.Store(name, true)
+			return err
+		},
+	}
+}
+
+// statuses returns the status of each provider of the recorder, by name
+func statuses(rec *recorder) map[string]string {
+	ret := map[string]string{}
+	for _, p := range rec.report(time.Now(), false, nil).Providers {
+		ret[p.Provider] = p.Status
+	}
+	return ret
+}
+
+func TestRunProvidersOrdered(t *testing.T) {
+	tests := []struct {
+		name     string
+		failing  string
+		expected map[string]string
+	}{
+		{
+			name: "succeeded",
+			expected: map[string]string{
+				"docker": StatusSucceeded, "kubernetes": StatusSucceeded, "aws_s3": StatusSucceeded, "netlify": StatusSucceeded,
+			},
+		},
+		{
+			name:    "first ordered provider failed",
+			failing: "docker",
+			expected: map[string]string{
+				"docker": StatusFailed, "kubernetes": StatusSkipped, "aws_s3": StatusSkipped, "netlify": StatusSkipped,
+			},
+		},
+		{
+			name:    "last ordered provider failed",
+			failing: "kubernetes",
+			expected: map[string]string{
+				"docker": StatusSucceeded, "kubernetes": StatusFailed, "aws_s3": StatusSkipped, "netlify": StatusSkipped,
+			},
+		},
+		{
+			name:    "provider not listed failed",
+			failing: "aws_s3",
+			expected: map[string]string{
+				"docker": StatusSucceeded, "kubernetes": StatusSucceeded, "aws_s3": StatusFailed, "netlify": StatusSucceeded,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ran := &sync.Map{}
+			providers := []provider{}
+			for _, name := range []string{"aws_s3", "docker", "netlify", "kubernetes"} {
+				var err error
+				if name == test.failing {
+					err = errors.New("failed")
+				}
+				providers = append(providers, fakeProvider(name, err, ran))
+			}
+
+			rec := &recorder{}
+			errs := runProviders(providers, []string{"docker", "kubernetes"}, 2, 0, 0, rec)
+			if test.failing == "" && len(errs) != 0 {
+				t.Errorf("unexpected errors: %v", errs)
+			}
+			if test.failing != "" && len(errs) != 1 {
+				t.Errorf("expected 1 error, got %v", errs)
+			}
+
+			got := statuses(rec)
+			for name, status := range test.expected {
+				if got[name] != status {
+					t.Errorf("%s: status %q, expected %q", name, got[name], status)
+				}
+				if _, ok := ran.Load(name); ok != (status != StatusSkipped) {
+					t.Errorf("%s: ran = %v with status %q", name, ok, status)
+				}
+			}
+		})
+	}
+}
+
+func TestRunProvidersEnv(t *testing.T) {
+	// each provider waits for the other one, so they fail unless they run concurrently
+	var running sync.WaitGroup
+	running.Add(2)
+	got := sync.Map{}
+	envProvider := func(name string) provider {
+		return provider{
+			name:     name,
+			env:      map[string]string{"ROCKET_TEST_TARGET": name, "ROCKET_TEST_URL": "https://$ROCKET_TEST_TARGET"},
+			validate: func() error { return nil },
+			deploy: func(ctx context.Context) error {
+				running.Done()
+				done := make(chan struct{})
+				go func() {
+					running.Wait()
+					close(done)
+				}()
+				select {
+				case <-done:
+				case <-time.After(5 * time.Second):
+					return errors.New("the providers did not run concurrently")
+				}
+				if _, ok := os.LookupEnv("ROCKET_TEST_TARGET"); ok {
+					return errors.New("ROCKET_TEST_TARGET is set in the process environment")
+				}
+				got.Store(name, environ.Getenv(ctx, "ROCKET_TEST_URL"))
+				return nil
+			},
+		}
+	}
+
+	errs := runProviders([]provider{envProvider("staging"), envProvider("production")}, nil, 2, 0, 0, &recorder{})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	for _, name := range []string{"staging", "production"} {
+		if url, _ := got.Load(name); url != "https://"+name {
+			t.Errorf("%s: ROCKET_TEST_URL = %v, expected %q", name, url, "https://"+name)
+		}
+	}
+}
+
+func TestDeployRemovesTempFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rocket_providers_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the temporary files of the providers are created in dir
+	tmpdir := os.Getenv("TMPDIR")
+	os.Setenv("TMPDIR", dir)
+	defer os.Setenv("TMPDIR", tmpdir)
+
+	// both providers leave their temporary files behind
+	testRuns["test_failing"] = func(ctx context.Context) error {
+		file, err := tempfile.File("", "failing")
+		if err != nil {
+			return err
+		}
+		file.Close()
+		return errors.New("failed")
+	}
+	testRuns["test_panicking"] = func(ctx context.Context) error {
+		if _, err := tempfile.Dir("", "panicking"); err != nil {
+			return err
+		}
+		panic("panicked")
+	}
+	defer func() {
+		testRuns = map[string]func(ctx context.Context) error{}
+	}()
+
+	report, err := DeployWithReport(config.Config{})
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected the errors of the 2 providers, got %v", err)
+	}
+	if report.Status != StatusFailed {
+		t.Errorf("report status %q, expected %q", report.Status, StatusFailed)
+	}
+	for _, p := range report.Providers {
+		if p.Status != StatusFailed {
+			t.Errorf("%s: status %q, expected %q", p.Provider, p.Status, StatusFailed)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("temporary file left: %s", entry.Name())
+	}
+}
@@ -0,0 +1,24 @@
+package providers
+
+import (
+	"os"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/providers/httpclient"
+)
+
+// setProxy makes the HTTP clients of the providers, and the commands they execute, use the given proxy
+func setProxy(proxy string) error {
+	if err := httpclient.SetProxy(proxy); err != nil {
+		return err
+	}
+	for _, key := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+		if err := os.Setenv(key, proxy); err != nil {
+			return err
+		}
+	}
+	// the URL is not logged as it may contain credentials
+	log.Debug("using the proxy of the configuration")
+	return nil
+}
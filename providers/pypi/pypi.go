@@ -0,0 +1,270 @@
+package pypi
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/version"
+)
+
+// Client is an wrapper to perform various task against the PyPI legacy upload API
+type Client struct {
+	Username   string
+	Password   string
+	Repository string
+	HTTP       *http.Client
+	UserAgent  string
+}
+
+// Artifact is a distribution file (sdist or wheel) to upload
+type Artifact struct {
+	Path      string
+	Name      string
+	Version   string
+	FileType  string
+	PyVersion string
+}
+
+func init() {
+	registry.Register("pypi", func(conf config.Config) registry.Provider {
+		if conf.PyPI == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.PyPI.Env, When: conf.PyPI.When, Timeout: conf.PyPI.Timeout}
+		return registry.New("pypi", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.PyPI, conf.DryRun)
+		})
+	})
+}
+
+// Deploy upload the sdists and wheels of the directory to the repository
+func Deploy(conf config.PyPIConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.PyPIConfig, dryRun bool) error {
+	if conf.Username == nil {
+		v := environ.Getenv(ctx, "TWINE_USERNAME")
+		conf.Username = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Username)
+		conf.Username = &v
+	}
+
+	if conf.Password == nil {
+		v := environ.Getenv(ctx, "TWINE_PASSWORD")
+		conf.Password = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Password)
+		conf.Password = &v
+	}
+
+	if conf.Token == nil {
+		v := environ.Getenv(ctx, "PYPI_TOKEN")
+		conf.Token = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Token)
+		conf.Token = &v
+	}
+
+	if conf.Repository == nil {
+		v := environ.Getenv(ctx, "TWINE_REPOSITORY_URL")
+		if v == "" {
+			v = "https://upload.pypi.org/legacy/"
+		}
+		conf.Repository = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Repository)
+		conf.Repository = &v
+	}
+
+	if conf.Directory == nil {
+		v := "dist"
+		conf.Directory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Directory)
+		conf.Directory = &v
+	}
+
+	if conf.SkipExisting == nil {
+		v := false
+		conf.SkipExisting = &v
+	}
+
+	// API tokens are used as the password of the __token__ user
+	if *conf.Token != "" {
+		v := "__token__"
+		conf.Username = &v
+		conf.Password = conf.Token
+	}
+
+	artifacts, err := findArtifacts(*conf.Directory)
+	if err != nil {
+		return err
+	}
+	if len(artifacts) == 0 {
+		return fmt.Errorf("pypi: no sdist or wheel found in %s", *conf.Directory)
+	}
+
+	if dryRun {
+		for _, artifact := range artifacts {
+			log.Info(fmt.Sprintf("pypi: would upload %s to %s", artifact.Path, *conf.Repository))
+		}
+		return nil
+	}
+
+	client := NewClient(*conf.Username, *conf.Password, *conf.Repository)
+	client.HTTP = httpclient.WithContext(ctx, client.HTTP)
+	for _, artifact := range artifacts {
+		log.With("file", artifact.Path, "name", artifact.Name, "version", artifact.Version).Debug("pypi: uploading artifact")
+		err = client.Upload(artifact)
+		if err != nil {
+			if *conf.SkipExisting && isAlreadyExists(err) {
+				log.Info(fmt.Sprintf("pypi: %s already exists, skipping", artifact.Path))
+				continue
+			}
+			return err
+		}
+		log.Info(fmt.Sprintf("pypi: %s successfully uploaded", artifact.Path))
+	}
+
+	return nil
+}
+
+// NewClient create a Client instance with the given authentication information
+func NewClient(username, password, repository string) Client {
+	return Client{username, password, repository, &http.Client{}, fmt.Sprintf("rocket/%s", version.Version)}
+}
+
+// findArtifacts returns the sdists (.tar.gz, .zip) and wheels (.whl) of the directory
+func findArtifacts(directory string) ([]Artifact, error) {
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []Artifact{}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		artifact, ok := parseArtifact(filepath.Join(directory, file.Name()))
+		if ok {
+			ret = append(ret, artifact)
+		}
+	}
+	return ret, nil
+}
+
+// parseArtifact extracts the name and version of the package from the file name:
+// {name}-{version}-{python tag}-{abi tag}-{platform tag}.whl for wheels
+// {name}-{version}.tar.gz or {name}-{version}.zip for sdists
+func parseArtifact(path string) (Artifact, bool) {
+	base := filepath.Base(path)
+
+	switch {
+	case strings.HasSuffix(base, ".whl"):
+		parts := strings.Split(strings.TrimSuffix(base, ".whl"), "-")
+		if len(parts) < 5 {
+			return Artifact{}, false
+		}
+		return Artifact{path, parts[0], parts[1], "bdist_wheel", parts[len(parts)-3]}, true
+	case strings.HasSuffix(base, ".tar.gz"), strings.HasSuffix(base, ".zip"):
+		name := strings.TrimSuffix(strings.TrimSuffix(base, ".tar.gz"), ".zip")
+		i := strings.LastIndex(name, "-")
+		if i == -1 {
+			return Artifact{}, false
+		}
+		return Artifact{path, name[:i], name[i+1:], "sdist", "source"}, true
+	}
+	return Artifact{}, false
+}
+
+// isAlreadyExists returns true if the upload failed because the file already exists in the repository
+func isAlreadyExists(err error) bool {
+	statusErr, ok := err.(*httpclient.StatusError)
+	if !ok {
+		return false
+	}
+	// PyPI returns a 400, other repositories (pypiserver, Nexus, Artifactory...) a 409
+	return statusErr.StatusCode == http.StatusConflict ||
+		(statusErr.StatusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(statusErr.Body), "already exist"))
+}
+
+// Upload upload the artifact with the legacy upload API
+func (c *Client) Upload(artifact Artifact) error {
+	data, err := ioutil.ReadFile(artifact.Path)
+	if err != nil {
+		return err
+	}
+	md5Sum := md5.Sum(data)
+	sha256Sum := sha256.Sum256(data)
+
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	fields := [][2]string{
+		{":action", "file_upload"},
+		{"protocol_version", "1"},
+		{"metadata_version", "1.0"},
+		{"name", artifact.Name},
+		{"version", artifact.Version},
+		{"filetype", artifact.FileType},
+		{"pyversion", artifact.PyVersion},
+		{"md5_digest", hex.EncodeToString(md5Sum[:])},
+		{"sha256_digest", hex.EncodeToString(sha256Sum[:])},
+	}
+	for _, field := range fields {
+		if err = writer.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+	part, err := writer.CreateFormFile("content", filepath.Base(artifact.Path))
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(part, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.Repository, payload)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.Username, c.Password)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return &httpclient.StatusError{StatusCode: resp.StatusCode, Body: fmt.Sprintf("%s: %s", resp.Status, string(body))}
+	}
+	return nil
+}
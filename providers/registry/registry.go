@@ -0,0 +1,163 @@
+// Package registry holds the providers, which register themselves when their package is imported
+package registry
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bloom42/rocket/config"
+)
+
+// Provider is a deployment target, e.g: heroku
+type Provider interface {
+	Name() string
+	// Validate checks the configuration of the provider before the deployment
+	Validate() error
+	// Run performs the deployment, which is cancelled when ctx is done
+	Run(ctx context.Context) error
+}
+
+// Options are the settings common to the providers, applied by the runner
+type Options struct {
+	// Env is layered on top of the process env in the context of the provider, see the environ package
+	Env map[string]string
+	// When is the condition of the provider, it's skipped if false
+	When *string
+	// Timeout is the maximum duration of the provider
+	Timeout *string
+}
+
+// Configurable is implemented by the providers having Options
+type Configurable interface {
+	Options() Options
+}
+
+// Factory returns the provider set in conf, or nil if it's not set
+type Factory func(conf config.Config) Provider
+
+type entry struct {
+	name    string
+	factory Factory
+}
+
+var (
+	mu      sync.RWMutex
+	entries = []entry{}
+)
+
+// Register registers the factory of the provider named name. It panics if a provider is already
+// registered with this name
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, e := range entries {
+		if e.name == name {
+			panic("registry: provider " + name + " registered twice")
+		}
+	}
+	entries = append(entries, entry{name, factory})
+}
+
+// Names returns the names of the registered providers, in the order they run by default: the order
+// of the fields of config.Config, then the other providers in their registration order
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	ret := make([]string, len(entries))
+	for i, e := range sorted() {
+		ret[i] = e.name
+	}
+	return ret
+}
+
+// Enabled returns the providers set in conf, without its additional instances, in the order of Names
+func Enabled(conf config.Config) []Provider {
+	mu.RLock()
+	defer mu.RUnlock()
+	ret := []Provider{}
+	for _, e := range sorted() {
+		if p := e.factory(conf); p != nil {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// OptionsOf returns the Options of p, which are empty if it's not Configurable
+func OptionsOf(p Provider) Options {
+	if c, ok := p.(Configurable); ok {
+		return c.Options()
+	}
+	return Options{}
+}
+
+// sorted returns the entries in the order of Names. mu should be locked
+func sorted() []entry {
+	indexes := map[string]int{}
+	t := reflect.TypeOf(config.Config{})
+	for i := 0; i < t.NumField(); i++ {
+		indexes[strings.Split(t.Field(i).Tag.Get("san"), ",")[0]] = i
+	}
+
+	ret := make([]entry, len(entries))
+	copy(ret, entries)
+	sort.SliceStable(ret, func(i, j int) bool {
+		return index(indexes, ret[i].name, t.NumField()) < index(indexes, ret[j].name, t.NumField())
+	})
+	return ret
+}
+
+// index returns the index of the field of config.Config named name, or others for the providers
+// which are not part of config.Config
+func index(indexes map[string]int, name string, others int) int {
+	if i, ok := indexes[name]; ok {
+		return i
+	}
+	return others
+}
+
+// section is a Provider configured by a section of config.Config
+type section struct {
+	name    string
+	options Options
+	conf    config.Config
+	run     func(ctx context.Context) error
+}
+
+// New returns a Provider configured by the section name of conf, deployed by run. It is validated
+// by the validation of conf, limited to the fields of the section
+func New(name string, options Options, conf config.Config, run func(ctx context.Context) error) Provider {
+	return section{name, options, conf, run}
+}
+
+func (s section) Name() string {
+	return s.name
+}
+
+func (s section) Options() Options {
+	return s.options
+}
+
+func (s section) Run(ctx context.Context) error {
+	return s.run(ctx)
+}
+
+func (s section) Validate() error {
+	validationErr, ok := s.conf.Validate().(*config.ValidationError)
+	if !ok {
+		return nil
+	}
+	errs := []config.FieldError{}
+	for _, fieldErr := range validationErr.Errors {
+		if fieldErr.Field == s.name || strings.HasPrefix(fieldErr.Field, s.name+".") {
+			errs = append(errs, fieldErr)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &config.ValidationError{Errors: errs}
+}
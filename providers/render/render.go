@@ -0,0 +1,182 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/version"
+)
+
+// pollInterval is the interval between two checks of the status of a deploy
+const pollInterval = 5 * time.Second
+
+// Client is an wrapper to perform various task against the Render API
+type Client struct {
+	APIKey    string
+	ServiceID string
+	HTTP      *http.Client
+	UserAgent string
+}
+
+// ServiceDeploy is a deploy of a service, returned by the https://api.render.com/v1/services/:service_id/deploys API calls
+type ServiceDeploy struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+func init() {
+	registry.Register("render", func(conf config.Config) registry.Provider {
+		if conf.Render == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.Render.Env, When: conf.Render.When, Timeout: conf.Render.Timeout}
+		return registry.New("render", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.Render, conf.DryRun)
+		})
+	})
+}
+
+// Deploy triggers a deploy of the Render service and waits for it to succeed or fail
+func Deploy(conf config.RenderConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.RenderConfig, dryRun bool) error {
+	if conf.APIKey == nil {
+		v := environ.Getenv(ctx, "RENDER_API_KEY")
+		conf.APIKey = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.APIKey)
+		conf.APIKey = &v
+	}
+
+	if conf.ServiceID == nil {
+		v := environ.Getenv(ctx, "RENDER_SERVICE_ID")
+		conf.ServiceID = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.ServiceID)
+		conf.ServiceID = &v
+	}
+
+	if conf.ClearCache == nil {
+		v := false
+		conf.ClearCache = &v
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("render: would deploy service %s (clear cache: %t)", *conf.ServiceID, *conf.ClearCache))
+		return nil
+	}
+
+	client := NewClient(*conf.APIKey, *conf.ServiceID)
+	client.HTTP = httpclient.WithContext(ctx, client.HTTP)
+
+	deploy, err := client.CreateDeploy(*conf.ClearCache)
+	if err != nil {
+		return err
+	}
+	log.With("deploy_id", deploy.ID, "status", deploy.Status).Info("render: deploy created")
+
+	for !finished(deploy.Status) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+		status := deploy.Status
+		deploy, err = client.GetDeploy(deploy.ID)
+		if err != nil {
+			return err
+		}
+		if deploy.Status != status {
+			log.With("deploy_id", deploy.ID, "status", deploy.Status).Debug("render: deploy status changed")
+		}
+	}
+
+	if deploy.Status != "live" {
+		return fmt.Errorf("render: deploy %s failed with status %s", deploy.ID, deploy.Status)
+	}
+	log.Info(fmt.Sprintf("render: deploy %s of service %s is live", deploy.ID, *conf.ServiceID))
+	return nil
+}
+
+// finished returns true if the deploy status is final
+func finished(status string) bool {
+	switch status {
+	case "live", "deactivated", "build_failed", "update_failed", "pre_deploy_failed", "canceled":
+		return true
+	}
+	return false
+}
+
+// NewClient create a Client instance with the given authentication information
+func NewClient(apiKey, serviceID string) Client {
+	return Client{apiKey, serviceID, &http.Client{Timeout: 60 * time.Second}, fmt.Sprintf("rocket/%s", version.Version)}
+}
+
+// CreateDeploy triggers a new deploy of the service
+func (c *Client) CreateDeploy(clearCache bool) (ServiceDeploy, error) {
+	var ret ServiceDeploy
+
+	payload := map[string]string{"clearCache": "do_not_clear"}
+	if clearCache {
+		payload["clearCache"] = "clear"
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return ret, err
+	}
+
+	err = c.request("POST", fmt.Sprintf("/services/%s/deploys", url.PathEscape(c.ServiceID)), bytes.NewReader(data), &ret)
+	return ret, err
+}
+
+// GetDeploy returns the deploy of the service with the given ID
+func (c *Client) GetDeploy(id string) (ServiceDeploy, error) {
+	var ret ServiceDeploy
+	err := c.request("GET", fmt.Sprintf("/services/%s/deploys/%s", url.PathEscape(c.ServiceID), url.PathEscape(id)), nil, &ret)
+	return ret, err
+}
+
+// request sends an authenticated request to the Render API and decodes the JSON response into ret
+func (c *Client) request(method, path string, body io.Reader, ret interface{}) error {
+	req, err := http.NewRequest(method, "https://api.render.com/v1"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+
+	return json.Unmarshal(data, ret)
+}
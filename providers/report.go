@@ -0,0 +1,81 @@
+package providers
+
+import (
+	"sync"
+	"time"
+)
+
+// the statuses of the providers and of the deployment in a Report
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+// Report summarizes a deployment, for machine consumption (e.g. with the json_output option)
+type Report struct {
+	// Status is StatusSucceeded or StatusFailed
+	Status     string           `json:"status"`
+	DryRun     bool             `json:"dry_run"`
+	DurationMs int64            `json:"duration_ms"`
+	Providers  []ProviderReport `json:"providers"`
+	// Error is the error of the deployment, if it failed
+	Error string `json:"error,omitempty"`
+}
+
+// ProviderReport is the result of a provider in a Report
+type ProviderReport struct {
+	Provider   string `json:"provider"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// recorder collects the results of the providers, which may run concurrently
+type recorder struct {
+	mutex     sync.Mutex
+	providers []ProviderReport
+}
+
+// record adds the result of the provider which started at start and returned err
+func (r *recorder) record(name string, start time.Time, err error) {
+	report := ProviderReport{Provider: name, Status: StatusSucceeded, DurationMs: milliseconds(time.Since(start))}
+	if err != nil {
+		report.Status = StatusFailed
+		report.Error = err.Error()
+	}
+	r.add(report)
+}
+
+// skip adds a provider which did not run
+func (r *recorder) skip(name string) {
+	r.add(ProviderReport{Provider: name, Status: StatusSkipped})
+}
+
+func (r *recorder) add(report ProviderReport) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.providers = append(r.providers, report)
+}
+
+// report returns the Report of the deployment which started at start and returned err
+func (r *recorder) report(start time.Time, dryRun bool, err error) Report {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ret := Report{
+		Status:     StatusSucceeded,
+		DryRun:     dryRun,
+		DurationMs: milliseconds(time.Since(start)),
+		Providers:  append([]ProviderReport{}, r.providers...),
+	}
+	if err != nil {
+		ret.Status = StatusFailed
+		ret.Error = err.Error()
+	}
+	return ret
+}
+
+func milliseconds(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
@@ -1,23 +1,46 @@
 package script
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 
-	"github.com/bloom42/rocket/config"
 	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/registry"
 )
 
+func init() {
+	registry.Register("script", func(conf config.Config) registry.Provider {
+		if conf.Script == nil {
+			return nil
+		}
+		return registry.New("script", registry.Options{}, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, conf.Script, conf.DryRun)
+		})
+	})
+}
+
 // Deploy deploy the script part of the configuration
 // It sequentially execute all the given scripts
-func Deploy(conf config.ScriptConfig) error {
+func Deploy(conf config.ScriptConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.ScriptConfig, dryRun bool) error {
 	for _, script := range conf {
 		var err error
 
 		script = config.ExpandEnv(script)
-		cmd := exec.Command("sh", "-c", script)
+		if dryRun {
+			log.Info(fmt.Sprintf("script: would execute %s", script))
+			continue
+		}
+		cmd := exec.CommandContext(ctx, "sh", "-c", script)
 
 		stdout, err := cmd.StdoutPipe()
 		if err != nil {
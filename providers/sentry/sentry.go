@@ -0,0 +1,280 @@
+package sentry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bloom42/astroflow-go/log"
+	"github.com/z0mbie42/fswalk"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/version"
+)
+
+// Client is an wrapper to perform various task against the Sentry API
+type Client struct {
+	AuthToken string
+	Org       string
+	HTTP      *http.Client
+	UserAgent string
+}
+
+// Release is a release of an organization, returned by the https://sentry.io/api/0/organizations/:org/releases/ API calls
+type Release struct {
+	Version      string     `json:"version"`
+	Projects     []string   `json:"projects,omitempty"`
+	DateReleased *time.Time `json:"dateReleased,omitempty"`
+}
+
+func init() {
+	registry.Register("sentry", func(conf config.Config) registry.Provider {
+		if conf.Sentry == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.Sentry.Env, When: conf.Sentry.When, Timeout: conf.Sentry.Timeout}
+		return registry.New("sentry", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.Sentry, conf.DryRun)
+		})
+	})
+}
+
+// Deploy perform the Sentry release, following the below steps:
+// create the release for the project
+// upload the minified files and the source maps of conf.SourceMapsDir
+// finalize the release
+func Deploy(conf config.SentryConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.SentryConfig, dryRun bool) error {
+	if conf.AuthToken == nil {
+		v := environ.Getenv(ctx, "SENTRY_AUTH_TOKEN")
+		conf.AuthToken = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.AuthToken)
+		conf.AuthToken = &v
+	}
+
+	if conf.Org == nil {
+		v := environ.Getenv(ctx, "SENTRY_ORG")
+		conf.Org = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Org)
+		conf.Org = &v
+	}
+
+	if conf.Project == nil {
+		v := environ.Getenv(ctx, "SENTRY_PROJECT")
+		conf.Project = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Project)
+		conf.Project = &v
+	}
+
+	if conf.Release == nil {
+		v := environ.Getenv(ctx, "ROCKET_COMMIT_HASH")
+		conf.Release = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Release)
+		conf.Release = &v
+	}
+
+	if conf.SourceMapsDir == nil {
+		v := ""
+		conf.SourceMapsDir = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.SourceMapsDir)
+		conf.SourceMapsDir = &v
+	}
+
+	if conf.URLPrefix == nil {
+		v := "~/"
+		conf.URLPrefix = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.URLPrefix)
+		conf.URLPrefix = &v
+	}
+
+	files := []string{}
+	if *conf.SourceMapsDir != "" {
+		walker, _ := fswalk.NewWalker()
+		filesc, err := walker.Walk(*conf.SourceMapsDir)
+		if err != nil {
+			return err
+		}
+		for file := range filesc {
+			if file.IsDir || file.IsSymLink || !isSourceFile(file.Path) {
+				continue
+			}
+			files = append(files, file.Path)
+		}
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("sentry: would create the release %s of project %s", *conf.Release, *conf.Project))
+		for _, file := range files {
+			log.Info(fmt.Sprintf("sentry: would upload %s as %s", file, fileName(conf, file)))
+		}
+		log.Info(fmt.Sprintf("sentry: would finalize the release %s", *conf.Release))
+		return nil
+	}
+
+	client := NewClient(*conf.AuthToken, *conf.Org)
+	client.HTTP = httpclient.WithContext(ctx, client.HTTP)
+
+	release, err := client.CreateRelease(*conf.Release, *conf.Project)
+	if err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("sentry: release %s created", release.Version))
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		name := fileName(conf, file)
+		uploaded, err := client.UploadFile(*conf.Project, release.Version, file, name)
+		if err != nil {
+			return err
+		}
+		if uploaded {
+			log.Info(fmt.Sprintf("sentry: file successfully uploaded %s", name))
+		} else {
+			log.With("file", file).Debug(fmt.Sprintf("sentry: %s already uploaded", name))
+		}
+	}
+
+	if err = client.FinalizeRelease(release.Version); err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("sentry: release %s finalized with %d file(s)", release.Version, len(files)))
+	return nil
+}
+
+// isSourceFile returns true if the file is a minified file or a source map
+func isSourceFile(filePath string) bool {
+	switch filepath.Ext(filePath) {
+	case ".js", ".mjs", ".map":
+		return true
+	}
+	return false
+}
+
+// fileName returns the name of the file in the release: its path relative to the source maps
+// directory, prefixed by the URL prefix (e.g: ~/static/js/app.js)
+func fileName(conf config.SentryConfig, filePath string) string {
+	rel, err := filepath.Rel(*conf.SourceMapsDir, filePath)
+	if err != nil {
+		rel = filepath.Base(filePath)
+	}
+	return strings.TrimSuffix(*conf.URLPrefix, "/") + "/" + path.Clean(filepath.ToSlash(rel))
+}
+
+// NewClient create a Client instance with the given authentication information
+func NewClient(authToken, org string) Client {
+	return Client{authToken, org, &http.Client{Timeout: 60 * time.Second}, fmt.Sprintf("rocket/%s", version.Version)}
+}
+
+// CreateRelease creates the release of the project, or returns it if it already exists
+func (c *Client) CreateRelease(version, project string) (Release, error) {
+	var ret Release
+
+	data, err := json.Marshal(Release{Version: version, Projects: []string{project}})
+	if err != nil {
+		return ret, err
+	}
+
+	err = c.request("POST", fmt.Sprintf("/organizations/%s/releases/", url.PathEscape(c.Org)), "application/json", bytes.NewReader(data), &ret)
+	return ret, err
+}
+
+// UploadFile uploads the file as an artifact of the release, with the given name. It returns false if the
+// release already has a file with this name
+func (c *Client) UploadFile(project, version, filePath, name string) (bool, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err = writer.WriteField("name", name); err != nil {
+		return false, err
+	}
+	part, err := writer.CreateFormFile("file", filepath.Base(filePath))
+	if err != nil {
+		return false, err
+	}
+	if _, err = io.Copy(part, file); err != nil {
+		return false, err
+	}
+	if err = writer.Close(); err != nil {
+		return false, err
+	}
+
+	err = c.request("POST", fmt.Sprintf("/projects/%s/%s/releases/%s/files/", url.PathEscape(c.Org), url.PathEscape(project), url.PathEscape(version)), writer.FormDataContentType(), &body, nil)
+	// 409 Conflict is returned when a file with the same name was already uploaded
+	if statusErr, ok := err.(*httpclient.StatusError); ok && statusErr.StatusCode == http.StatusConflict {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// FinalizeRelease sets the release date of the release, which marks it as released
+func (c *Client) FinalizeRelease(version string) error {
+	now := time.Now().UTC()
+	data, err := json.Marshal(map[string]interface{}{"dateReleased": now})
+	if err != nil {
+		return err
+	}
+	return c.request("PUT", fmt.Sprintf("/organizations/%s/releases/%s/", url.PathEscape(c.Org), url.PathEscape(version)), "application/json", bytes.NewReader(data), nil)
+}
+
+// request sends an authenticated request to the Sentry API and decodes the JSON response into ret, if not nil
+func (c *Client) request(method, path, contentType string, body io.Reader, ret interface{}) error {
+	req, err := http.NewRequest(method, "https://sentry.io/api/0"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.AuthToken))
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+
+	if ret == nil {
+		return nil
+	}
+	return json.Unmarshal(data, ret)
+}
@@ -0,0 +1,242 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/command"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/providers/tempfile"
+)
+
+func init() {
+	registry.Register("ssh", func(conf config.Config) registry.Provider {
+		if conf.SSH == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.SSH.Env, When: conf.SSH.When, Timeout: conf.SSH.Timeout}
+		return registry.New("ssh", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.SSH, conf.DryRun)
+		})
+	})
+}
+
+// Deploy copy the local directory to the remote directory over SSH (with rsync if available, scp otherwise)
+// then sequentially execute the remote commands
+func Deploy(conf config.SSHConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.SSHConfig, dryRun bool) error {
+	var err error
+
+	if conf.Host == nil {
+		v := environ.Getenv(ctx, "SSH_HOST")
+		conf.Host = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Host)
+		conf.Host = &v
+	}
+
+	if conf.Port == nil {
+		v := 22
+		conf.Port = &v
+	}
+
+	if conf.User == nil {
+		v := environ.Getenv(ctx, "SSH_USER")
+		conf.User = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.User)
+		conf.User = &v
+	}
+
+	if conf.PrivateKeyPath == nil {
+		v := ""
+		conf.PrivateKeyPath = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.PrivateKeyPath)
+		conf.PrivateKeyPath = &v
+	}
+
+	if conf.PrivateKey == nil {
+		v := environ.Getenv(ctx, "SSH_PRIVATE_KEY")
+		conf.PrivateKey = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.PrivateKey)
+		conf.PrivateKey = &v
+	}
+
+	if conf.LocalDirectory == nil {
+		v := "."
+		conf.LocalDirectory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.LocalDirectory)
+		conf.LocalDirectory = &v
+	}
+
+	if conf.RemoteDirectory == nil {
+		v := "."
+		conf.RemoteDirectory = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.RemoteDirectory)
+		conf.RemoteDirectory = &v
+	}
+
+	if conf.Commands == nil {
+		conf.Commands = []string{}
+	}
+
+	fileMode, err := parseMode(ctx, conf.FileMode)
+	if err != nil {
+		return fmt.Errorf("ssh: file_mode: %s", err.Error())
+	}
+	dirMode, err := parseMode(ctx, conf.DirMode)
+	if err != nil {
+		return fmt.Errorf("ssh: dir_mode: %s", err.Error())
+	}
+
+	destination := *conf.Host
+	if *conf.User != "" {
+		destination = *conf.User + "@" + destination
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("ssh: would copy %s to %s:%s", *conf.LocalDirectory, destination, *conf.RemoteDirectory))
+		for _, command := range conf.Commands {
+			log.Info(fmt.Sprintf("ssh: would execute %s", environ.ExpandEnv(ctx, command)))
+		}
+		return nil
+	}
+
+	// an inline key is written to a temporary file as ssh only reads keys from files
+	keyPath := *conf.PrivateKeyPath
+	if keyPath == "" && *conf.PrivateKey != "" {
+		keyFile, err := tempfile.File("", "rocket_ssh_key")
+		if err != nil {
+			return err
+		}
+		defer tempfile.Remove(keyFile.Name())
+		key := strings.TrimSpace(*conf.PrivateKey) + "\n"
+		if _, err = keyFile.WriteString(key); err != nil {
+			keyFile.Close()
+			return err
+		}
+		if err = keyFile.Close(); err != nil {
+			return err
+		}
+		keyPath = keyFile.Name()
+	}
+
+	sshOptions := []string{"-o", "BatchMode=yes"}
+	if keyPath != "" {
+		sshOptions = append(sshOptions, "-i", keyPath, "-o", "IdentitiesOnly=yes")
+	}
+	port := strconv.Itoa(*conf.Port)
+	sshArgs := append([]string{"-p", port}, sshOptions...)
+
+	err = run(ctx, "ssh", append(sshArgs, destination, fmt.Sprintf("mkdir -p '%s'", *conf.RemoteDirectory))...)
+	if err != nil {
+		return err
+	}
+
+	source := strings.TrimSuffix(*conf.LocalDirectory, "/") + "/"
+	target := fmt.Sprintf("%s:%s/", destination, strings.TrimSuffix(*conf.RemoteDirectory, "/"))
+	if _, lookErr := exec.LookPath("rsync"); lookErr == nil {
+		sshCommand := "ssh " + strings.Join(sshArgs, " ")
+		rsyncArgs := []string{"-az", "-e", sshCommand}
+		if chmod := rsyncChmod(fileMode, dirMode); chmod != "" {
+			rsyncArgs = append(rsyncArgs, "--chmod="+chmod)
+		}
+		err = run(ctx, "rsync", append(rsyncArgs, source, target)...)
+	} else {
+		log.Debug("ssh: rsync not found, falling back to scp")
+		scpArgs := append([]string{"-r", "-P", port}, sshOptions...)
+		err = run(ctx, "scp", append(scpArgs, source+".", target)...)
+		// scp keeps the local permissions, so the modes are applied once copied
+		if err == nil && (fileMode != nil || dirMode != nil) {
+			err = run(ctx, "ssh", append(sshArgs, destination, chmodCommand(*conf.RemoteDirectory, fileMode, dirMode))...)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("ssh: %s successfully copied to %s:%s", *conf.LocalDirectory, destination, *conf.RemoteDirectory))
+
+	for _, command := range conf.Commands {
+		command = environ.ExpandEnv(ctx, command)
+		err = run(ctx, "ssh", append(sshArgs, destination, command)...)
+		if err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("ssh: %s successfully executed", command))
+	}
+
+	return nil
+}
+
+// parseMode parses the octal file mode, if set
+func parseMode(ctx context.Context, value *string) (*os.FileMode, error) {
+	if value == nil {
+		return nil, nil
+	}
+	mode, err := config.ParseFileMode(environ.ExpandEnv(ctx, *value))
+	if err != nil {
+		return nil, err
+	}
+	return &mode, nil
+}
+
+// rsyncChmod returns the value of the --chmod option of rsync applying the modes, e.g: D0755,F0644
+func rsyncChmod(fileMode, dirMode *os.FileMode) string {
+	modes := []string{}
+	if dirMode != nil {
+		modes = append(modes, fmt.Sprintf("D%04o", dirMode.Perm()))
+	}
+	if fileMode != nil {
+		modes = append(modes, fmt.Sprintf("F%04o", fileMode.Perm()))
+	}
+	return strings.Join(modes, ",")
+}
+
+// chmodCommand returns the remote command applying the modes to the files and directories of dir
+func chmodCommand(dir string, fileMode, dirMode *os.FileMode) string {
+	commands := []string{}
+	if dirMode != nil {
+		commands = append(commands, fmt.Sprintf("find '%s' -type d -exec chmod %04o {} +", dir, dirMode.Perm()))
+	}
+	if fileMode != nil {
+		commands = append(commands, fmt.Sprintf("find '%s' -type f -exec chmod %04o {} +", dir, fileMode.Perm()))
+	}
+	return strings.Join(commands, " && ")
+}
+
+// run execute the given command. The returned error contains the exit code and the stderr output
+// of the command if it fails
+func run(ctx context.Context, name string, args ...string) error {
+	log.With("args", args).Debug(fmt.Sprintf("ssh: executing %s", name))
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = environ.Environ(ctx)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	err := cmd.Run()
+	if err != nil {
+		exitCode, _ := command.ExitCode(err)
+		return fmt.Errorf("ssh: %s failed with exit code %d: %s", name, exitCode, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
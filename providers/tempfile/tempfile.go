@@ -0,0 +1,65 @@
+package tempfile
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/bloom42/astroflow-go/log"
+)
+
+var (
+	mu sync.Mutex
+	// paths are the temporary files and directories not removed yet
+	paths = map[string]bool{}
+)
+
+// File creates a temporary file like ioutil.TempFile, and registers it so it's removed by Cleanup
+// if it's not removed before
+func File(dir, pattern string) (*os.File, error) {
+	file, err := ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	register(file.Name())
+	return file, nil
+}
+
+// Dir creates a temporary directory like ioutil.TempDir, and registers it so it's removed by Cleanup
+// if it's not removed before
+func Dir(dir, prefix string) (string, error) {
+	path, err := ioutil.TempDir(dir, prefix)
+	if err != nil {
+		return "", err
+	}
+	register(path)
+	return path, nil
+}
+
+// Remove removes the temporary file or directory, with its content, and unregisters it
+func Remove(path string) error {
+	mu.Lock()
+	delete(paths, path)
+	mu.Unlock()
+	return os.RemoveAll(path)
+}
+
+// Cleanup removes all the temporary files and directories not removed yet, e.g. because the provider
+// which created them panicked. Failures are only logged
+func Cleanup() {
+	mu.Lock()
+	defer mu.Unlock()
+	for path := range paths {
+		log.With("path", path).Debug("removing temporary file")
+		if err := os.RemoveAll(path); err != nil {
+			log.Warn(err.Error())
+		}
+		delete(paths, path)
+	}
+}
+
+func register(path string) {
+	mu.Lock()
+	paths[path] = true
+	mu.Unlock()
+}
@@ -0,0 +1,98 @@
+package tempfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// registered returns true if path is registered to be removed by Cleanup
+func registered(path string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return paths[path]
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestRegistration(t *testing.T) {
+	base, err := ioutil.TempDir("", "rocket_tempfile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	file, err := File(base, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	dir, err := Dir(base, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{file.Name(), dir} {
+		if !registered(path) {
+			t.Errorf("%s is not registered", path)
+		}
+	}
+
+	if err = Remove(file.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if registered(file.Name()) || exists(file.Name()) {
+		t.Errorf("%s is still registered or exists after Remove", file.Name())
+	}
+	if !registered(dir) {
+		t.Errorf("%s is no longer registered after the removal of another file", dir)
+	}
+
+	Cleanup()
+}
+
+func TestCleanup(t *testing.T) {
+	base, err := ioutil.TempDir("", "rocket_tempfile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	file, err := File(base, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	dir, err := Dir(base, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the content of the directories is removed with them
+	if err = ioutil.WriteFile(filepath.Join(dir, "content"), []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	Cleanup()
+
+	for _, path := range []string{file.Name(), dir} {
+		if registered(path) || exists(path) {
+			t.Errorf("%s is still registered or exists after Cleanup", path)
+		}
+	}
+	entries, err := ioutil.ReadDir(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("%d file(s) left in %s after Cleanup", len(entries), base)
+	}
+
+	// removing an already removed file is not an error
+	if err = Remove(dir); err != nil {
+		t.Errorf("Remove after Cleanup: %s", err.Error())
+	}
+}
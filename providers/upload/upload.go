@@ -0,0 +1,23 @@
+package upload
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Error returns an error of the provider listing the files which failed to upload with their error,
+// sorted by file
+func Error(provider string, failed map[string]error) error {
+	files := make([]string, 0, len(failed))
+	for file := range failed {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	messages := make([]string, len(files))
+	for i, file := range files {
+		messages[i] = fmt.Sprintf("%s: %s", file, failed[file].Error())
+	}
+	return fmt.Errorf("%s: %d file(s) failed to upload: %s", provider, len(files), strings.Join(messages, ", "))
+}
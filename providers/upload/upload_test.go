@@ -0,0 +1,17 @@
+package upload
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	failed := map[string]error{
+		"public/b.css": errors.New("timeout"),
+		"public/a.js":  errors.New("403 Forbidden"),
+	}
+	expected := "gcs: 2 file(s) failed to upload: public/a.js: 403 Forbidden, public/b.css: timeout"
+	if err := Error("gcs", failed); err.Error() != expected {
+		t.Errorf("Error() = %q, expected %q", err.Error(), expected)
+	}
+}
@@ -0,0 +1,178 @@
+package vercel
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/command"
+	"github.com/bloom42/rocket/providers/registry"
+)
+
+func init() {
+	registry.Register("vercel", func(conf config.Config) registry.Provider {
+		if conf.Vercel == nil {
+			return nil
+		}
+		options := registry.Options{Env: nil, When: conf.Vercel.When, Timeout: conf.Vercel.Timeout}
+		return registry.New("vercel", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.Vercel, conf.DryRun)
+		})
+	})
+}
+
+// Deploy perform the Vercel deployment with the vercel CLI, following the below steps:
+// link the directory to the project
+// deploy it as a preview or production deployment
+// alias the deployment to the domains of conf.Alias
+func Deploy(conf config.VercelConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.VercelConfig, dryRun bool) error {
+	var err error
+
+	if conf.Token == nil {
+		v := os.Getenv("VERCEL_TOKEN")
+		conf.Token = &v
+	} else {
+		v := config.ExpandEnv(*conf.Token)
+		conf.Token = &v
+	}
+
+	if conf.Directory == nil {
+		v := "."
+		conf.Directory = &v
+	} else {
+		v := config.ExpandEnv(*conf.Directory)
+		conf.Directory = &v
+	}
+
+	if conf.ProjectName == nil {
+		v := ""
+		conf.ProjectName = &v
+	} else {
+		v := config.ExpandEnv(*conf.ProjectName)
+		conf.ProjectName = &v
+	}
+
+	if conf.OrgID == nil {
+		v := os.Getenv("VERCEL_ORG_ID")
+		conf.OrgID = &v
+	} else {
+		v := config.ExpandEnv(*conf.OrgID)
+		conf.OrgID = &v
+	}
+
+	if conf.Prod == nil {
+		v := false
+		conf.Prod = &v
+	}
+
+	if conf.Env == nil {
+		conf.Env = map[string]string{}
+	}
+
+	aliases := make([]string, len(conf.Alias))
+	for i, alias := range conf.Alias {
+		aliases[i] = config.ExpandEnv(alias)
+	}
+
+	// the token is passed in the environment of the CLI, not on its command line where other users could read it
+	globalArgs := []string{}
+	if *conf.OrgID != "" {
+		globalArgs = append(globalArgs, "--scope", *conf.OrgID)
+	}
+
+	deployArgs := []string{"deploy", "--yes"}
+	if *conf.Prod {
+		deployArgs = append(deployArgs, "--prod")
+	}
+	keys := make([]string, 0, len(conf.Env))
+	for key := range conf.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		deployArgs = append(deployArgs, "--env", fmt.Sprintf("%s=%s", key, config.ExpandEnv(conf.Env[key])))
+	}
+
+	if dryRun {
+		if *conf.ProjectName != "" {
+			log.Info(fmt.Sprintf("vercel: would link %s to project %s", *conf.Directory, *conf.ProjectName))
+		}
+		log.Info(fmt.Sprintf("vercel: would deploy %s (production: %t)", *conf.Directory, *conf.Prod))
+		for _, alias := range aliases {
+			log.Info(fmt.Sprintf("vercel: would alias the deployment to %s", alias))
+		}
+		return nil
+	}
+
+	if *conf.ProjectName != "" {
+		_, err = run(ctx, *conf.Directory, *conf.Token, append([]string{"link", "--yes", "--project", *conf.ProjectName}, globalArgs...)...)
+		if err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("vercel: %s linked to project %s", *conf.Directory, *conf.ProjectName))
+	}
+
+	output, err := run(ctx, *conf.Directory, *conf.Token, append(deployArgs, globalArgs...)...)
+	if err != nil {
+		return err
+	}
+
+	// the deployment URL is the last line of the standard output
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	deploymentURL := strings.TrimSpace(lines[len(lines)-1])
+	if *conf.Prod {
+		log.Info(fmt.Sprintf("vercel: production deployment available at %s", deploymentURL))
+	} else {
+		log.Info(fmt.Sprintf("vercel: preview deployment available at %s", deploymentURL))
+	}
+
+	assigned := []string{}
+	for _, alias := range aliases {
+		_, err = run(ctx, *conf.Directory, *conf.Token, append([]string{"alias", "set", deploymentURL, alias}, globalArgs...)...)
+		if err != nil {
+			if len(assigned) != 0 {
+				return fmt.Errorf("%s (aliases assigned: %s)", err.Error(), strings.Join(assigned, ", "))
+			}
+			return err
+		}
+		assigned = append(assigned, alias)
+		log.Info(fmt.Sprintf("vercel: deployment aliased to https://%s", alias))
+	}
+	if len(assigned) != 0 {
+		log.With("aliases", assigned).Info(fmt.Sprintf("vercel: %d aliases assigned", len(assigned)))
+	}
+	return nil
+}
+
+// run execute the vercel CLI in dir, authenticated with token, and returns its standard output. The returned
+// error contains the exit code and the stderr output of the command if it fails
+func run(ctx context.Context, dir, token string, args ...string) (string, error) {
+	log.With("directory", dir).Debug(fmt.Sprintf("vercel: executing vercel %s", args[0]))
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "vercel", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "VERCEL_TOKEN="+token)
+	cmd.Stdout = &stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	err := cmd.Run()
+	if err != nil {
+		exitCode, _ := command.ExitCode(err)
+		return "", fmt.Errorf("vercel: %s failed with exit code %d: %s", args[0], exitCode, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bloom42/astroflow-go/log"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/environ"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/version"
+)
+
+func init() {
+	registry.Register("http", func(conf config.Config) registry.Provider {
+		if conf.HTTP == nil {
+			return nil
+		}
+		options := registry.Options{Env: conf.HTTP.Env, When: conf.HTTP.When, Timeout: conf.HTTP.Timeout}
+		return registry.New("http", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.HTTP, conf.DryRun)
+		})
+	})
+}
+
+// Deploy sends the configured HTTP request and checks the status code of the response
+func Deploy(conf config.HTTPConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.HTTPConfig, dryRun bool) error {
+	if conf.URL == nil {
+		v := ""
+		conf.URL = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.URL)
+		conf.URL = &v
+	}
+
+	if conf.Method == nil {
+		v := http.MethodPost
+		conf.Method = &v
+	} else {
+		v := strings.ToUpper(environ.ExpandEnv(ctx, *conf.Method))
+		conf.Method = &v
+	}
+
+	if conf.Body == nil {
+		v := ""
+		conf.Body = &v
+	} else {
+		v := environ.ExpandEnv(ctx, *conf.Body)
+		conf.Body = &v
+	}
+
+	headers := map[string]string{}
+	for key, value := range conf.Headers {
+		headers[key] = environ.ExpandEnv(ctx, value)
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("http: would send a %s request to %s", *conf.Method, *conf.URL))
+		return nil
+	}
+
+	req, err := http.NewRequest(*conf.Method, *conf.URL, strings.NewReader(*conf.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("rocket/%s", version.Version))
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		req.Header.Set(key, headers[key])
+	}
+
+	log.With("method", *conf.Method, "url", *conf.URL).Debug("http: sending request")
+	client := httpclient.WithContext(ctx, &http.Client{Timeout: 60 * time.Second})
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+
+	if !expectedStatus(conf.ExpectStatus, res.StatusCode) {
+		return &httpclient.StatusError{StatusCode: res.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	log.Info(fmt.Sprintf("http: %s %s responded with status %d", *conf.Method, *conf.URL, res.StatusCode))
+	return nil
+}
+
+// expectedStatus returns true if statusCode is the expected one, or a 2xx if expected is nil
+func expectedStatus(expected *int, statusCode int) bool {
+	if expected == nil {
+		return statusCode >= 200 && statusCode < 300
+	}
+	return statusCode == *expected
+}
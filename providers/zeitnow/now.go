@@ -2,19 +2,22 @@ package zeitnow
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"strings"
 
-	"github.com/bloom42/rocket/config"
-	"github.com/bloom42/rocket/version"
 	"github.com/bloom42/astroflow-go/log"
 	"github.com/z0mbie42/fswalk"
+
+	"github.com/bloom42/rocket/config"
+	"github.com/bloom42/rocket/providers/httpclient"
+	"github.com/bloom42/rocket/providers/registry"
+	"github.com/bloom42/rocket/version"
 )
 
 // Client is an wrapper to perform various task against the zeit API
@@ -52,7 +55,24 @@ type CreateDeploymentResponse struct {
 	//ReadyState string `json:"readyState"`
 }
 
-func Deploy(conf config.ZeitNowConfig) error {
+func init() {
+	registry.Register("zeit_now", func(conf config.Config) registry.Provider {
+		if conf.ZeitNow == nil {
+			return nil
+		}
+		options := registry.Options{Env: nil, When: conf.ZeitNow.When, Timeout: conf.ZeitNow.Timeout}
+		return registry.New("zeit_now", options, conf, func(ctx context.Context) error {
+			return DeployContext(ctx, *conf.ZeitNow, conf.DryRun)
+		})
+	})
+}
+
+func Deploy(conf config.ZeitNowConfig, dryRun bool) error {
+	return DeployContext(context.Background(), conf, dryRun)
+}
+
+// DeployContext is Deploy with a context: the deployment is cancelled when ctx is done
+func DeployContext(ctx context.Context, conf config.ZeitNowConfig, dryRun bool) error {
 	if conf.Token == nil {
 		v := os.Getenv("ZEIT_TOKEN")
 		conf.Token = &v
@@ -114,6 +134,7 @@ func Deploy(conf config.ZeitNowConfig) error {
 	}
 
 	client := NewClient(conf, *conf.Token)
+	client.HTTP = httpclient.WithContext(ctx, client.HTTP)
 	filesToDeploy := []File{}
 
 	walker, _ := fswalk.NewWalker()
@@ -123,6 +144,10 @@ func Deploy(conf config.ZeitNowConfig) error {
 			continue
 		}
 		log.With("file", file.Path).Debug("zeit_now: file to upload")
+		if dryRun {
+			log.Info(fmt.Sprintf("zeit_now: would upload %s", file.Path))
+			continue
+		}
 		f, err := client.UploadFile(file.Path)
 		if err != nil {
 			log.With("file", file.Path).Error(fmt.Sprintf("zeit_now: error uploading a file: %s", err.Error()))
@@ -132,14 +157,37 @@ func Deploy(conf config.ZeitNowConfig) error {
 		}
 	}
 
+	aliases := make([]string, len(conf.Alias))
+	for i, alias := range conf.Alias {
+		aliases[i] = config.ExpandEnv(alias)
+	}
+
+	if dryRun {
+		log.Info(fmt.Sprintf("zeit_now: would create deployment %s", *conf.Name))
+		for _, alias := range aliases {
+			log.Info(fmt.Sprintf("zeit_now: would alias the deployment to %s", alias))
+		}
+		return nil
+	}
+
 	log.With("files", filesToDeploy).Debug("zeit_now: creating deployment")
 	depRes, err := client.CreateDeployment(filesToDeploy)
 	if err != nil {
 		log.Error(fmt.Sprintf("zeit_now: error creating deployment  %v", err))
-	} else {
-		log.Info(fmt.Sprintf("zeit_now: deployment successfully created %s", depRes.URL))
+		return err
+	}
+	log.Info(fmt.Sprintf("zeit_now: deployment successfully created %s", depRes.URL))
+
+	assigned := []string{}
+	for _, alias := range aliases {
+		if err = client.AssignAlias(depRes.DeploymentID, alias); err != nil {
+			log.With("aliases", assigned).Error(fmt.Sprintf("zeit_now: error assigning alias %s: %v", alias, err))
+			return err
+		}
+		assigned = append(assigned, alias)
+		log.Info(fmt.Sprintf("zeit_now: deployment aliased to https://%s", alias))
 	}
-	return err
+	return nil
 }
 
 func NewClient(conf config.ZeitNowConfig, token string) Client {
@@ -193,7 +241,7 @@ func (c *Client) UploadFile(file string) (File, error) {
 		return ret, err
 	}
 	if resp.StatusCode != 200 {
-		return ret, errors.New(string(body))
+		return ret, &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	return ret, nil
@@ -236,9 +284,39 @@ func (c *Client) CreateDeployment(files []File) (CreateDeploymentResponse, error
 	log.With("response", string(body)).Debug("zeit_now: create deployment response received")
 
 	if resp.StatusCode != 200 {
-		return ret, errors.New(string(body))
+		return ret, &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	err = json.Unmarshal(body, &ret)
 	return ret, err
 }
+
+// AssignAlias assigns the alias (a domain) to the deployment
+func (c *Client) AssignAlias(deploymentID, alias string) error {
+	data, err := json.Marshal(map[string]string{"alias": alias})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("https://api.zeit.co/v2/now/deployments/%s/aliases", deploymentID)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.Token))
+	req.Header.Set("User-Agent", c.UserAgent)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		return &httpclient.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return nil
+}